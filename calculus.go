@@ -0,0 +1,493 @@
+package goculator
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/donseba/expronaut"
+)
+
+var (
+	// IntegrationTolerance is the relative accuracy integrate aims for.
+	IntegrationTolerance = 1e-10
+
+	// IntegrationMaxIntervals bounds the number of subintervals integrate
+	// splits the range into.
+	IntegrationMaxIntervals = 500
+
+	// SeriesMaxTerms bounds the number of terms sum_series adds up.
+	SeriesMaxTerms = 1_000_000
+)
+
+// Estimate is a numerically approximated value, together with an estimate
+// of its error.
+type Estimate struct {
+	Value       float64
+	Error       float64
+	Evaluations int
+	Method      string
+}
+
+func (e Estimate) String() string {
+	return Format(e.Value)
+}
+
+// Report describes how the value was approximated.
+func (e Estimate) Report() string {
+	return fmt.Sprintf("%s, %d evaluations, error estimate %.3g", e.Method, e.Evaluations, e.Error)
+}
+
+// Float returns the value, estimates calculate like plain numbers.
+func (e Estimate) Float() float64 {
+	return e.Value
+}
+
+// Operate lets an estimate be used in further calculations as its value.
+func (e Estimate) Operate(ctx context.Context, op expronaut.TokenType, other any, reverse bool) (any, error) {
+	return operateScalar(ctx, e, op, other, reverse)
+}
+
+// Apply passes the value of the estimate to builtin functions.
+func (e Estimate) Apply(ctx context.Context, name string, args []any) (any, error) {
+	return applyScalars(ctx, name, args)
+}
+
+func init() {
+	RegisterLazyFunction("diff", diff)
+	RegisterLazyFunction("integrate", integrate)
+	RegisterLazyFunction("limit", limit)
+	RegisterLazyFunction("sum_series", sumSeries)
+}
+
+// calculusArgs reads the expression, the variable and the numeric
+// arguments shared by the calculus builtins.
+func calculusArgs(ctx context.Context, name string, args []expronaut.ASTNode, numbers ...string) (expronaut.ASTNode, string, []float64, error) {
+	if len(args) != 2+len(numbers) {
+		return nil, "", nil, fmt.Errorf("%s function expects an expression, a variable and %d more arguments", name, len(numbers))
+	}
+
+	node, err := ExpressionArg(args[0])
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	variable, err := VariableArg(args[1])
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	values := make([]float64, len(numbers))
+	for i, arg := range args[2:] {
+		values[i], err = NumberArg(ctx, arg)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("%s of %s: %w", numbers[i], name, err)
+		}
+	}
+
+	return node, variable, values, nil
+}
+
+// counted wraps f to count its evaluations and to reject values that are
+// not finite.
+func counted(f func(float64) (float64, error), n *int) func(float64) (float64, error) {
+	return func(x float64) (float64, error) {
+		*n++
+		y, err := f(x)
+		if err != nil {
+			return 0, err
+		}
+		if math.IsNaN(y) || math.IsInf(y, 0) {
+			return 0, fmt.Errorf("expression is not finite at %s", Format(x))
+		}
+		return y, nil
+	}
+}
+
+// diff implements diff(expr, x, at). Without the point, diff(expr, x)
+// returns the symbolic derivative.
+func diff(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	if len(args) == 2 {
+		return derive(args)
+	}
+
+	node, variable, values, err := calculusArgs(ctx, "diff", args, "at")
+	if err != nil {
+		return nil, err
+	}
+
+	return Derivative(objective(ctx, node, variable), values[0])
+}
+
+// integrate implements integrate(expr, x, a, b).
+func integrate(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	node, variable, values, err := calculusArgs(ctx, "integrate", args, "a", "b")
+	if err != nil {
+		return nil, err
+	}
+
+	return Integral(ctx, objective(ctx, node, variable), values[0], values[1])
+}
+
+// limit implements limit(expr, x, at).
+func limit(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	node, variable, values, err := calculusArgs(ctx, "limit", args, "at")
+	if err != nil {
+		return nil, err
+	}
+
+	return Limit(objective(ctx, node, variable), values[0])
+}
+
+// sumSeries implements sum_series(expr, n, from, to), and
+// sum_series(expr, n, from) for an infinite series.
+func sumSeries(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	numbers := []string{"from", "to"}
+	if len(args) == 3 {
+		numbers = numbers[:1]
+	}
+
+	node, variable, values, err := calculusArgs(ctx, "sum_series", args, numbers...)
+	if err != nil {
+		return nil, err
+	}
+
+	to := math.Inf(1)
+	if len(values) == 2 {
+		to = values[1]
+	}
+
+	return SumSeries(ctx, objective(ctx, node, variable), values[0], to)
+}
+
+// Derivative approximates f'(x) with Ridders' method: central differences
+// for shrinking step sizes, extrapolated to a step size of zero with
+// Richardson extrapolation. The error estimate follows from how much the
+// extrapolated values still change.
+func Derivative(f func(float64) (float64, error), x float64) (Estimate, error) {
+	const (
+		shrink = 1.4
+		steps  = 10
+	)
+
+	out := Estimate{Error: math.Inf(1), Method: "richardson extrapolated central differences"}
+	f = counted(f, &out.Evaluations)
+
+	central := func(h float64) (float64, error) {
+		fp, err := f(x + h)
+		if err != nil {
+			return 0, err
+		}
+		fm, err := f(x - h)
+		if err != nil {
+			return 0, err
+		}
+		return (fp - fm) / (2 * h), nil
+	}
+
+	// start with a large step, shrinking it when f is not defined that far
+	// from x, like sqrt close to zero
+	h := 0.1 * math.Max(1, math.Abs(x))
+	first, err := central(h)
+	for i := 0; err != nil && i < 30; i++ {
+		h /= 2
+		first, err = central(h)
+	}
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	// table[j][i] is the j times extrapolated difference for the i-th step
+	var table [steps][steps]float64
+	table[0][0] = first
+
+	for i := 1; i < steps; i++ {
+		h /= shrink
+		table[0][i], err = central(h)
+		if err != nil {
+			return Estimate{}, err
+		}
+
+		factor := shrink * shrink
+		for j := 1; j <= i; j++ {
+			table[j][i] = (table[j-1][i]*factor - table[j-1][i-1]) / (factor - 1)
+			factor *= shrink * shrink
+
+			e := math.Max(math.Abs(table[j][i]-table[j-1][i]), math.Abs(table[j][i]-table[j-1][i-1]))
+			if e <= out.Error {
+				out.Value, out.Error = table[j][i], e
+			}
+		}
+
+		// higher orders got worse, rounding errors dominate from here on
+		if math.Abs(table[i][i]-table[i-1][i-1]) >= 2*out.Error {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// Limit approximates the limit of f at x by evaluating f at x ± h for
+// halving h and extrapolating both sides to h = 0 with Richardson
+// extrapolation. It fails when the two sides disagree.
+func Limit(f func(float64) (float64, error), x float64) (Estimate, error) {
+	out := Estimate{Method: "richardson extrapolation"}
+	f = counted(f, &out.Evaluations)
+
+	side := func(sign float64) (float64, float64, error) {
+		const steps = 12
+
+		value, best := math.NaN(), math.Inf(1)
+		h := 0.1 * math.Max(1, math.Abs(x))
+
+		var prev [steps]float64
+		for i := 0; i < steps; i++ {
+			y, err := f(x + sign*h)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			// row[j] is the j times extrapolated value, assuming the error
+			// is a power series in h
+			var row [steps]float64
+			row[0] = y
+			for j := 1; j <= i; j++ {
+				row[j] = row[j-1] + (row[j-1]-prev[j-1])/(math.Pow(2, float64(j))-1)
+
+				if e := math.Abs(row[j] - row[j-1]); e <= best {
+					value, best = row[j], e
+				}
+			}
+
+			prev = row
+			h /= 2
+		}
+
+		return value, best, nil
+	}
+
+	left, leftErr, err := side(-1)
+	if err != nil {
+		return Estimate{}, err
+	}
+	right, rightErr, err := side(1)
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	tolerance := 1e-6*math.Max(1, math.Abs(left)+math.Abs(right)) + leftErr + rightErr
+	if math.IsNaN(left) || math.IsNaN(right) || math.Abs(left-right) > tolerance {
+		return Estimate{}, fmt.Errorf("limit at %s does not exist: %s from the left, %s from the right", Format(x), Format(left), Format(right))
+	}
+
+	out.Value = (left + right) / 2
+	out.Error = math.Max(leftErr, rightErr) + math.Abs(left-right)/2
+	return out, nil
+}
+
+// Gauss-Kronrod 15 point nodes and weights on [-1, 1], the odd nodes are
+// the 7 point Gauss nodes.
+var (
+	kronrodNodes = [8]float64{
+		0.991455371120812639206854697526329, 0.949107912342758524526189684047851,
+		0.864864423359769072789712788640926, 0.741531185599394439863864773280788,
+		0.586087235467691130294144845693013, 0.405845151377397166906606412076961,
+		0.207784955007898467600689403773245, 0,
+	}
+	kronrodWeights = [8]float64{
+		0.022935322010529224963732008058970, 0.063092092629978553290700663189204,
+		0.104790010322250183839876322541518, 0.140653259715525918745189590510238,
+		0.169004726639267902826583426598550, 0.190350578064785409913256402421014,
+		0.204432940075298892414161999234649, 0.209482141084727828012999174891714,
+	}
+	gaussWeights = [4]float64{
+		0.129484966168869693270611432679082, 0.279705391489276667901467771423780,
+		0.381830050505118944950369775488975, 0.417959183673469387755102040816327,
+	}
+)
+
+type interval struct {
+	a, b, value, err float64
+}
+
+// kronrod integrates f over [a, b] with the 15 point Gauss-Kronrod rule,
+// estimating the error from the difference with the embedded Gauss rule.
+// The endpoints are never evaluated, so integrable singularities there,
+// like 1/sqrt(x) at zero, are fine.
+func kronrod(f func(float64) (float64, error), a, b float64) (interval, error) {
+	c, h := (a+b)/2, (b-a)/2
+
+	fc, err := f(c)
+	if err != nil {
+		return interval{}, err
+	}
+
+	k, g := fc*kronrodWeights[7], fc*gaussWeights[3]
+	for j := 0; j < 7; j++ {
+		x := h * kronrodNodes[j]
+
+		f1, err := f(c - x)
+		if err != nil {
+			return interval{}, err
+		}
+		f2, err := f(c + x)
+		if err != nil {
+			return interval{}, err
+		}
+
+		k += kronrodWeights[j] * (f1 + f2)
+		if j%2 == 1 {
+			g += gaussWeights[j/2] * (f1 + f2)
+		}
+	}
+
+	return interval{a: a, b: b, value: k * h, err: math.Abs((k - g) * h)}, nil
+}
+
+// Integral approximates the integral of f from a to b with adaptive
+// Gauss-Kronrod quadrature: the subinterval with the largest error
+// estimate is bisected until the total error estimate is within
+// IntegrationTolerance. When that takes more than IntegrationMaxIntervals
+// subintervals the integral is reported as not converging, which is what
+// happens for most divergent integrals.
+func Integral(ctx context.Context, f func(float64) (float64, error), a, b float64) (Estimate, error) {
+	out := Estimate{Method: "adaptive gauss-kronrod quadrature"}
+	if a == b {
+		return out, nil
+	}
+
+	sign := 1.0
+	if a > b {
+		a, b, sign = b, a, -1
+	}
+	f = counted(f, &out.Evaluations)
+
+	first, err := kronrod(f, a, b)
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	intervals := []interval{first}
+	total, totalErr := first.value, first.err
+
+	for len(intervals) < IntegrationMaxIntervals && totalErr > IntegrationTolerance*math.Max(1, math.Abs(total)) {
+		if err := ctx.Err(); err != nil {
+			return Estimate{}, err
+		}
+
+		worst := 0
+		for i, iv := range intervals {
+			if iv.err > intervals[worst].err {
+				worst = i
+			}
+		}
+
+		iv := intervals[worst]
+		mid := (iv.a + iv.b) / 2
+
+		left, err := kronrod(f, iv.a, mid)
+		if err != nil {
+			return Estimate{}, err
+		}
+		right, err := kronrod(f, mid, iv.b)
+		if err != nil {
+			return Estimate{}, err
+		}
+
+		intervals[worst] = left
+		intervals = append(intervals, right)
+
+		total += left.value + right.value - iv.value
+		totalErr += left.err + right.err - iv.err
+	}
+
+	// sum again to get rid of the rounding errors of the running totals
+	total, totalErr = 0, 0
+	for _, iv := range intervals {
+		total += iv.value
+		totalErr += iv.err
+	}
+
+	if totalErr > IntegrationTolerance*math.Max(1, math.Abs(total)) || math.IsNaN(total) || math.IsInf(total, 0) {
+		return Estimate{}, fmt.Errorf("%w: integral did not converge in %d subintervals, it may diverge (estimate %s, error estimate %.3g)", ErrNoConvergence, len(intervals), Format(sign*total), totalErr)
+	}
+
+	out.Value, out.Error = sign*total, totalErr
+	return out, nil
+}
+
+// SumSeries sums f(n) for the integers n from from to to, which may be
+// infinite. An infinite series is summed until its terms have become
+// negligible, one whose terms are not negligible after SeriesMaxTerms is
+// reported as ErrNoConvergence. Its error estimate is how much the sum changed since half as
+// many terms were added, which is roughly the size of the remaining tail
+// for slowly converging series.
+func SumSeries(ctx context.Context, f func(float64) (float64, error), from, to float64) (Estimate, error) {
+	if from != math.Trunc(from) || (!math.IsInf(to, 1) && to != math.Trunc(to)) {
+		return Estimate{}, fmt.Errorf("sum_series needs integer bounds, got %s and %s", Format(from), Format(to))
+	}
+	if !math.IsInf(to, 1) && to-from >= float64(SeriesMaxTerms) {
+		return Estimate{}, fmt.Errorf("sum_series can add up at most %d terms", SeriesMaxTerms)
+	}
+
+	out := Estimate{Method: "kahan summation"}
+	f = counted(f, &out.Evaluations)
+
+	var (
+		sum, compensation float64
+		checkpoints       [2]float64 // the sums after the last two powers of two terms
+		small             int        // consecutive negligible terms
+	)
+
+	for n := from; n <= to; n++ {
+		if out.Evaluations%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return Estimate{}, err
+			}
+		}
+
+		term, err := f(n)
+		if err != nil {
+			return Estimate{}, err
+		}
+
+		// Kahan summation keeps the rounding error from growing with the
+		// number of terms
+		y := term - compensation
+		t := sum + y
+		compensation = (t - sum) - y
+		sum = t
+
+		if math.IsInf(sum, 0) {
+			return Estimate{}, fmt.Errorf("series diverges")
+		}
+
+		if !math.IsInf(to, 1) {
+			continue
+		}
+
+		count := out.Evaluations
+		if count&(count-1) == 0 {
+			checkpoints[0], checkpoints[1] = checkpoints[1], sum
+		}
+
+		if math.Abs(term) <= IntegrationTolerance*math.Max(1, math.Abs(sum)) {
+			small++
+		} else {
+			small = 0
+		}
+
+		if small >= 10 {
+			out.Value, out.Error = sum, math.Abs(sum-checkpoints[0])
+			return out, nil
+		}
+		if count >= SeriesMaxTerms {
+			return Estimate{}, fmt.Errorf("%w: series did not settle in %d terms, it may diverge (partial sum %s)", ErrNoConvergence, count, Format(sum))
+		}
+	}
+
+	out.Value = sum
+	out.Error = 1e-16 * math.Abs(sum) * math.Sqrt(float64(out.Evaluations))
+	return out, nil
+}
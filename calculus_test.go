@@ -0,0 +1,61 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestCalculus(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+		tol   float64
+	}{
+		{input: "diff(x**3, x, 2)", want: 12, tol: 1e-6},
+		{input: "integrate(x**2, x, 0, 3)", want: 9, tol: 1e-9},
+		{input: "integrate(x**2, x, 3, 0)", want: -9, tol: 1e-9},
+		{input: "integrate(sqrt(x), x, 0, 1)", want: 2.0 / 3, tol: 1e-9},
+		{input: "integrate(sin(x), x, 0, 3.141592653589793)", want: 2, tol: 1e-9},
+		{input: "limit(sin(x)/x, x, 0)", want: 1, tol: 1e-6},
+		{input: "sum_series(n, n, 1, 100)", want: 5050, tol: 1e-9},
+		{input: "sum_series(1/n**2, n, 1)", want: math.Pi * math.Pi / 6, tol: 1e-4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := strconv.ParseFloat(Format(out), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > tt.tol {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculusDiverges(t *testing.T) {
+	tests := []string{
+		"integrate(1/x, x, 0, 1)",
+		"integrate(1/x**2, x, 0, 1)",
+		"sum_series(1, n, 1)",
+		"sum_series((-1)**n, n, 0)",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), input)
+			if !errors.Is(err, ErrNoConvergence) {
+				t.Fatalf("got %s and error %v, want %v", Format(out), err, ErrNoConvergence)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginAge is how long a login stays valid.
+const loginAge = 30 * 24 * time.Hour
+
+// loginRate is the login attempts per second allowed to every IP address,
+// after a burst of loginBurst.
+const (
+	loginRate  = 0.2
+	loginBurst = 5
+)
+
+// unknownUserHash is checked against when logging in as a user that does not
+// exist, it takes as long as checking a real password.
+const unknownUserHash = "pbkdf2-sha256$210000$AAAAAAAAAAAAAAAAAAAAAA$AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+
+// apiKeyPrefix starts every API key, so a leaked key is easy to recognise.
+const apiKeyPrefix = "gck_"
+
+var (
+	errUserExists   = errors.New("user already exists")
+	errUnknownUser  = errors.New("unknown user")
+	errBadLogin     = errors.New("wrong name or password")
+	errInvalidKey   = errors.New("invalid API key")
+	errUnknownKey   = errors.New("unknown API key")
+	errMissingName  = errors.New("missing name")
+	errWeakPassword = errors.New("password must be at least 8 characters")
+)
+
+// user is a local account, the password is only kept as a hash.
+type user struct {
+	Name     string    `json:"name"`
+	Password string    `json:"password"`
+	Admin    bool      `json:"admin"`
+	Created  time.Time `json:"created"`
+}
+
+// apiKey is a personal key for the API. Only the hash of its secret is
+// kept, the key itself is shown once when it is created.
+type apiKey struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Owner   string    `json:"owner"`
+	Hash    string    `json:"hash"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+// login is a signed in browser, it is kept under the hash of the token in
+// its cookie.
+type login struct {
+	User    string    `json:"user"`
+	Expires time.Time `json:"expires"`
+}
+
+type accountData struct {
+	Users  []user           `json:"users"`
+	Keys   []apiKey         `json:"keys"`
+	Logins map[string]login `json:"logins"`
+}
+
+// accountStore keeps the users, their API keys and logins in a JSON file,
+// which is rewritten as a whole on every change.
+type accountStore struct {
+	mu     sync.Mutex
+	path   string
+	users  map[string]user
+	keys   map[string]apiKey
+	logins map[string]login
+}
+
+// loadAccounts reads the accounts kept in the file, a missing file is an
+// empty store.
+func loadAccounts(path string) (*accountStore, error) {
+	s := &accountStore{path: path, users: map[string]user{}, keys: map[string]apiKey{}, logins: map[string]login{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ad accountData
+	if err := json.Unmarshal(data, &ad); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for _, u := range ad.Users {
+		s.users[u.Name] = u
+	}
+	for _, k := range ad.Keys {
+		s.keys[k.ID] = k
+	}
+	for token, l := range ad.Logins {
+		s.logins[token] = l
+	}
+
+	return s, nil
+}
+
+// bootstrapAdmin creates the administrator when no user exists yet, so the
+// server never waits for whoever logs in first to claim the role.
+func bootstrapAdmin(s *accountStore, name, password string) error {
+	if !s.Empty() {
+		return nil
+	}
+	if name == "" || password == "" {
+		return errors.New("no users yet: set -admin or GOCULATOR_ADMIN, and GOCULATOR_ADMIN_PASSWORD, to create the administrator")
+	}
+
+	if err := s.CreateUser(name, password, true); err != nil {
+		return fmt.Errorf("creating administrator %s: %w", name, err)
+	}
+	slog.Info("created administrator", "user", name)
+
+	return nil
+}
+
+// Empty reports whether no user has been created yet.
+func (s *accountStore) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.users) == 0
+}
+
+// Users returns the users ordered by name.
+func (s *accountStore) Users() []user {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]user, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// User returns the user of the name.
+func (s *accountStore) User(name string) (user, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[name]
+	return u, ok
+}
+
+// CreateUser adds a user with the password.
+func (s *accountStore) CreateUser(name, password string, admin bool) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errMissingName
+	}
+	if len(password) < 8 {
+		return errWeakPassword
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[name]; ok {
+		return fmt.Errorf("%w: %s", errUserExists, name)
+	}
+	s.users[name] = user{Name: name, Password: hash, Admin: admin, Created: time.Now()}
+
+	if err := s.write(); err != nil {
+		delete(s.users, name)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUser removes the user together with its keys and logins.
+func (s *accountStore) DeleteUser(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[name]; !ok {
+		return fmt.Errorf("%w: %s", errUnknownUser, name)
+	}
+
+	delete(s.users, name)
+	for id, k := range s.keys {
+		if k.Owner == name {
+			delete(s.keys, id)
+		}
+	}
+	for token, l := range s.logins {
+		if l.User == name {
+			delete(s.logins, token)
+		}
+	}
+
+	return s.write()
+}
+
+// Authenticate checks the password of the user.
+func (s *accountStore) Authenticate(name, password string) (user, error) {
+	u, ok := s.User(name)
+	if !ok {
+		// hash anyway, so the response time does not tell which names exist
+		_, _ = checkPassword(unknownUserHash, password)
+		return user{}, errBadLogin
+	}
+
+	ok, err := checkPassword(u.Password, password)
+	if err != nil {
+		return user{}, err
+	}
+	if !ok {
+		return user{}, errBadLogin
+	}
+
+	return u, nil
+}
+
+// StartLogin returns the token of a new login of the user.
+func (s *accountStore) StartLogin(name string) (string, error) {
+	token := newSessionID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logins[hashToken(token)] = login{User: name, Expires: time.Now().Add(loginAge)}
+	if err := s.write(); err != nil {
+		delete(s.logins, hashToken(token))
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Login returns the user signed in with the token.
+func (s *accountStore) Login(token string) (user, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.logins[hashToken(token)]
+	if !ok || time.Now().After(l.Expires) {
+		return user{}, false
+	}
+
+	u, ok := s.users[l.User]
+	return u, ok
+}
+
+// EndLogin removes the login of the token.
+func (s *accountStore) EndLogin(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashToken(token)
+	if _, ok := s.logins[key]; !ok {
+		return nil
+	}
+	delete(s.logins, key)
+
+	return s.write()
+}
+
+// Keys returns the API keys of the user ordered by creation, or those of all
+// users when the name is empty.
+func (s *accountStore) Keys(owner string) []apiKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []apiKey
+	for _, k := range s.keys {
+		if owner == "" || k.Owner == owner {
+			list = append(list, k)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+
+	return list
+}
+
+// newKeyID returns the id of a new API key, the part of the key it is
+// looked up by.
+var newKeyID = func() string {
+	return newSessionID()[:8]
+}
+
+// CreateKey adds an API key of the user with the scopes and returns the key,
+// which can not be recovered later.
+func (s *accountStore) CreateKey(owner, name string, scopes []string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errMissingName
+	}
+
+	secret := newSessionID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[owner]; !ok {
+		return "", fmt.Errorf("%w: %s", errUnknownUser, owner)
+	}
+
+	// the id is short, a key of someone else may already have it
+	id := newKeyID()
+	for {
+		if _, taken := s.keys[id]; !taken {
+			break
+		}
+		id = newKeyID()
+	}
+	s.keys[id] = apiKey{ID: id, Name: name, Owner: owner, Hash: hashToken(secret), Scopes: slices.Clone(scopes), Created: time.Now()}
+
+	if err := s.write(); err != nil {
+		delete(s.keys, id)
+		return "", err
+	}
+
+	return apiKeyPrefix + id + "_" + secret, nil
+}
+
+// RevokeKey removes an API key.
+func (s *accountStore) RevokeKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return errUnknownKey
+	}
+	delete(s.keys, id)
+
+	return s.write()
+}
+
+// Key returns the API key, and the user it belongs to, of a key sent with a
+// request.
+func (s *accountStore) Key(key string) (apiKey, user, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, apiKeyPrefix) {
+		return apiKey{}, user{}, errInvalidKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashToken(secret))) != 1 {
+		return apiKey{}, user{}, errInvalidKey
+	}
+
+	u, ok := s.users[k.Owner]
+	if !ok {
+		return apiKey{}, user{}, errInvalidKey
+	}
+
+	return k, u, nil
+}
+
+// write saves all accounts to the file, expired logins are dropped.
+func (s *accountStore) write() error {
+	ad := accountData{Logins: map[string]login{}}
+	for _, u := range s.users {
+		ad.Users = append(ad.Users, u)
+	}
+	sort.Slice(ad.Users, func(i, j int) bool { return ad.Users[i].Name < ad.Users[j].Name })
+	for _, k := range s.keys {
+		ad.Keys = append(ad.Keys, k)
+	}
+	sort.Slice(ad.Keys, func(i, j int) bool { return ad.Keys[i].ID < ad.Keys[j].ID })
+
+	now := time.Now()
+	for token, l := range s.logins {
+		if now.After(l.Expires) {
+			delete(s.logins, token)
+			continue
+		}
+		ad.Logins[token] = l
+	}
+
+	data, err := json.MarshalIndent(ad, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.path, data)
+}
+
+// hashToken returns the hash a login token or the secret of an API key is
+// kept under. They are random, so unlike passwords they need no salt.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
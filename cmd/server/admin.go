@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type adminPage struct {
+	User   user
+	Scopes []scope
+	Keys   template.HTML
+	Users  template.HTML
+}
+
+// Admin renders the page managing API keys: the keys of the signed in user,
+// or of everyone together with the users for an administrator.
+func (a *App) Admin(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("admin.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	u, _ := currentUser(r)
+	page := adminPage{User: u, Scopes: apiScopes, Keys: template.HTML(a.keyList(u, ""))}
+	if u.Admin {
+		page.Users = template.HTML(userList(a.Accounts.Users(), u))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CreateKey creates an API key for the signed in user with the scopes of the
+// form, and renders the updated list showing the new key once.
+func (a *App) CreateKey(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	u, _ := currentUser(r)
+
+	if err := r.ParseForm(); err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte(a.keyList(u, "")))
+		return
+	}
+
+	scopes := r.PostForm["scope"]
+	for _, name := range strings.FieldsFunc(r.PostFormValue("functions"), func(r rune) bool { return r == ',' || r == ' ' }) {
+		scopes = append(scopes, "fn:"+name)
+	}
+
+	key, err := a.Accounts.CreateKey(u.Name, r.PostFormValue("name"), scopes)
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+	} else {
+		h.TriggerInfo("created API key, copy it now as it is not shown again")
+	}
+
+	_, _ = h.Write([]byte(a.keyList(u, key)))
+}
+
+// RevokeKey removes an API key of the signed in user, administrators may
+// revoke any key.
+func (a *App) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	u, _ := currentUser(r)
+
+	id := r.PathValue("id")
+	err := errUnknownKey
+	for _, k := range a.Accounts.Keys("") {
+		if k.ID == id && (k.Owner == u.Name || u.Admin) {
+			err = a.Accounts.RevokeKey(id)
+			break
+		}
+	}
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+	} else {
+		h.TriggerInfo("revoked API key")
+	}
+
+	_, _ = h.Write([]byte(a.keyList(u, "")))
+}
+
+// CreateUser adds a user and renders the updated list of users.
+func (a *App) CreateUser(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	u, _ := currentUser(r)
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if err := a.Accounts.CreateUser(name, r.PostFormValue("password"), r.PostFormValue("admin") != ""); err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+	} else {
+		h.TriggerInfo(fmt.Sprintf("created user %s", name))
+	}
+
+	_, _ = h.Write([]byte(userList(a.Accounts.Users(), u)))
+}
+
+// DeleteUser removes a user with its keys and renders the updated list of
+// users. Administrators can not remove themselves.
+func (a *App) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	u, _ := currentUser(r)
+
+	name := r.PathValue("name")
+	err := errors.New("cannot remove yourself")
+	if name != u.Name {
+		err = a.Accounts.DeleteUser(name)
+	}
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+	} else {
+		h.TriggerInfo(fmt.Sprintf("removed user %s", name))
+	}
+
+	_, _ = h.Write([]byte(userList(a.Accounts.Users(), u)))
+}
+
+// keyList renders the API keys the user may manage. A key that was just
+// created is shown above the list, it can not be shown again.
+func (a *App) keyList(u user, created string) string {
+	owner := u.Name
+	if u.Admin {
+		owner = ""
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(`<div id="keys">`)
+	if created != "" {
+		fmt.Fprintf(&sb, `<div class="mb-2 p-2 bg-yellow-100 rounded-md text-xs">new key: <code class="select-all">%s</code></div>`, html.EscapeString(created))
+	}
+
+	keys := a.Accounts.Keys(owner)
+	if len(keys) == 0 {
+		sb.WriteString(`<div class="text-xs text-gray-500">no API keys</div></div>`)
+		return sb.String()
+	}
+
+	sb.WriteString(`<table class="w-full text-xs text-left"><thead><tr class="text-gray-500"><th>name</th><th>owner</th><th>scopes</th><th>created</th><th></th></tr></thead><tbody>`)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, `<tr><td class="p-1">%s <span class="text-gray-500 font-mono">%s%s_…</span></td><td class="p-1">%s</td><td class="p-1 font-mono">%s</td><td class="p-1">%s</td><td class="p-1"><button type="button" class="text-red-600" hx-delete="/admin/keys/%s" hx-target="#keys" hx-swap="outerHTML" hx-confirm="Revoke %s?">revoke</button></td></tr>`,
+			html.EscapeString(k.Name), apiKeyPrefix, k.ID, html.EscapeString(k.Owner), html.EscapeString(strings.Join(k.Scopes, " ")),
+			k.Created.Format(time.DateOnly), url.PathEscape(k.ID), html.EscapeString(k.Name))
+	}
+	sb.WriteString(`</tbody></table></div>`)
+
+	return sb.String()
+}
+
+// userList renders the users, every one but the administrator viewing the
+// list can be removed.
+func userList(users []user, viewer user) string {
+	sb := strings.Builder{}
+	sb.WriteString(`<ul id="users" class="text-xs space-y-1">`)
+	for _, u := range users {
+		role := ""
+		if u.Admin {
+			role = ` <span class="text-gray-500">administrator</span>`
+		}
+
+		remove := ""
+		if u.Name != viewer.Name {
+			remove = fmt.Sprintf(`<button type="button" class="text-red-600" hx-delete="/admin/users/%s" hx-target="#users" hx-swap="outerHTML" hx-confirm="Remove %s and their keys?">×</button>`,
+				url.PathEscape(u.Name), html.EscapeString(u.Name))
+		}
+
+		fmt.Fprintf(&sb, `<li class="flex justify-between"><span>%s%s</span>%s</li>`, html.EscapeString(u.Name), role, remove)
+	}
+	sb.WriteString(`</ul>`)
+
+	return sb.String()
+}
+
+// Account renders the links to the API keys and to log out in the header of
+// the calculator, nothing when accounts are disabled.
+func (a *App) Account(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	u, ok := currentUser(r)
+	if !ok {
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	_, _ = h.Write([]byte(fmt.Sprintf(`<a class="text-xs text-gray-500 underline mr-2" href="/admin">%s</a><form class="inline" method="post" action="/logout"><button class="text-xs text-gray-500 underline mr-2">log out</button></form>`,
+		html.EscapeString(u.Name))))
+}
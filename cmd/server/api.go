@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+// apiError is the body of every failed API request.
+type apiError struct {
+	Error string          `json:"error"`
+	Span  *goculator.Span `json:"span,omitempty"`
+}
+
+// writeJSON writes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes err as an API error, syntax errors include the span
+// of the input they refer to.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	body := apiError{Error: err.Error()}
+
+	var se *goculator.SyntaxError
+	if errors.As(err, &se) {
+		body.Span = &se.Span
+	}
+
+	writeJSON(w, status, body)
+}
+
+// expressionRequest is the body of the API requests taking an expression.
+type expressionRequest struct {
+	Expression string `json:"expression"`
+}
+
+// readExpression decodes the expression from a JSON body.
+func readExpression(r *http.Request) (string, error) {
+	var req expressionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", fmt.Errorf("invalid request body: %w", err)
+	}
+	if strings.TrimSpace(req.Expression) == "" {
+		return "", errors.New("missing expression")
+	}
+	return req.Expression, nil
+}
+
+type explainResponse struct {
+	Expression string           `json:"expression"`
+	Result     string           `json:"result,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Steps      []goculator.Step `json:"steps"`
+}
+
+// ExplainAPI evaluates an expression and returns every evaluation step in
+// order. An expression that fails to evaluate still returns the steps up to
+// the failure.
+func (a *App) ExplainAPI(w http.ResponseWriter, r *http.Request) {
+	in, err := readExpression(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tree, err := goculator.Parse(in)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := a.session(w, r).calcContext(r)
+	defer cancel()
+
+	ti := time.Now()
+	out, steps, err := tree.Explain(ctx)
+	a.evaluated(r.Context(), in, out, time.Since(ti), err)
+
+	res := explainResponse{Expression: in, Steps: steps}
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Result = goculator.Format(out)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type functionsResponse struct {
+	Functions []goculator.FunctionDoc `json:"functions"`
+}
+
+// FunctionsAPI returns the builtins the request may call and the functions
+// of the session, with their arguments and a description.
+func (a *App) FunctionsAPI(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+
+	var res functionsResponse
+	for _, doc := range goculator.BuiltinDocs() {
+		if goculator.Allowed(r.Context(), doc.Name) {
+			res.Functions = append(res.Functions, doc)
+		}
+	}
+	for _, f := range sess.Functions.List() {
+		res.Functions = append(res.Functions, f.Doc())
+	}
+	slices.SortStableFunc(res.Functions, func(a, b goculator.FunctionDoc) int { return strings.Compare(a.Name, b.Name) })
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// traceTree renders the out-of-band swap of the explain panel under the
+// result: the steps as a tree of expandable nodes, each showing the part of
+// the input it evaluated and its value.
+func traceTree(steps []goculator.Step) string {
+	if len(steps) == 0 {
+		return `<div id="trace" hx-swap-oob="true"></div>`
+	}
+
+	children := make(map[int][]goculator.Step)
+	for _, s := range steps {
+		children[s.Parent] = append(children[s.Parent], s)
+	}
+	for _, c := range children {
+		sort.Slice(c, func(i, j int) bool { return c[i].ID < c[j].ID })
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(`<div id="trace" hx-swap-oob="true" class="text-left text-xs font-mono">`)
+
+	var render func(s goculator.Step)
+	render = func(s goculator.Step) {
+		label := html.EscapeString(s.Source)
+		if s.Operator != "" && s.Kind != "identifier" {
+			label = `<span class="text-gray-500">` + html.EscapeString(s.Operator) + `</span> ` + label
+		}
+
+		value := `<span class="text-blue-700">` + html.EscapeString(s.Value) + `</span>`
+		if s.Error != "" {
+			value = `<span class="text-red-600">` + html.EscapeString(s.Error) + `</span>`
+		}
+
+		if len(children[s.ID]) == 0 {
+			fmt.Fprintf(&sb, `<div class="pl-4">%s = %s</div>`, label, value)
+			return
+		}
+
+		open := ""
+		if s.Depth < 2 {
+			open = " open"
+		}
+		fmt.Fprintf(&sb, `<details class="pl-2"%s><summary>%s = %s</summary>`, open, label, value)
+		for _, c := range children[s.ID] {
+			render(c)
+		}
+		sb.WriteString(`</details>`)
+	}
+
+	for _, root := range children[-1] {
+		render(root)
+	}
+
+	sb.WriteString(`</div>`)
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/donseba/goculator"
+)
+
+func TestFunctionsAPI(t *testing.T) {
+	s, err := loadAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateUser("alice", "long enough", false); err != nil {
+		t.Fatal(err)
+	}
+	key, err := s.CreateKey("alice", "hints", []string{"functions", "fn:sqrt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.StartLogin("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{Accounts: s, Store: goculator.NewMemoryStore(goculator.Retention{}), Sessions: newSessionStore(0, 0)}
+	f, _ := goculator.ParseDefinition("area(w, h) = w * h")
+	if err := app.Sessions.Add(newSession("user:alice")).Functions.Define(f); err != nil {
+		t.Fatal(err)
+	}
+	handler := app.requireKeyOrLogin("functions", app.FunctionsAPI)
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		status int
+		want   []string
+		absent []string
+	}{
+		{name: "key", header: "Bearer " + key, status: http.StatusOK, want: []string{"area", "sqrt"}, absent: []string{"sin"}},
+		{name: "login", cookie: token, status: http.StatusOK, want: []string{"area", "sin", "sqrt"}},
+		{name: "unknown key", header: "Bearer nope", status: http.StatusUnauthorized},
+		{name: "anonymous", status: http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/functions", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: loginCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var res functionsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, len(res.Functions))
+			for i, doc := range res.Functions {
+				names[i] = doc.Name
+			}
+			if !slices.IsSorted(names) {
+				t.Fatalf("not sorted: %v", names)
+			}
+			for _, name := range tt.want {
+				if !slices.Contains(names, name) {
+					t.Errorf("%s is missing from %v", name, names)
+				}
+			}
+			for _, name := range tt.absent {
+				if slices.Contains(names, name) {
+					t.Errorf("%s is listed", name)
+				}
+			}
+		})
+	}
+}
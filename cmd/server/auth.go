@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+const loginCookie = "goculator_login"
+
+// scope is a feature of the API a key can be allowed to use.
+type scope struct {
+	Name        string
+	Description string
+}
+
+// apiScopes are the features of the API. Which functions a key may call is
+// a scope as well: "fn:sin" allows sin, "fn:*" every function.
+var apiScopes = []scope{
+	{"explain", "evaluate expressions, with every step"},
+	{"parse", "tokens and parsed trees of expressions"},
+	{"gotemplate", "convert expressions into Go templates"},
+	{"functions", "list the functions with their arguments"},
+}
+
+// allows reports whether the key has the scope.
+func (k apiKey) allows(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// allowsFunction reports whether expressions sent with the key may call the
+// function.
+func (k apiKey) allowsFunction(name string) bool {
+	return k.allows("fn:*") || k.allows("fn:"+name)
+}
+
+type userKey struct{}
+
+// currentUser returns the user signed in for the request, false when
+// accounts are disabled.
+func currentUser(r *http.Request) (user, bool) {
+	u, ok := r.Context().Value(userKey{}).(user)
+	return u, ok
+}
+
+// requireLogin only lets requests of a signed in user through. Pages
+// redirect to the login form, HTMX requests are told to go there.
+func (a *App) requireLogin(next http.HandlerFunc) http.Handler {
+	if a.Accounts == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(loginCookie); err == nil {
+			if u, ok := a.Accounts.Login(c.Value); ok {
+				next(w, r.WithContext(context.WithValue(r.Context(), userKey{}, u)))
+				return
+			}
+		}
+
+		switch {
+		case r.Header.Get("HX-Request") == "true":
+			w.Header().Set("HX-Redirect", "/login")
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodGet && r.Header.Get("Accept") != "text/event-stream":
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		default:
+			http.Error(w, "login required", http.StatusUnauthorized)
+		}
+	})
+}
+
+// requireKey only lets API requests through that carry a key with the scope,
+// sent as a bearer token. Expressions evaluated for the request may only
+// call the functions the key allows.
+func (a *App) requireKey(scope string, next http.HandlerFunc) http.Handler {
+	if a.Accounts == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goculator"`)
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing API key"))
+			return
+		}
+
+		k, u, err := a.Accounts.Key(strings.TrimSpace(token))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goculator", error="invalid_token"`)
+			writeAPIError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if !k.allows(scope) {
+			writeAPIError(w, http.StatusForbidden, fmt.Errorf("API key %s lacks the %s scope", k.Name, scope))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userKey{}, u)
+		ctx = context.WithValue(ctx, apiKeyKey{}, k)
+		ctx = goculator.WithFunctionPolicy(ctx, k.allowsFunction)
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// requireKeyOrLogin lets API requests through that carry a key with the
+// scope, and requests of a signed in user, for the parts of the API the
+// pages use as well.
+func (a *App) requireKeyOrLogin(scope string, next http.HandlerFunc) http.Handler {
+	key, login := a.requireKey(scope, next), a.requireLogin(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			key.ServeHTTP(w, r)
+			return
+		}
+		login.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin only lets requests of a signed in administrator through.
+func (a *App) requireAdmin(next http.HandlerFunc) http.Handler {
+	return a.requireLogin(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := currentUser(r); !ok || !u.Admin {
+			http.Error(w, "administrators only", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+type loginPage struct {
+	Name  string
+	Error string
+}
+
+// Login renders the login form.
+func (a *App) Login(w http.ResponseWriter, r *http.Request) {
+	a.renderLogin(w, http.StatusOK, loginPage{})
+}
+
+// LoginSubmit signs the user in and returns to the calculator.
+func (a *App) LoginSubmit(w http.ResponseWriter, r *http.Request) {
+	name, password := strings.TrimSpace(r.PostFormValue("name")), r.PostFormValue("password")
+
+	page := loginPage{Name: name}
+
+	u, err := a.Accounts.Authenticate(name, password)
+	if err != nil {
+		if !errors.Is(err, errBadLogin) {
+			logger(r.Context()).Error("login", "user", name, "err", err)
+		}
+		page.Error = errBadLogin.Error()
+		a.renderLogin(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	token, err := a.Accounts.StartLogin(u.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(loginAge),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// limitLogin only lets a client try to log in while it has tokens of the
+// login limiter left, to slow down guessing passwords. Others get the form
+// back with 429 Too Many Requests.
+func (a *App) limitLogin(next http.HandlerFunc) http.HandlerFunc {
+	if a.LoginLimiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := a.LoginLimiter.Allow(clientID(r))
+		if ok {
+			next(w, r)
+			return
+		}
+
+		retry := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		a.renderLogin(w, http.StatusTooManyRequests, loginPage{
+			Name:  strings.TrimSpace(r.PostFormValue("name")),
+			Error: fmt.Sprintf("too many attempts, try again in %ds", retry),
+		})
+	}
+}
+
+// Logout ends the login of the browser.
+func (a *App) Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(loginCookie); err == nil {
+		if err := a.Accounts.EndLogin(c.Value); err != nil {
+			logger(r.Context()).Error("logging out", "err", err)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (a *App) renderLogin(w http.ResponseWriter, status int, page loginPage) {
+	tmpl, err := template.ParseFiles("login.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, page); err != nil {
+		slog.Error("rendering login", "err", err)
+	}
+}
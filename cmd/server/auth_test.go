@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		admin    string
+		password string
+		wantErr  bool
+		want     string
+	}{
+		{name: "no credentials", wantErr: true},
+		{name: "no password", admin: "alice", wantErr: true},
+		{name: "weak password", admin: "alice", password: "short", wantErr: true},
+		{name: "created", admin: "alice", password: "long enough", want: "alice"},
+		{name: "users exist", existing: "bob", want: "bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := loadAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.existing != "" {
+				if err := s.CreateUser(tt.existing, "long enough", false); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = bootstrapAdmin(s, tt.admin, tt.password)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				if !s.Empty() {
+					t.Fatal("a user was created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			users := s.Users()
+			if len(users) != 1 || users[0].Name != tt.want {
+				t.Fatalf("got users %v, want only %s", users, tt.want)
+			}
+			if tt.existing == "" && !users[0].Admin {
+				t.Fatal("the user created is no administrator")
+			}
+		})
+	}
+}
+
+func TestLoginIsRateLimited(t *testing.T) {
+	s, err := loadAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateUser("alice", "long enough", true); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{Accounts: s, LoginLimiter: newRateLimiter(0.001, 2)}
+	handler := app.limitLogin(app.LoginSubmit)
+
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{password: "wrong guess", want: http.StatusUnauthorized},
+		{password: "other guess", want: http.StatusUnauthorized},
+		// out of attempts, even with the right password
+		{password: "long enough", want: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("name=alice&password="+tt.password))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		handler(w, r)
+
+		if w.Code != tt.want {
+			t.Fatalf("%s: got status %d, want %d", tt.password, w.Code, tt.want)
+		}
+	}
+}
+
+func TestCreateKeyAvoidsTakenIDs(t *testing.T) {
+	s, err := loadAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if err := s.CreateUser(name, "long enough", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first two ids collide
+	ids := []string{"aaaaaaaa", "aaaaaaaa", "bbbbbbbb"}
+	old := newKeyID
+	t.Cleanup(func() { newKeyID = old })
+	newKeyID = func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+
+	alice, err := s.CreateKey("alice", "first", []string{"evaluate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.CreateKey("bob", "second", []string{"evaluate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   string
+		owner string
+		id    string
+	}{
+		{key: alice, owner: "alice", id: "aaaaaaaa"},
+		{key: bob, owner: "bob", id: "bbbbbbbb"},
+	}
+	for _, tt := range tests {
+		k, u, err := s.Key(tt.key)
+		if err != nil {
+			t.Fatalf("key of %s: %v", tt.owner, err)
+		}
+		if u.Name != tt.owner || k.ID != tt.id {
+			t.Errorf("got key %s of %s, want %s of %s", k.ID, u.Name, tt.id, tt.owner)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/donseba/goculator"
+)
+
+// maxCompletions limits the names a completion returns.
+const maxCompletions = 20
+
+// completion is a name the input can be completed with.
+type completion struct {
+	Name string `json:"name"`
+	// Kind is builtin, function for a function of the session, or
+	// variable.
+	Kind string `json:"kind"`
+}
+
+// Complete returns the builtins, functions and variables of the session
+// whose name starts with the prefix in the query, as JSON.
+func (a *App) Complete(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+	prefix := r.URL.Query().Get("prefix")
+
+	var out []completion
+	for name := range sess.Variables() {
+		if strings.HasPrefix(name, prefix) {
+			out = append(out, completion{Name: name, Kind: "variable"})
+		}
+	}
+	for _, f := range sess.Functions.List() {
+		if strings.HasPrefix(f.Name, prefix) {
+			out = append(out, completion{Name: f.Name, Kind: "function"})
+		}
+	}
+	for _, name := range goculator.Builtins() {
+		if strings.HasPrefix(name, prefix) {
+			out = append(out, completion{Name: name, Kind: "builtin"})
+		}
+	}
+
+	slices.SortStableFunc(out, func(a, b completion) int { return strings.Compare(a.Name, b.Name) })
+	if len(out) > maxCompletions {
+		out = out[:maxCompletions]
+	}
+	if out == nil {
+		out = []completion{}
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// History returns an expression of the history of the session as text, the
+// most recent for n 0, the one before it for 1 and so on. There is nothing
+// before the oldest.
+func (a *App) History(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n < 0 {
+		http.Error(w, "n must be a number of calculations back", http.StatusBadRequest)
+		return
+	}
+
+	history, err := a.Store.History(r.Context(), sess.ID, n+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n >= len(history) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(history[n].Expression))
+}
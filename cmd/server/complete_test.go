@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+func TestComplete(t *testing.T) {
+	app := &App{Store: goculator.NewMemoryStore(goculator.Retention{}), Sessions: newSessionStore(0, 0)}
+
+	sess := app.Sessions.Add(newSession("completing"))
+	sess.SetVariable("sqrtish", 2.0)
+	f, err := goculator.ParseDefinition("sqfoo(x) = x * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Functions.Define(f); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prefix string
+		want   []completion
+	}{
+		{prefix: "sq", want: []completion{
+			{Name: "sqfoo", Kind: "function"},
+			{Name: "sqrt", Kind: "builtin"},
+			{Name: "sqrtish", Kind: "variable"},
+		}},
+		{prefix: "sqrti", want: []completion{{Name: "sqrtish", Kind: "variable"}}},
+		{prefix: "zzz", want: []completion{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/complete?prefix="+tt.prefix, nil)
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.ID})
+			w := httptest.NewRecorder()
+			app.Complete(w, r)
+
+			var got []completion
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v: %s", err, w.Body)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompleteIsLimited(t *testing.T) {
+	app := &App{Store: goculator.NewMemoryStore(goculator.Retention{}), Sessions: newSessionStore(0, 0)}
+
+	w := httptest.NewRecorder()
+	app.Complete(w, httptest.NewRequest(http.MethodGet, "/complete", nil))
+
+	var got []completion
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	if len(got) != maxCompletions {
+		t.Fatalf("got %d names, want %d", len(got), maxCompletions)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	store := goculator.NewMemoryStore(goculator.Retention{})
+	app := &App{Store: store, Sessions: newSessionStore(0, 0)}
+
+	sess := app.Sessions.Add(newSession("recalling"))
+	for i, expr := range []string{"1 + 1", "2 * 3"} {
+		entry := goculator.HistoryEntry{Expression: expr, Time: time.Unix(int64(i), 0)}
+		if err := store.AddHistory(context.Background(), sess.ID, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		n      string
+		status int
+		want   string
+	}{
+		{n: "0", status: http.StatusOK, want: "2 * 3"},
+		{n: "1", status: http.StatusOK, want: "1 + 1"},
+		{n: "2", status: http.StatusNoContent},
+		{n: "-1", status: http.StatusBadRequest},
+		{n: "last", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/history?n="+tt.n, nil)
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.ID})
+			w := httptest.NewRecorder()
+			app.History(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.want {
+				t.Fatalf("got %q, want %q", w.Body, tt.want)
+			}
+		})
+	}
+}
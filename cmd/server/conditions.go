@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+// savedCondition is a condition of the playground together with the cases
+// it is tested with. It belongs to the session that saved it, the name is
+// unique per owner.
+type savedCondition struct {
+	Owner     string           `json:"owner"`
+	Name      string           `json:"name"`
+	Condition string           `json:"condition"`
+	Cases     []goculator.Case `json:"cases"`
+	Saved     time.Time        `json:"saved"`
+}
+
+// conditionKey identifies a saved condition.
+type conditionKey struct {
+	owner, name string
+}
+
+// conditionStore keeps the saved conditions in a JSON file, which is
+// rewritten as a whole on every change.
+type conditionStore struct {
+	mu         sync.Mutex
+	path       string
+	conditions map[conditionKey]savedCondition
+}
+
+// loadConditions reads the conditions saved in the file, a missing file is
+// an empty store.
+func loadConditions(path string) (*conditionStore, error) {
+	s := &conditionStore{path: path, conditions: map[conditionKey]savedCondition{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []savedCondition
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for _, c := range list {
+		s.conditions[conditionKey{c.Owner, c.Name}] = c
+	}
+
+	return s, nil
+}
+
+// List returns the conditions saved by the owner ordered by name.
+func (s *conditionStore) List(owner string) []savedCondition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []savedCondition
+	for k, c := range s.conditions {
+		if k.owner == owner {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// Get returns the condition the owner saved under the name.
+func (s *conditionStore) Get(owner, name string) (savedCondition, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.conditions[conditionKey{owner, name}]
+	return c, ok
+}
+
+// Save stores the condition, replacing one its owner saved under the same
+// name.
+func (s *conditionStore) Save(c savedCondition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := conditionKey{c.Owner, c.Name}
+	prev, existed := s.conditions[key]
+	s.conditions[key] = c
+
+	if err := s.write(); err != nil {
+		if existed {
+			s.conditions[key] = prev
+		} else {
+			delete(s.conditions, key)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the condition the owner saved under the name.
+func (s *conditionStore) Delete(owner, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := conditionKey{owner, name}
+	prev, ok := s.conditions[key]
+	if !ok {
+		return nil
+	}
+	delete(s.conditions, key)
+
+	if err := s.write(); err != nil {
+		s.conditions[key] = prev
+		return err
+	}
+
+	return nil
+}
+
+// write saves all conditions to the file.
+func (s *conditionStore) write() error {
+	list := make([]savedCondition, 0, len(s.conditions))
+	for _, c := range s.conditions {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Owner != list[j].Owner {
+			return list[i].Owner < list[j].Owner
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.path, data)
+}
+
+// writeFile replaces the file through a temporary file in the same
+// directory, so a failed write leaves the previous contents intact.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/donseba/go-htmx"
+	"github.com/donseba/goculator"
+)
+
+func TestConditionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conditions.json")
+
+	s, err := loadConditions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []savedCondition{
+		{Owner: "alice", Name: "b", Condition: "x > 1"},
+		{Owner: "alice", Name: "a", Condition: "x > 2", Cases: []goculator.Case{{Variables: map[string]any{"x": 3}, Expect: true}}},
+		{Owner: "alice", Name: "b", Condition: "x > 3"},
+		{Owner: "bob", Name: "a", Condition: "x > 4"},
+	} {
+		if err := s.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete("alice", "missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	// read the file again
+	s, err = loadConditions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := s.List("alice")
+	if len(list) != 2 || list[0].Name != "a" || list[1].Condition != "x > 3" {
+		t.Fatalf("got %+v", list)
+	}
+	if len(list[0].Cases) != 1 {
+		t.Fatalf("the cases of a were not kept: %+v", list[0])
+	}
+
+	tests := []struct {
+		owner, name string
+		want        string
+	}{
+		{owner: "alice", name: "a", want: "x > 2"},
+		{owner: "bob", name: "a", want: "x > 4"},
+		{owner: "bob", name: "b"},
+		{owner: "carol", name: "a"},
+	}
+	for _, tt := range tests {
+		c, ok := s.Get(tt.owner, tt.name)
+		if ok != (tt.want != "") || c.Condition != tt.want {
+			t.Errorf("%s of %s: got %q, want %q", tt.name, tt.owner, c.Condition, tt.want)
+		}
+	}
+
+	// deleting a of bob leaves the one of alice
+	if err := s.Delete("bob", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get("bob", "a"); ok {
+		t.Fatal("a of bob is still saved")
+	}
+	if _, ok := s.Get("alice", "a"); !ok {
+		t.Fatal("a of alice was deleted")
+	}
+}
+
+func TestPlaygroundConditionsBelongToTheSession(t *testing.T) {
+	conditions, err := loadConditions(filepath.Join(t.TempDir(), "conditions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{HTMX: htmx.New(), Conditions: conditions, Store: goculator.NewMemoryStore(goculator.Retention{}), Sessions: newSessionStore(0, 0)}
+	alice, bob := app.Sessions.Add(newSession("alice")), app.Sessions.Add(newSession("bob"))
+
+	request := func(sess *session, method, target string, form url.Values) {
+		r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.ID})
+		r.SetPathValue("name", "adult")
+
+		switch method {
+		case http.MethodPost:
+			app.PlaygroundSave(httptest.NewRecorder(), r)
+		case http.MethodDelete:
+			app.PlaygroundDelete(httptest.NewRecorder(), r)
+		}
+	}
+
+	request(alice, http.MethodPost, "/playground/save", url.Values{"name": {"adult"}, "condition": {"age >= 18"}})
+	// bob saves and deletes a condition of the same name, which is his own
+	request(bob, http.MethodPost, "/playground/save", url.Values{"name": {"adult"}, "condition": {"age >= 21"}})
+	request(bob, http.MethodDelete, "/playground/adult", nil)
+
+	if c, ok := conditions.Get(alice.ID, "adult"); !ok || c.Condition != "age >= 18" {
+		t.Fatalf("the condition of alice is %+v, saved %v", c, ok)
+	}
+	if _, ok := conditions.Get(bob.ID, "adult"); ok {
+		t.Fatal("the condition of bob is still saved")
+	}
+}
+
+func TestReadCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		cases   int
+		wantErr bool
+	}{
+		{
+			name: "matrix",
+			form: url.Values{
+				"condition":   {"x > 1"},
+				"case_name":   {"big", "small"},
+				"case_vars":   {`{"x": 2}`, `{"x": 0}`},
+				"case_expect": {"true", "false"},
+			},
+			cases: 2,
+		},
+		{name: "no condition", form: url.Values{"condition": {" "}}, wantErr: true},
+		{
+			name: "incomplete",
+			form: url.Values{
+				"condition": {"x > 1"},
+				"case_name": {"big", "small"},
+				"case_vars": {`{"x": 2}`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad variables",
+			form: url.Values{
+				"condition":   {"x > 1"},
+				"case_name":   {"big"},
+				"case_vars":   {`{"x":`},
+				"case_expect": {"true"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/playground/run", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			_, cases, err := readCases(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cases) != tt.cases {
+				t.Fatalf("got %d cases, want %d", len(cases), tt.cases)
+			}
+		})
+	}
+}
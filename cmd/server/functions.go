@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/donseba/go-htmx"
+	"github.com/donseba/goculator"
+)
+
+// define adds a function entered in the calculator to the functions of the
+// session, redefining a function replaces it.
+func (a *App) define(ctx context.Context, h *htmx.Handler, sess *session, f *goculator.Function, err error) {
+	if err == nil {
+		err = sess.Functions.Define(f)
+	}
+	if err == nil {
+		err = a.Store.SaveFunction(ctx, sess.ID, f.Name, f.String())
+	}
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	h.TriggerInfo(fmt.Sprintf("defined %s(%s)", f.Name, strings.Join(f.Params, ", ")))
+
+	_, _ = h.Write([]byte(html.EscapeString(f.String())))
+	_, _ = h.Write([]byte(rateDate(nil)))
+	_, _ = h.Write([]byte(traceTree(nil)))
+	_, _ = h.Write([]byte(`<div id="functions" hx-swap-oob="true">` + functionList(sess) + `</div>`))
+}
+
+// assign evaluates the expression of an assignment and binds the variable
+// to its value for the following calculations.
+func (a *App) assign(ctx context.Context, h *htmx.Handler, sess *session, name string, tree *goculator.Tree) {
+	out, err := tree.Evaluate(ctx)
+	if err == nil {
+		err = a.Store.SetVariable(ctx, sess.ID, goculator.Variable{Name: name, Expression: storedExpression(ctx, tree, out)})
+	}
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	sess.SetVariable(name, out)
+	h.TriggerInfo(fmt.Sprintf("%s = %s", name, goculator.Format(out)))
+
+	_, _ = h.Write([]byte(renderResult(out)))
+	_, _ = h.Write([]byte(rateDate(out)))
+	_, _ = h.Write([]byte(traceTree(nil)))
+	_, _ = h.Write([]byte(`<div id="functions" hx-swap-oob="true">` + functionList(sess) + `</div>`))
+}
+
+// storedExpression returns the expression a variable is stored as: its value
+// at full precision when that reads back as the same value, so later changes
+// to the variables it was calculated from do not change it, otherwise the
+// expression entered. Format rounds, it is not used here.
+func storedExpression(ctx context.Context, tree *goculator.Tree, out any) string {
+	if value, ok := literal(out); ok {
+		if back, err := goculator.Evaluate(ctx, value); err == nil && sameValue(back, out) {
+			return value
+		}
+	}
+
+	return strings.TrimSpace(tree.Input)
+}
+
+// literal writes the value as an expression without losing precision, for
+// the kinds of values that have one.
+func literal(v any) (string, bool) {
+	switch v := v.(type) {
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case goculator.Quantity:
+		return strconv.FormatFloat(v.Value, 'g', -1, 64) + " " + v.Unit.String(), true
+	case goculator.Money:
+		return strconv.FormatFloat(v.Amount, 'g', -1, 64) + " " + v.Currency, true
+	}
+
+	return "", false
+}
+
+// sameValue reports whether the values are equal, comparing numbers by value
+// whether they are ints or floats.
+func sameValue(a, b any) bool {
+	switch a := a.(type) {
+	case int:
+		return sameValue(float64(a), b)
+	case float64:
+		switch b := b.(type) {
+		case int:
+			return a == float64(b)
+		case float64:
+			return a == b
+		}
+	case goculator.Quantity:
+		b, ok := b.(goculator.Quantity)
+		return ok && a.Value == b.Value && a.Unit.String() == b.Unit.String()
+	case goculator.Money:
+		b, ok := b.(goculator.Money)
+		return ok && a.Amount == b.Amount && a.Currency == b.Currency
+	}
+
+	return a == b
+}
+
+// Functions renders the list of variables and functions of the session.
+func (a *App) Functions(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	_, _ = h.Write([]byte(functionList(a.session(w, r))))
+}
+
+// RemoveFunction removes a function from the session and renders the
+// updated list.
+func (a *App) RemoveFunction(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	sess := a.session(w, r)
+	name := r.PathValue("name")
+	if sess.Functions.Remove(name) {
+		if err := a.Store.DeleteFunction(r.Context(), sess.ID, name); err != nil {
+			logger(r.Context()).Error("removing function", "function", name, "err", err)
+		}
+		h.TriggerInfo(fmt.Sprintf("removed %s", name))
+	}
+
+	_, _ = h.Write([]byte(functionList(sess)))
+}
+
+// RemoveVariable removes a variable from the session and renders the
+// updated list.
+func (a *App) RemoveVariable(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	sess := a.session(w, r)
+	name := r.PathValue("name")
+	if sess.DeleteVariable(name) {
+		if err := a.Store.DeleteVariable(r.Context(), sess.ID, name); err != nil {
+			logger(r.Context()).Error("removing variable", "variable", name, "err", err)
+		}
+		h.TriggerInfo(fmt.Sprintf("removed %s", name))
+	}
+
+	_, _ = h.Write([]byte(functionList(sess)))
+}
+
+// functionList renders the variables and functions of the session. A
+// function can be loaded into the input for editing, both can be removed.
+func functionList(sess *session) string {
+	vars := sess.Variables()
+	list := sess.Functions.List()
+	if len(vars) == 0 && len(list) == 0 {
+		return ""
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(`<ul class="text-left text-xs font-mono space-y-1">`)
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, `<li class="flex justify-between"><span>%s = %s</span><button type="button" class="text-red-600" hx-delete="/variables/%s" hx-target="#functions">×</button></li>`,
+			html.EscapeString(name), html.EscapeString(goculator.Format(vars[name])), url.PathEscape(name))
+	}
+
+	for _, f := range list {
+		def := html.EscapeString(f.String())
+		fmt.Fprintf(&sb, `<li class="flex justify-between"><span>%s</span><span class="space-x-2"><button type="button" class="text-blue-700" data-definition="%s" _="on click set #calc.value to my @data-definition then call #calc.focus()">edit</button><button type="button" class="text-red-600" hx-delete="/functions/%s" hx-target="#functions">×</button></span></li>`,
+			def, def, url.PathEscape(f.Name))
+	}
+	sb.WriteString(`</ul>`)
+
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/donseba/expronaut"
+	"github.com/donseba/goculator"
+)
+
+func TestStoredExpression(t *testing.T) {
+	ctx := expronaut.SetVariables(context.Background(), map[string]any{"r": 2})
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "1.0 / 3", want: "0.3333333333333333"},
+		{input: "2 ** 60 + 1", want: "1.152921504606847e+18"},
+		{input: "1e-20 * 3", want: "2.9999999999999997e-20"},
+		{input: "r * 1 km / 7", want: "0.2857142857142857 km"},
+		{input: "r > 1", want: "true"},
+		{input: "[1, 2] * r", want: "[1, 2] * r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tree, err := goculator.Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := tree.Evaluate(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := storedExpression(ctx, tree, out)
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+
+			back, err := goculator.Evaluate(ctx, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if goculator.Format(back) != goculator.Format(out) {
+				t.Fatalf("%q reads back as %s, want %s", got, goculator.Format(back), goculator.Format(out))
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/donseba/expronaut"
+	"github.com/donseba/goculator"
+)
+
+type goTemplateRequest struct {
+	Expression string          `json:"expression"`
+	Variables  json.RawMessage `json:"variables"`
+}
+
+type goTemplateResponse struct {
+	Expression string         `json:"expression"`
+	Template   string         `json:"template,omitempty"`
+	Variables  map[string]any `json:"variables,omitempty"`
+
+	// Output is what the template printed, Result the direct evaluation of
+	// the expression. Match reports whether they agree.
+	Output        string `json:"output,omitempty"`
+	TemplateError string `json:"template_error,omitempty"`
+	Result        string `json:"result,omitempty"`
+	ResultError   string `json:"result_error,omitempty"`
+	Match         bool   `json:"match"`
+}
+
+// checkTemplate executes the template against the variables and compares the
+// output with evaluating the expression directly.
+func checkTemplate(ctx context.Context, in, tmpl string, vars map[string]any) goTemplateResponse {
+	res := goTemplateResponse{Expression: in, Template: tmpl, Variables: vars}
+
+	direct, err := goculator.Evaluate(expronaut.SetVariables(ctx, vars), in)
+	if err != nil {
+		res.ResultError = err.Error()
+	} else {
+		res.Result = goculator.Format(direct)
+	}
+
+	res.Output, err = goculator.ExecuteTemplate(ctx, tmpl, vars)
+	if err != nil {
+		res.TemplateError = err.Error()
+	}
+
+	res.Match = res.TemplateError == "" && res.ResultError == "" && sameOutput(direct, res.Output)
+	return res
+}
+
+// sameOutput reports whether the template printed the value, numbers are
+// compared by value as the template prints them with full precision.
+func sameOutput(v any, output string) bool {
+	if fmt.Sprint(v) == output || goculator.Format(v) == output {
+		return true
+	}
+
+	var want float64
+	switch n := v.(type) {
+	case int:
+		want = float64(n)
+	case float64:
+		want = n
+	default:
+		return false
+	}
+
+	got, err := strconv.ParseFloat(output, 64)
+	if err != nil {
+		return false
+	}
+
+	return math.Abs(got-want) <= 1e-9*math.Max(1, math.Abs(want))
+}
+
+// parseVariables decodes the sample variables, whole numbers become ints
+// like integer literals in an expression.
+func parseVariables(data []byte) (map[string]any, error) {
+	vars := map[string]any{}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return vars, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&vars); err != nil {
+		return nil, fmt.Errorf("invalid variables: %w", err)
+	}
+
+	for k, v := range vars {
+		vars[k] = sampleValue(v)
+	}
+
+	return vars, nil
+}
+
+func sampleValue(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := strconv.Atoi(val.String()); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]any:
+		for k, e := range val {
+			val[k] = sampleValue(e)
+		}
+	case []any:
+		for i, e := range val {
+			val[i] = sampleValue(e)
+		}
+	}
+
+	return v
+}
+
+// GoTemplateAPI converts an expression into a Go template and checks it
+// against the sample variables.
+func (a *App) GoTemplateAPI(w http.ResponseWriter, r *http.Request) {
+	var req goTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if strings.TrimSpace(req.Expression) == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("missing expression"))
+		return
+	}
+
+	vars, err := parseVariables(req.Variables)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tmpl, err := goculator.ToGoTemplate(req.Expression)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		var se *goculator.SyntaxError
+		if errors.As(err, &se) {
+			status = http.StatusBadRequest
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+
+	ctx, cancel := a.session(w, r).calcContext(r)
+	defer cancel()
+
+	writeJSON(w, http.StatusOK, checkTemplate(ctx, req.Expression, tmpl, vars))
+}
+
+// GoTemplate renders the "To Go template" panel for the input of the form,
+// checked against the sample variables entered next to it.
+func (a *App) GoTemplate(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	in := r.PostFormValue("calc")
+	if in == "" {
+		h.TriggerError("error: missing input")
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	vars, err := parseVariables([]byte(r.PostFormValue("vars")))
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	tmpl, err := goculator.ToGoTemplate(in)
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	ctx, cancel := a.session(w, r).calcContext(r)
+	defer cancel()
+
+	res := checkTemplate(ctx, in, tmpl, vars)
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, `<div class="text-left text-xs space-y-1"><pre class="font-mono bg-gray-100 rounded p-1 whitespace-pre-wrap select-all">%s</pre>`, html.EscapeString(res.Template))
+	sb.WriteString(templateRow("template", res.Output, res.TemplateError))
+	sb.WriteString(templateRow("direct", res.Result, res.ResultError))
+	if res.Match {
+		sb.WriteString(`<div class="text-green-600">template matches the direct evaluation</div>`)
+	} else {
+		sb.WriteString(`<div class="text-red-600">template differs from the direct evaluation</div>`)
+	}
+	sb.WriteString(`</div>`)
+
+	_, _ = h.Write([]byte(sb.String()))
+}
+
+func templateRow(label, value, err string) string {
+	if err != "" {
+		value = `<span class="text-red-600">` + html.EscapeString(err) + `</span>`
+	} else {
+		value = html.EscapeString(value)
+	}
+
+	return fmt.Sprintf(`<div class="flex justify-between"><span class="text-gray-500">%s</span><span class="font-mono">%s</span></div>`, label, value)
+}
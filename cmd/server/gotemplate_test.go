@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckTemplate(t *testing.T) {
+	tests := []struct {
+		input     string
+		template  string
+		variables string
+		match     bool
+	}{
+		{input: "a * 2 + 1", template: "{{ add (mul .a 2) 1 }}", variables: `{"a": 3}`, match: true},
+		{input: "a / 4", template: "{{ div .a 4 }}", variables: `{"a": 1.5}`, match: true},
+		{input: "a > 1", template: "{{ gt .a 1 }}", variables: `{"a": 1.5}`, match: true},
+		// a template edited by hand that no longer agrees
+		{input: "a + 1", template: "{{ add .a 2 }}", variables: `{"a": 1}`},
+		{input: "a + 1", template: "{{ add .a 1 }}", variables: `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			vars, err := parseVariables([]byte(tt.variables))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := checkTemplate(context.Background(), tt.input, tt.template, vars)
+			if res.Match != tt.match {
+				t.Fatalf("got match %v: %+v", res.Match, res)
+			}
+		})
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]any
+		wantErr bool
+	}{
+		{input: "", want: map[string]any{}},
+		{input: `{"a": 3, "b": 1.5, "c": "x"}`, want: map[string]any{"a": 3, "b": 1.5, "c": "x"}},
+		{input: `[1]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseVariables([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Fatalf("%s: got %v (%T), want %v (%T)", k, got[k], got[k], v, v)
+				}
+			}
+		})
+	}
+}
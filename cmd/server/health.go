@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+// streamTimeout is how long the event stream may go without delivering a
+// message, the clock ticks every second.
+const streamTimeout = 5 * time.Second
+
+// Healthz reports that the server is alive, for liveness probes.
+func (a *App) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// Readyz reports whether the server can take requests: the store answers,
+// the event stream delivers messages and a canary calculation comes out
+// right. A failing check answers 503.
+func (a *App) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := map[string]string{}
+	status := http.StatusOK
+	for name, check := range map[string]func(context.Context) error{
+		"storage":   a.Store.Ping,
+		"sse":       checkStreams,
+		"evaluator": checkEvaluator,
+	} {
+		if err := check(ctx); err != nil {
+			checks[name] = err.Error()
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		checks[name] = "ok"
+	}
+
+	out := map[string]any{"status": "ready", "checks": checks}
+	if status != http.StatusOK {
+		out["status"] = "unavailable"
+		logger(r.Context()).Warn("not ready", "checks", checks)
+	}
+	writeJSON(w, status, out)
+}
+
+// checkStreams fails when the clock stopped sending, or never sent anything
+// in the time it may take after startup.
+func checkStreams(ctx context.Context) error {
+	last := sseManager.LastSent()
+	if last.IsZero() {
+		if time.Since(sseManager.started) > streamTimeout {
+			return fmt.Errorf("no message sent since the start at %s", sseManager.started.Format(time.RFC3339))
+		}
+		return nil
+	}
+	if time.Since(last) > streamTimeout {
+		return fmt.Errorf("no message sent since %s", last.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func checkEvaluator(ctx context.Context) error {
+	out, err := goculator.Evaluate(ctx, "2 * (3 + 4)")
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(out) != "14" {
+		return fmt.Errorf("2 * (3 + 4) gave %v", out)
+	}
+	return nil
+}
+
+// Version reports the version of the server, of the libraries it was built
+// with and the features it runs with.
+func (a *App) Version(w http.ResponseWriter, r *http.Request) {
+	out := map[string]any{
+		"version":  "(unknown)",
+		"features": a.features(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		out["version"] = info.Main.Version
+		out["go"] = info.GoVersion
+
+		deps := map[string]string{}
+		for _, dep := range info.Deps {
+			switch dep.Path {
+			case "github.com/donseba/expronaut", "github.com/donseba/go-htmx":
+				deps[dep.Path] = dep.Version
+				if dep.Replace != nil {
+					deps[dep.Path] = dep.Replace.Path + " " + dep.Replace.Version
+				}
+			}
+		}
+		out["dependencies"] = deps
+
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				out["revision"] = s.Value
+			case "vcs.time":
+				out["revision_time"] = s.Value
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// features lists the optional parts of the server and whether the flags
+// turned them on.
+func (a *App) features() map[string]any {
+	return map[string]any{
+		"accounts":     a.Accounts != nil,
+		"currencies":   a.Rates != nil,
+		"persistence":  *dataFlag != "",
+		"rate_limit":   a.Limiter != nil,
+		"stream_limit": *streamsFlag > 0,
+		"tracing":      *traceFlag,
+		"log_format":   *logFormatFlag,
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckStreams(t *testing.T) {
+	tests := []struct {
+		name    string
+		started time.Time
+		sent    time.Time
+		wantErr bool
+	}{
+		{name: "nothing sent yet", started: time.Now()},
+		{name: "never sent", started: time.Now().Add(-time.Minute), wantErr: true},
+		{name: "sent recently", started: time.Now().Add(-time.Minute), sent: time.Now().Add(-time.Second)},
+		{name: "stopped sending", started: time.Now().Add(-time.Hour), sent: time.Now().Add(-time.Minute), wantErr: true},
+	}
+
+	old := sseManager
+	defer func() { sseManager = old }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sseManager = newStreamManager()
+			sseManager.started, sseManager.sent = tt.started, tt.sent
+
+			err := checkStreams(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckEvaluator(t *testing.T) {
+	if err := checkEvaluator(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
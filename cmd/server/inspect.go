@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/donseba/expronaut"
+	"github.com/donseba/goculator"
+)
+
+// token is a lexer token in the parse API, goculator's own lexer also
+// reports the byte span.
+type token struct {
+	Type    expronaut.TokenType `json:"type"`
+	Literal string              `json:"literal"`
+	Pos     *int                `json:"pos,omitempty"`
+	End     *int                `json:"end,omitempty"`
+}
+
+type parseResponse struct {
+	Expression string `json:"expression"`
+
+	// Tokens is the stream of expronaut's lexer, GoculatorTokens the one
+	// Parse works with. They differ where expronaut reads a minus as the
+	// sign of the number following it.
+	Tokens          []token `json:"tokens"`
+	GoculatorTokens []token `json:"goculator_tokens"`
+
+	Tree  *goculator.Inspection `json:"tree,omitempty"`
+	Error string                `json:"error,omitempty"`
+	Span  *goculator.Span       `json:"span,omitempty"`
+
+	ExpronautTree  *goculator.Inspection `json:"expronaut_tree,omitempty"`
+	ExpronautError string                `json:"expronaut_error,omitempty"`
+}
+
+// inspectExpression lexes and parses the input with both lexers and
+// parsers. A syntax error is part of the response rather than a failure, the
+// tokens are what the error is debugged with.
+func inspectExpression(in string) parseResponse {
+	res := parseResponse{Expression: in}
+
+	for _, t := range goculator.ExpronautTokens(in) {
+		res.Tokens = append(res.Tokens, token{Type: t.Type, Literal: t.Literal})
+	}
+	for _, t := range goculator.Tokenize(in) {
+		res.GoculatorTokens = append(res.GoculatorTokens, token{Type: t.Type, Literal: t.Literal, Pos: &t.Pos, End: &t.End})
+	}
+
+	if tree, err := goculator.Parse(in); err != nil {
+		res.Error = err.Error()
+		var se *goculator.SyntaxError
+		if errors.As(err, &se) {
+			res.Span = &se.Span
+		}
+	} else {
+		res.Tree = tree.Inspect()
+	}
+
+	if node, err := goculator.ExpronautParse(in); err != nil {
+		res.ExpronautError = err.Error()
+	} else {
+		res.ExpronautTree = goculator.Inspect(node)
+	}
+
+	return res
+}
+
+// ParseAPI returns the token streams and parsed trees of an expression.
+func (a *App) ParseAPI(w http.ResponseWriter, r *http.Request) {
+	in, err := readExpression(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, inspectExpression(in))
+}
+
+// Inspect renders the developer panel: the tokens of both lexers and the
+// parsed tree as a collapsible diagram.
+func (a *App) Inspect(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	in := r.PostFormValue("calc")
+	if in == "" {
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	res := inspectExpression(in)
+
+	sb := strings.Builder{}
+	sb.WriteString(`<div class="text-left text-xs font-mono space-y-2">`)
+
+	sb.WriteString(tokenRow("expronaut", res.Tokens))
+	sb.WriteString(tokenRow("goculator", res.GoculatorTokens))
+
+	if res.Error != "" {
+		fmt.Fprintf(&sb, `<div class="text-red-600">%s</div>`, html.EscapeString(res.Error))
+	} else {
+		sb.WriteString(`<ul>`)
+		inspectionTree(&sb, res.Tree, 0)
+		sb.WriteString(`</ul>`)
+	}
+
+	sb.WriteString(`</div>`)
+	_, _ = h.Write([]byte(sb.String()))
+}
+
+// tokenRow renders a token stream as a row of chips, the type above the
+// literal.
+func tokenRow(label string, tokens []token) string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, `<div class="flex flex-wrap items-start gap-1"><span class="text-gray-500 w-20">%s</span>`, label)
+	for _, t := range tokens {
+		fmt.Fprintf(&sb, `<span class="bg-gray-100 rounded px-1 text-center"><span class="block text-gray-400" style="font-size:0.6rem">%s</span>%s</span>`,
+			html.EscapeString(string(t.Type)), html.EscapeString(t.Literal))
+	}
+	sb.WriteString(`</div>`)
+	return sb.String()
+}
+
+// inspectionTree renders a node and its children as nested lists, nodes with
+// children can be collapsed.
+func inspectionTree(sb *strings.Builder, n *goculator.Inspection, depth int) {
+	label := `<span class="text-gray-500">` + html.EscapeString(n.Kind) + `</span>`
+	if n.Operator != "" {
+		label += ` ` + html.EscapeString(n.Operator)
+	}
+	if n.Value != nil {
+		label += ` <span class="text-blue-700">` + html.EscapeString(fmt.Sprint(n.Value)) + `</span>`
+	}
+	if n.Span != nil {
+		label += fmt.Sprintf(` <span class="text-gray-400">[%d:%d]</span>`, n.Span.Pos, n.Span.End)
+	}
+
+	if len(n.Children) == 0 {
+		fmt.Fprintf(sb, `<li class="pl-4">%s</li>`, label)
+		return
+	}
+
+	open := ""
+	if depth < 3 {
+		open = " open"
+	}
+	fmt.Fprintf(sb, `<li class="border-l pl-2"><details%s><summary>%s</summary><ul>`, open, label)
+	for _, c := range n.Children {
+		inspectionTree(sb, c, depth+1)
+	}
+	sb.WriteString(`</ul></details></li>`)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInspectExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		tree     bool
+		span     bool
+		tokens   int
+		goTokens int
+	}{
+		{input: "1 + 2", tree: true, tokens: 4, goTokens: 4},
+		// expronaut reads -2 as a number, Parse as a minus and 2
+		{input: "1-2", tree: true, tokens: 3, goTokens: 4},
+		{input: "1 + (2", span: true, tokens: 5, goTokens: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			res := inspectExpression(tt.input)
+			if (res.Tree != nil) != tt.tree {
+				t.Fatalf("got tree %v, error %q", res.Tree, res.Error)
+			}
+			if (res.Span != nil) != tt.span {
+				t.Fatalf("got span %v", res.Span)
+			}
+			if len(res.Tokens) != tt.tokens || len(res.GoculatorTokens) != tt.goTokens {
+				t.Fatalf("got %d and %d tokens, want %d and %d", len(res.Tokens), len(res.GoculatorTokens), tt.tokens, tt.goTokens)
+			}
+		})
+	}
+}
+
+func TestParseAPI(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{body: `{"expression": "sqrt(16)"}`, status: http.StatusOK},
+		// a syntax error is part of the answer
+		{body: `{"expression": "sqrt(16"}`, status: http.StatusOK},
+		{body: `{"expression": ""}`, status: http.StatusBadRequest},
+		{body: `{`, status: http.StatusBadRequest},
+	}
+
+	app := &App{}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.ParseAPI(w, httptest.NewRequest(http.MethodPost, "/api/v1/parse", strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !json.Valid(w.Body.Bytes()) {
+				t.Fatalf("not JSON: %s", w.Body)
+			}
+		})
+	}
+}
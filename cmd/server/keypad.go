@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// keypadSetting is the setting of the store the mode of a session is kept
+// in.
+const keypadSetting = "keypad"
+
+// keypadKey is a button of a keypad, pressing it adds Insert to the input.
+type keypadKey struct {
+	Label  string `json:"label"`
+	Insert string `json:"insert"`
+	// Color is the tailwind color of the button, gray when empty.
+	Color string `json:"color,omitempty"`
+}
+
+// keypad is a mode of the calculator: the buttons shown next to the digits,
+// in rows of four.
+type keypad struct {
+	Name string        `json:"name"`
+	Rows [][]keypadKey `json:"rows"`
+}
+
+// defaultKeypads are the modes of the calculator, the first is the one a
+// session starts in.
+var defaultKeypads = []keypad{
+	{Name: "basic", Rows: [][]keypadKey{
+		{{"x²", "**2", "blue"}, {"xʸ", "**", "blue"}, {"√", "sqrt(", "blue"}, {"1/x", "1/", "blue"}},
+		{{"ceil", "ceil(", "yellow"}, {"floor", "floor(", "yellow"}, {"round", "round(", "yellow"}, {"abs", "abs(", "yellow"}},
+	}},
+	{Name: "scientific", Rows: [][]keypadKey{
+		{{"cos", "cos(", "red"}, {"sin", "sin(", "red"}, {"tan", "tan(", "red"}, {"deg→rad", "deg2rad(", "gray"}},
+		{{"acos", "acos(", "red"}, {"asin", "asin(", "red"}, {"atan", "atan(", "red"}, {"rad→deg", "rad2deg(", "gray"}},
+		{{"sinh", "sinh(", "red"}, {"cosh", "cosh(", "red"}, {"tanh", "tanh(", "red"}, {"hypot", "hypot(", "gray"}},
+		{{"ln", "ln(", "green"}, {"log", "log(", "green"}, {"log10", "log10(", "green"}, {"exp", "exp(", "green"}},
+		{{"pow", "pow(", "blue"}, {"√", "sqrt(", "blue"}, {"ⁿ√", "root(", "blue"}, {"abs", "abs(", "blue"}},
+	}},
+	{Name: "programmer", Rows: [][]keypadKey{
+		{{"<<", "<<", "pink"}, {">>", ">>", "pink"}, {"÷ int", "//", "pink"}, {"mod", "%", "pink"}},
+		{{"==", "==", "purple"}, {"!=", "!=", "purple"}, {"<", "<", "purple"}, {">", ">", "purple"}},
+		{{"&&", "&&", "indigo"}, {"||", "||", "indigo"}, {"true", "true", "indigo"}, {"false", "false", "indigo"}},
+	}},
+	{Name: "statistics", Rows: [][]keypadKey{
+		{{"sum", "sum(", "green"}, {"mean", "mean(", "green"}, {"median", "median(", "green"}, {"mode", "mode(", "green"}},
+		{{"min", "min(", "green"}, {"max", "max(", "green"}, {"σ", "stddev(", "green"}, {"σ²", "variance(", "green"}},
+		{{"[", "[", "gray"}, {"]", "]", "gray"}, {",", ",", "gray"}, {"len", "len(", "gray"}},
+		{{"sort", "sort(", "yellow"}, {"unique", "unique(", "yellow"}, {"reverse", "reverse(", "yellow"}, {"slice", "slice(", "yellow"}},
+	}},
+}
+
+// loadKeypads returns the default keypads together with those in the JSON
+// file at path, a list of keypads. A keypad of the same name as a default
+// one replaces it, others are added as modes of their own.
+func loadKeypads(path string) ([]keypad, error) {
+	keypads := slices.Clone(defaultKeypads)
+	if path == "" {
+		return keypads, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var custom []keypad
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for _, k := range custom {
+		if k.Name == "" {
+			return nil, fmt.Errorf("reading %s: keypad without a name", path)
+		}
+		for _, row := range k.Rows {
+			for i := range row {
+				if row[i].Color == "" {
+					row[i].Color = "gray"
+				}
+			}
+		}
+
+		if i := slices.IndexFunc(keypads, func(d keypad) bool { return d.Name == k.Name }); i >= 0 {
+			keypads[i] = k
+		} else {
+			keypads = append(keypads, k)
+		}
+	}
+
+	return keypads, nil
+}
+
+// keypadPage is what keypad.html renders: the names of the modes to switch
+// between and the keypad of the current one.
+type keypadPage struct {
+	Modes   []string
+	Current keypad
+}
+
+// Keypad renders the keypad of the mode the session is in.
+func (a *App) Keypad(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+
+	k, ok := a.keypad(sess.Keypad())
+	if !ok {
+		// the mode was removed from the configuration since it was chosen
+		k = a.Keypads[0]
+	}
+	a.renderKeypad(w, k)
+}
+
+// SetKeypad switches the session to another mode and renders its keypad.
+// The mode is kept in the store, so it is restored with the session.
+func (a *App) SetKeypad(w http.ResponseWriter, r *http.Request) {
+	k, ok := a.keypad(r.PathValue("mode"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sess := a.session(w, r)
+	sess.SetKeypad(k.Name)
+	if err := a.Store.SetSetting(r.Context(), sess.ID, keypadSetting, k.Name); err != nil {
+		logger(r.Context()).Error("saving the keypad of a session", "err", err)
+	}
+	a.renderKeypad(w, k)
+}
+
+// keypad returns the keypad of the mode.
+func (a *App) keypad(mode string) (keypad, bool) {
+	i := slices.IndexFunc(a.Keypads, func(k keypad) bool { return k.Name == mode })
+	if i < 0 {
+		return keypad{}, false
+	}
+	return a.Keypads[i], true
+}
+
+func (a *App) renderKeypad(w http.ResponseWriter, k keypad) {
+	tmpl, err := template.ParseFiles("keypad.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := keypadPage{Current: k}
+	for _, k := range a.Keypads {
+		page.Modes = append(page.Modes, k.Name)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
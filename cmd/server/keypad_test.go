@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/donseba/go-htmx"
+	"github.com/donseba/goculator"
+)
+
+func TestKeypadIsRestoredWithTheSession(t *testing.T) {
+	store := goculator.NewMemoryStore(goculator.Retention{})
+	app := &App{HTMX: htmx.New(), Store: store, Sessions: newSessionStore(0, 0), Keypads: defaultKeypads}
+
+	r := httptest.NewRequest(http.MethodPost, "/keypad/programmer", nil)
+	r.SetPathValue("mode", "programmer")
+	w := httptest.NewRecorder()
+	app.SetKeypad(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var id string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie {
+			id = c.Value
+		}
+	}
+	if id == "" {
+		t.Fatal("no session cookie")
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want string
+		ok   bool
+	}{
+		{name: "only a keypad chosen", id: id, want: "programmer", ok: true},
+		{name: "nothing stored", id: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a new server, with nothing in memory
+			sess, ok := app.restoreSession(context.Background(), tt.id)
+			if ok != tt.ok {
+				t.Fatalf("restored: got %v, want %v", ok, tt.ok)
+			}
+			if ok && sess.Keypad() != tt.want {
+				t.Fatalf("got keypad %q, want %q", sess.Keypad(), tt.want)
+			}
+		})
+	}
+}
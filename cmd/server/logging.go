@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+// newLogger returns the logger of the server, writing text or JSON lines of
+// the level and above.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level: %w", err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+
+	return nil, fmt.Errorf("log format %q: expected text or json", format)
+}
+
+type loggerKey struct{}
+
+// logger returns the logger of the request ctx belongs to, which adds the
+// request id to every record.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// accessLog gives every request an id, taken from the X-Request-ID header
+// when the client sent one, and logs the request once it is done.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = newSessionID()[:16]
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		l := slog.Default().With("request_id", id)
+		if trace := traceID(r.Context()); trace != "" {
+			l = l.With("trace_id", trace)
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), loggerKey{}, l)))
+
+		l.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+			slog.Bool("htmx", r.Header.Get("HX-Request") == "true"),
+		)
+	})
+}
+
+// statusRecorder remembers the status and size of a response. It passes
+// flushes on, the event stream depends on them.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// evaluated records a calculation in the metrics and the log. The log
+// carries a hash of the expression rather than the expression itself, it
+// may hold private numbers, unless the server runs with -log-expressions.
+func (a *App) evaluated(ctx context.Context, in string, out any, d time.Duration, err error) {
+	a.Stats.Evaluation(d, err)
+
+	attrs := []slog.Attr{slog.Duration("duration", d)}
+	switch *logExpressionsFlag {
+	case "plain":
+		attrs = append(attrs, slog.String("expression", in))
+	case "redact":
+		attrs = append(attrs, slog.Int("expression_length", len(in)))
+	default:
+		sum := sha256.Sum256([]byte(in))
+		attrs = append(attrs, slog.String("expression_hash", hex.EncodeToString(sum[:8])))
+	}
+
+	if err != nil {
+		// error messages quote names and values of the expression
+		attrs = append(attrs, slog.String("error_class", errorClass(err)))
+		if *logExpressionsFlag == "plain" {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		logger(ctx).LogAttrs(ctx, slog.LevelInfo, "evaluation failed", attrs...)
+		return
+	}
+
+	attrs = append(attrs, slog.String("result_type", goculator.Kind(out)))
+	logger(ctx).LogAttrs(ctx, slog.LevelInfo, "evaluation", attrs...)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		level, format string
+		wantErr       bool
+	}{
+		{level: "info", format: "text"},
+		{level: "debug", format: "json"},
+		{level: "loud", format: "text", wantErr: true},
+		{level: "info", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level+" "+tt.format, func(t *testing.T) {
+			_, err := newLogger(&bytes.Buffer{}, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+		})
+	}
+}
+
+// captureLog makes the default logger write JSON records to the returned
+// buffer for the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// records decodes the JSON records written to the buffer.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "sent by the client", header: "abc-123", keep: true},
+		{name: "missing"},
+		{name: "too long", header: strings.Repeat("x", 65)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+
+			handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logger(r.Context()).Info("inside")
+				w.WriteHeader(http.StatusTeapot)
+				_, _ = w.Write([]byte("tea"))
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/pot", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get("X-Request-ID")
+			if tt.keep && id != tt.header || !tt.keep && (id == "" || id == tt.header) {
+				t.Fatalf("got request id %q", id)
+			}
+
+			recs := records(t, buf)
+			if len(recs) != 2 {
+				t.Fatalf("got %d records, want 2", len(recs))
+			}
+			for _, rec := range recs {
+				if rec["request_id"] != id {
+					t.Fatalf("record without the request id: %v", rec)
+				}
+			}
+			if access := recs[1]; access["status"] != float64(http.StatusTeapot) || access["bytes"] != float64(3) || access["path"] != "/pot" {
+				t.Fatalf("got %v", access)
+			}
+		})
+	}
+}
+
+func TestEvaluatedLogsExpressions(t *testing.T) {
+	const expression = "salary * 12"
+
+	tests := []struct {
+		mode    string
+		err     error
+		present []string
+		absent  []string
+	}{
+		{mode: "hash", present: []string{"expression_hash", "result_type"}, absent: []string{expression}},
+		{mode: "redact", present: []string{"expression_length"}, absent: []string{expression}},
+		{mode: "plain", present: []string{expression}},
+		{mode: "hash", err: goculator.ErrUndefinedVariable, present: []string{"undefined_variable"}, absent: []string{expression, "undefined variable"}},
+		{mode: "plain", err: errors.New("salary is secret"), present: []string{"salary is secret"}},
+	}
+
+	prev := *logExpressionsFlag
+	t.Cleanup(func() { *logExpressionsFlag = prev })
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			*logExpressionsFlag = tt.mode
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), loggerKey{}, slog.New(slog.NewJSONHandler(&buf, nil)))
+
+			app := &App{Stats: newMetrics()}
+			app.evaluated(ctx, expression, 42, time.Millisecond, tt.err)
+
+			for _, s := range tt.present {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("%q missing from %s", s, buf.String())
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("%q logged in %s", s, buf.String())
+				}
+			}
+		})
+	}
+}
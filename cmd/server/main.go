@@ -1,30 +1,160 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/donseba/expronaut"
 	"github.com/donseba/go-htmx"
 	"github.com/donseba/go-htmx/sse"
+	"github.com/donseba/goculator"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 )
 
 type App struct {
-	HTMX *htmx.HTMX
+	HTMX       *htmx.HTMX
+	Store      goculator.Store
+	Conditions *conditionStore
+	Sessions   *sessionStore
+
+	// Rates is nil when currency conversion is disabled.
+	Rates goculator.RateSource
+
+	// Accounts is nil when accounts are disabled and anyone can use the
+	// calculator and the API.
+	Accounts *accountStore
+
+	// Limiter limits the calculations of every client, nil for no limit.
+	// Streams limits the event streams they hold open, and LoginLimiter
+	// their attempts to log in.
+	Limiter      *rateLimiter
+	Streams      *connLimiter
+	LoginLimiter *rateLimiter
+
+	Stats *metrics
+
+	// Keypads are the modes of the calculator, the first is the default.
+	Keypads []keypad
 }
 
 var (
-	sseManager sse.Manager
+	sseManager *streamManager
+
+	ratesFlag          = flag.String("rates", "rates.json", "exchange rates: a JSON or CSV file, or an http(s) URL serving the JSON format")
+	timeoutFlag        = flag.Duration("timeout", 10*time.Second, "maximum duration of a single calculation")
+	conditionsFlag     = flag.String("conditions", "conditions.json", "file the conditions saved in the playground are kept in")
+	dataFlag           = flag.String("data", "goculator.json", "file history, variables, functions and worksheets are kept in, empty to keep them in memory")
+	historyFlag        = flag.Int("history", 1000, "number of calculations kept in the history of a session, 0 for all")
+	historyAgeFlag     = flag.Duration("history-age", 30*24*time.Hour, "age after which calculations are removed from the history, 0 to keep them")
+	shareAgeFlag       = flag.Duration("share-age", 365*24*time.Hour, "age after which shared calculations are removed, 0 to keep them")
+	sessionsFlag       = flag.Int("sessions", 10000, "sessions kept in memory, beyond that the least recently used are dropped and restored from the store when used again")
+	sessionTTLFlag     = flag.Duration("session-ttl", time.Hour, "time a session is kept in memory after its last request")
+	rateFlag           = flag.Float64("rate", 5, "calculations per second allowed to every IP address or API key, 0 for no limit")
+	burstFlag          = flag.Int("burst", 20, "calculations a client may make at once before the rate applies")
+	streamsFlag        = flag.Int("streams", 4, "event streams every IP address may hold open, 0 for no limit")
+	logLevelFlag       = flag.String("log-level", "info", "lowest level logged: debug, info, warn or error")
+	logFormatFlag      = flag.String("log-format", "text", "format of the log: text or json")
+	logExpressionsFlag = flag.String("log-expressions", "hash", "how expressions are logged: hash, redact to log only their length, or plain")
+	traceFlag          = flag.String("trace", "", "export tracing spans: stdout, or otlp to send them to an OpenTelemetry collector")
+	otlpEndpointFlag   = flag.String("otlp-endpoint", otlpEndpoint(), "base URL of the OTLP/HTTP collector the spans are sent to")
+	keypadsFlag        = flag.String("keypads", "", "JSON file with keypads added to the basic, scientific, programmer and statistics modes, or replacing one of the same name")
+	accountsFlag       = flag.String("accounts", "", "file users and their API keys are kept in, when set users must log in and the API requires a key")
+	adminFlag          = flag.String("admin", os.Getenv("GOCULATOR_ADMIN"), "administrator created when the accounts file has no users yet, with the password in GOCULATOR_ADMIN_PASSWORD")
 )
 
 func main() {
+	flag.Parse()
+
+	logger, err := newLogger(os.Stderr, *logLevelFlag, *logFormatFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	if *logExpressionsFlag != "hash" && *logExpressionsFlag != "redact" && *logExpressionsFlag != "plain" {
+		log.Fatalf("log expressions %q: expected hash, redact or plain", *logExpressionsFlag)
+	}
+
+	stats := newMetrics()
+	goculator.SetCallObserver(stats.Call)
+
+	src, err := newRateSource(*ratesFlag)
+	if err != nil {
+		slog.Warn("currency conversion disabled", "err", err)
+	} else {
+		goculator.SetRateSource(src)
+		if hs, ok := src.(*goculator.HTTPSource); ok {
+			stats.Cache("rates", hs.CacheStats)
+		}
+	}
+
+	conditions, err := loadConditions(*conditionsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keypads, err := loadKeypads(*keypadsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := newStore(*dataFlag, goculator.Retention{MaxEntries: *historyFlag, MaxAge: *historyAgeFlag, ShareAge: *shareAgeFlag})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := store.Prune(context.Background()); err != nil {
+				slog.Error("pruning history and shares", "err", err)
+			}
+		}
+	}()
+
 	app := App{
-		HTMX: htmx.New(),
+		HTMX:       htmx.New(),
+		Store:      store,
+		Conditions: conditions,
+		Sessions:   newSessionStore(*sessionsFlag, *sessionTTLFlag),
+		Rates:      src,
+		Streams:    newConnLimiter(*streamsFlag),
+		Stats:      stats,
+		Keypads:    keypads,
+	}
+	stats.Cache("sessions", app.Sessions.CacheStats)
+
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			app.Sessions.Expire(now)
+		}
+	}()
+
+	// *slog.Logger is an htmx.Logger, the library logs to the same stream
+	app.HTMX.SetLog(logger.With("component", "htmx"))
+	if *rateFlag > 0 {
+		app.Limiter = newRateLimiter(*rateFlag, *burstFlag)
+	}
+
+	if *accountsFlag != "" {
+		app.Accounts, err = loadAccounts(*accountsFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := bootstrapAdmin(app.Accounts, *adminFlag, os.Getenv("GOCULATOR_ADMIN_PASSWORD")); err != nil {
+			log.Fatalf("accounts %s: %v", *accountsFlag, err)
+		}
+		app.LoginLimiter = newRateLimiter(loginRate, loginBurst)
 	}
 
-	sseManager = sse.NewManager(5)
+	sseManager = newStreamManager()
 
 	go func() {
 		for {
@@ -34,21 +164,126 @@ func main() {
 	}()
 
 	mux := http.NewServeMux()
-	mux.Handle("GET /", http.HandlerFunc(app.Home))
-	mux.Handle("POST /calc", http.HandlerFunc(app.Calc))
-	mux.Handle("GET /sse", http.HandlerFunc(app.SSE))
+	mux.Handle("GET /", app.requireLogin(app.Home))
+	mux.Handle("POST /calc", app.requireLogin(app.limit(app.Calc)))
+	mux.Handle("POST /preview", app.requireLogin(app.limit(app.Preview)))
+	mux.Handle("GET /keypad", app.requireLogin(app.Keypad))
+	mux.Handle("POST /keypad/{mode}", app.requireLogin(app.SetKeypad))
+	mux.Handle("GET /sse", app.requireLogin(app.SSE))
+	mux.Handle("POST /api/v1/explain", app.requireKey("explain", app.limit(app.ExplainAPI)))
+	mux.Handle("POST /api/v1/parse", app.requireKey("parse", app.ParseAPI))
+	mux.Handle("GET /api/v1/functions", app.requireKeyOrLogin("functions", app.FunctionsAPI))
+	mux.Handle("POST /api/v1/gotemplate", app.requireKey("gotemplate", app.limit(app.GoTemplateAPI)))
+	mux.Handle("POST /symbolic", app.requireLogin(app.limit(app.Symbolic)))
+	mux.Handle("GET /plot", app.requireLogin(app.limit(app.Plot)))
+	mux.Handle("GET /plot.svg", app.requireLogin(app.limit(app.PlotSVG)))
+	mux.Handle("POST /inspect", app.requireLogin(app.Inspect))
+	mux.Handle("POST /gotemplate", app.requireLogin(app.limit(app.GoTemplate)))
+	mux.Handle("GET /playground", app.requireLogin(app.Playground))
+	mux.Handle("POST /playground/run", app.requireLogin(app.limit(app.PlaygroundRun)))
+	mux.Handle("POST /playground/save", app.requireLogin(app.PlaygroundSave))
+	mux.Handle("DELETE /playground/{name}", app.requireLogin(app.PlaygroundDelete))
+	mux.Handle("GET /functions", app.requireLogin(app.Functions))
+	mux.Handle("DELETE /functions/{name}", app.requireLogin(app.RemoveFunction))
+	mux.Handle("DELETE /variables/{name}", app.requireLogin(app.RemoveVariable))
+	mux.Handle("GET /worksheets", app.requireLogin(app.Worksheets))
+	mux.Handle("POST /worksheets", app.requireLogin(app.CreateWorksheet))
+	mux.Handle("POST /worksheets/calc", app.requireLogin(app.limit(app.SheetCalc)))
+	mux.Handle("POST /worksheets/rows", app.requireLogin(app.limit(app.SheetRows)))
+	mux.Handle("GET /worksheets/{id}", app.requireLogin(app.Worksheets))
+	mux.Handle("POST /worksheets/{id}", app.requireLogin(app.SaveWorksheet))
+	mux.Handle("DELETE /worksheets/{id}", app.requireLogin(app.DeleteWorksheet))
+	mux.Handle("POST /worksheets/{id}/share", app.requireLogin(app.ShareWorksheet))
+	mux.Handle("GET /w/{id}", app.limit(app.SharedWorksheet))
+	mux.Handle("POST /w/{id}/copy", app.requireLogin(app.CreateWorksheet))
+	mux.Handle("POST /share", app.requireLogin(app.limit(app.Share)))
+	mux.Handle("GET /s/{id}", http.HandlerFunc(app.SharedCalculation))
+	mux.Handle("POST /s/{id}/fork", app.requireLogin(app.ForkShare))
+	mux.Handle("GET /complete", app.requireLogin(app.Complete))
+	mux.Handle("GET /history", app.requireLogin(app.History))
+	mux.Handle("GET /account", app.requireLogin(app.Account))
+	mux.Handle("GET /metrics", http.HandlerFunc(app.Metrics))
+	mux.Handle("GET /healthz", http.HandlerFunc(app.Healthz))
+	mux.Handle("GET /readyz", http.HandlerFunc(app.Readyz))
+	mux.Handle("GET /version", http.HandlerFunc(app.Version))
 
-	err := http.ListenAndServe(":4321", mux)
+	if app.Accounts != nil {
+		mux.Handle("GET /login", http.HandlerFunc(app.Login))
+		mux.Handle("POST /login", app.limitLogin(app.LoginSubmit))
+		mux.Handle("POST /logout", http.HandlerFunc(app.Logout))
+		mux.Handle("GET /admin", app.requireLogin(app.Admin))
+		mux.Handle("POST /admin/keys", app.requireLogin(app.CreateKey))
+		mux.Handle("DELETE /admin/keys/{id}", app.requireLogin(app.RevokeKey))
+		mux.Handle("POST /admin/users", app.requireAdmin(app.CreateUser))
+		mux.Handle("DELETE /admin/users/{name}", app.requireAdmin(app.DeleteUser))
+	}
+
+	handler := accessLog(mux)
+	switch *traceFlag {
+	case "":
+	case "stdout":
+		handler = useTracer(&stdoutExporter{w: os.Stdout}, handler, stats)
+	case "otlp":
+		handler = useTracer(&otlpExporter{Endpoint: *otlpEndpointFlag, Service: "goculator"}, handler, stats)
+	default:
+		log.Fatalf("trace %q: expected stdout or otlp", *traceFlag)
+	}
+
+	slog.Info("listening", "addr", ":4321")
+	err = http.ListenAndServe(":4321", handler)
 	log.Fatal(err)
 }
 
+// otlpEndpoint returns the collector set in the environment, as the
+// OpenTelemetry SDKs read it, or the default of a local collector.
+func otlpEndpoint() string {
+	if e := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); e != "" {
+		return e
+	}
+	return "http://localhost:4318"
+}
+
+// useTracer records spans of the requests served by the handler, and of the
+// calculations they make, with the exporter. The spans dropped are counted
+// in the metrics.
+func useTracer(e exporter, handler http.Handler, stats *metrics) http.Handler {
+	t := newTracer(e)
+	goculator.SetInstrument(t)
+	stats.Tracer(t.Dropped)
+	return t.middleware(handler)
+}
+
+func newRateSource(spec string) (goculator.RateSource, error) {
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return &goculator.HTTPSource{URL: spec, TTL: time.Hour}, nil
+	}
+
+	fs, err := goculator.NewFileSource(spec)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func newStore(path string, retention goculator.Retention) (goculator.Store, error) {
+	if path == "" {
+		return goculator.NewMemoryStore(retention), nil
+	}
+
+	return goculator.NewFileStore(path, retention)
+}
+
 func (a *App) Home(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "index.html")
 }
 
 func (a *App) Calc(w http.ResponseWriter, r *http.Request) {
 
-	ctx := r.Context()
+	// long running calculations such as integrate or sum_series stop when
+	// the request is cancelled or takes too long
+	sess := a.session(w, r)
+	ctx, cancel := sess.calcContext(r)
+	defer cancel()
 
 	h := a.HTMX.NewHandler(w, r)
 
@@ -59,26 +294,99 @@ func (a *App) Calc(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// input such as "f(x) = x**2" defines a function, "r = 2 km" a variable
+	if f, err := goculator.ParseDefinition(in); !errors.Is(err, goculator.ErrNotDefinition) {
+		a.define(r.Context(), h, sess, f, err)
+		return
+	}
+	if name, tree, err := goculator.ParseAssignment(in); !errors.Is(err, goculator.ErrNotAssignment) {
+		if err != nil {
+			h.TriggerError(fmt.Sprintf("error: %v", err))
+			_, _ = h.Write([]byte{})
+			return
+		}
+		a.assign(ctx, h, sess, name, tree)
+		return
+	}
+
 	ti := time.Now()
-	// do some calculation
-	out, err := expronaut.Evaluate(ctx, in)
+	// do some calculation, recording the steps in explain mode
+	var (
+		out   any
+		err   error
+		steps []goculator.Step
+	)
+	if r.PostFormValue("explain") != "" {
+		out, steps, err = goculator.Explain(ctx, in)
+	} else {
+		out, err = goculator.Evaluate(ctx, in)
+	}
+	calcTime := time.Since(ti)
+	a.evaluated(r.Context(), in, out, calcTime, err)
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("calculation took longer than %s", *timeoutFlag)
+	}
+	a.record(r.Context(), sess, in, out, err)
 	if err != nil {
+		// a failed function returns a zero value, which is no result
 		h.TriggerError(fmt.Sprintf("error: %v", err))
-		_, _ = h.Write([]byte(fmt.Sprint(out)))
+		_, _ = h.Write([]byte(rateDate(nil)))
+		_, _ = h.Write([]byte(traceTree(steps)))
 		return
 	}
 
-	calcTime := time.Since(ti).Microseconds()
+	h.TriggerInfo(fmt.Sprintf("calculation took %d us", calcTime.Microseconds()))
+	// the address bar links to the calculation, replacing a shared one
+	h.PushURL("/?calc=" + url.QueryEscape(in))
+
+	_, _ = h.Write([]byte(renderResult(out)))
+	_, _ = h.Write([]byte(rateDate(out)))
+	_, _ = h.Write([]byte(graphPanel(out)))
+	_, _ = h.Write([]byte(traceTree(steps)))
+}
+
+// record adds the calculation to the history of the session.
+func (a *App) record(ctx context.Context, sess *session, in string, out any, err error) {
+	entry := goculator.HistoryEntry{Expression: in, Time: time.Now()}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Result = goculator.Format(out)
+	}
+
+	if err := a.Store.AddHistory(ctx, sess.ID, entry); err != nil {
+		logger(ctx).Error("recording history", "err", err)
+	}
+}
 
-	h.TriggerInfo(fmt.Sprintf("calculation took %d us", calcTime))
+// rateDate renders the out-of-band swap showing the date of the exchange
+// rates next to a converted amount, and clears it for any other result.
+func rateDate(out any) string {
+	m, ok := out.(goculator.Money)
+	if !ok || m.AsOf.IsZero() {
+		return `<div id="rate-date" hx-swap-oob="true"></div>`
+	}
 
-	_, _ = h.Write([]byte(fmt.Sprint(out)))
+	return fmt.Sprintf(`<div id="rate-date" hx-swap-oob="true">rates as of %s</div>`, m.AsOf.Format(time.DateTime))
 }
 
 func (a *App) SSE(w http.ResponseWriter, r *http.Request) {
+	// every stream holds a buffered channel, a client can not open many
+	client := clientID(r)
+	if !a.Streams.Acquire(client) {
+		http.Error(w, "too many open event streams", http.StatusTooManyRequests)
+		return
+	}
+	defer a.Streams.Release(client)
+
 	cl := sse.NewClient(randStringRunes(10))
+	l := logger(r.Context()).With("client", cl.ID())
+	l.Info("sse connected")
 
+	start := time.Now()
 	sseManager.Handle(w, r, cl)
+	l.Info("sse disconnected", "duration", time.Since(start))
 }
 
 var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
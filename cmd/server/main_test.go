@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/donseba/go-htmx"
+	"github.com/donseba/goculator"
+)
+
+func TestCalc(t *testing.T) {
+	app := &App{HTMX: htmx.New(), Store: goculator.NewMemoryStore(goculator.Retention{}), Sessions: newSessionStore(0, 0), Stats: newMetrics()}
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "1 + 2", want: renderResult(3)},
+		// failing functions return a zero Matrix, Solution or Estimate
+		{input: "inv([[1, 2], [2, 4]])", wantErr: true},
+		{input: "solve(x == x + 1, x, 0)", wantErr: true},
+		{input: "integrate(1/x, x, 0, 1)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/calc", strings.NewReader(url.Values{"calc": {tt.input}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("HX-Request", "true")
+			w := httptest.NewRecorder()
+			app.Calc(w, r)
+
+			trigger := w.Header().Get("HX-Trigger")
+			if tt.wantErr {
+				if !strings.Contains(trigger, "error") {
+					t.Fatalf("got trigger %q, want an error", trigger)
+				}
+				if got, want := w.Body.String(), rateDate(nil)+traceTree(nil); got != want {
+					t.Fatalf("got %q, want only %q", got, want)
+				}
+				return
+			}
+			if !strings.HasPrefix(w.Body.String(), tt.want) {
+				t.Fatalf("got %q, want it to start with %q", w.Body, tt.want)
+			}
+		})
+	}
+}
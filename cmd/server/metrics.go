@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donseba/go-htmx/sse"
+	"github.com/donseba/goculator"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the evaluation latency
+// histogram.
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics collects what /metrics reports. There is no client library, the
+// Prometheus text format is written by hand.
+type metrics struct {
+	mu sync.Mutex
+
+	evaluations map[string]uint64 // by outcome
+	errors      map[string]uint64 // by class
+	calls       map[[2]string]uint64
+
+	latencyCounts []uint64 // per bucket, not cumulative
+	latencySum    float64
+	latencyCount  uint64
+
+	// caches report their hits and misses
+	caches map[string]func() (hits, misses uint64)
+	// droppedSpans reports the spans the tracer dropped, nil when not
+	// tracing
+	droppedSpans func() uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		evaluations:   map[string]uint64{},
+		errors:        map[string]uint64{},
+		calls:         map[[2]string]uint64{},
+		latencyCounts: make([]uint64, len(latencyBuckets)+1),
+		caches:        map[string]func() (uint64, uint64){},
+	}
+}
+
+// Evaluation records a calculation, how long it took and how it ended.
+func (m *metrics) Evaluation(d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	outcome := "ok"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		outcome = "timeout"
+	case err != nil:
+		outcome = "error"
+	}
+	m.evaluations[outcome]++
+	if err != nil {
+		m.errors[errorClass(err)]++
+	}
+
+	s := d.Seconds()
+	i, _ := slices.BinarySearch(latencyBuckets, s)
+	m.latencyCounts[i]++
+	m.latencySum += s
+	m.latencyCount++
+}
+
+// Call records a call of a builtin function, set as the call observer of
+// goculator.
+func (m *metrics) Call(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.calls[[2]string{name, outcome}]++
+}
+
+// Cache adds a cache to the hit ratios reported.
+func (m *metrics) Cache(name string, stats func() (hits, misses uint64)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.caches[name] = stats
+}
+
+// Tracer adds the spans the tracer dropped to the metrics.
+func (m *metrics) Tracer(dropped func() uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.droppedSpans = dropped
+}
+
+// errorClass names the kind of a failed calculation.
+func errorClass(err error) string {
+	var se *goculator.SyntaxError
+	switch {
+	case errors.As(err, &se):
+		return "syntax"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, goculator.ErrUndefinedVariable):
+		return "undefined_variable"
+	case errors.Is(err, goculator.ErrUnknownFunction):
+		return "unknown_function"
+	case errors.Is(err, goculator.ErrNotAllowed):
+		return "not_allowed"
+	case errors.Is(err, goculator.ErrDivisionByZero):
+		return "division_by_zero"
+	case errors.Is(err, goculator.ErrTypeMismatch):
+		return "type_mismatch"
+	case errors.Is(err, goculator.ErrDimensionMismatch):
+		return "dimension_mismatch"
+	case errors.Is(err, goculator.ErrShapeMismatch):
+		return "shape_mismatch"
+	case errors.Is(err, goculator.ErrNoRates):
+		return "no_rates"
+	case errors.Is(err, goculator.ErrNoConvergence):
+		return "no_convergence"
+	case errors.Is(err, goculator.ErrNotCondition):
+		return "not_condition"
+	case errors.Is(err, goculator.ErrUnsupported):
+		return "unsupported"
+	}
+
+	return "other"
+}
+
+// snapshot copies the counters, so they can be written without holding the
+// lock.
+func (m *metrics) snapshot() *metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return &metrics{
+		evaluations:   maps.Clone(m.evaluations),
+		errors:        maps.Clone(m.errors),
+		calls:         maps.Clone(m.calls),
+		latencyCounts: slices.Clone(m.latencyCounts),
+		latencySum:    m.latencySum,
+		latencyCount:  m.latencyCount,
+		caches:        maps.Clone(m.caches),
+		droppedSpans:  m.droppedSpans,
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format. The cache
+// callbacks take locks of their own, such as the one of the sessions, so
+// they are called after the counters were copied and m.mu is released.
+func (m *metrics) WriteTo(w io.Writer, streams *streamManager) {
+	m = m.snapshot()
+
+	header(w, "goculator_evaluations_total", "counter", "Calculations by outcome.")
+	for _, outcome := range sortedKeys(m.evaluations) {
+		fmt.Fprintf(w, "goculator_evaluations_total{outcome=%s} %d\n", label(outcome), m.evaluations[outcome])
+	}
+
+	header(w, "goculator_evaluation_errors_total", "counter", "Failed calculations by class of error.")
+	for _, class := range sortedKeys(m.errors) {
+		fmt.Fprintf(w, "goculator_evaluation_errors_total{class=%s} %d\n", label(class), m.errors[class])
+	}
+
+	header(w, "goculator_evaluation_duration_seconds", "histogram", "Time calculations took.")
+	var cumulative uint64
+	for i, le := range latencyBuckets {
+		cumulative += m.latencyCounts[i]
+		fmt.Fprintf(w, "goculator_evaluation_duration_seconds_bucket{le=%s} %d\n", label(strconv.FormatFloat(le, 'g', -1, 64)), cumulative)
+	}
+	fmt.Fprintf(w, "goculator_evaluation_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(w, "goculator_evaluation_duration_seconds_sum %s\n", strconv.FormatFloat(m.latencySum, 'g', -1, 64))
+	fmt.Fprintf(w, "goculator_evaluation_duration_seconds_count %d\n", m.latencyCount)
+
+	header(w, "goculator_function_calls_total", "counter", "Calls of builtin functions by function and outcome.")
+	calls := make([][2]string, 0, len(m.calls))
+	for k := range m.calls {
+		calls = append(calls, k)
+	}
+	slices.SortFunc(calls, func(a, b [2]string) int { return strings.Compare(a[0]+"\x00"+a[1], b[0]+"\x00"+b[1]) })
+	for _, k := range calls {
+		fmt.Fprintf(w, "goculator_function_calls_total{function=%s,outcome=%s} %d\n", label(k[0]), label(k[1]), m.calls[k])
+	}
+
+	header(w, "goculator_sse_clients", "gauge", "Connected event stream clients.")
+	fmt.Fprintf(w, "goculator_sse_clients %d\n", len(streams.Clients()))
+
+	header(w, "goculator_sse_dropped_messages_total", "counter", "Event stream messages dropped because the buffer of a client was full.")
+	fmt.Fprintf(w, "goculator_sse_dropped_messages_total %d\n", streams.Dropped())
+
+	if m.droppedSpans != nil {
+		header(w, "goculator_trace_dropped_spans_total", "counter", "Tracing spans dropped because the exporter fell behind.")
+		fmt.Fprintf(w, "goculator_trace_dropped_spans_total %d\n", m.droppedSpans())
+	}
+
+	names := sortedKeys(m.caches)
+	header(w, "goculator_cache_requests_total", "counter", "Cache lookups by cache and result.")
+	for _, name := range names {
+		hits, misses := m.caches[name]()
+		fmt.Fprintf(w, "goculator_cache_requests_total{cache=%s,result=\"hit\"} %d\n", label(name), hits)
+		fmt.Fprintf(w, "goculator_cache_requests_total{cache=%s,result=\"miss\"} %d\n", label(name), misses)
+	}
+	header(w, "goculator_cache_hit_ratio", "gauge", "Share of cache lookups that were hits.")
+	for _, name := range names {
+		hits, misses := m.caches[name]()
+		ratio := 0.0
+		if hits+misses > 0 {
+			ratio = float64(hits) / float64(hits+misses)
+		}
+		fmt.Fprintf(w, "goculator_cache_hit_ratio{cache=%s} %s\n", label(name), strconv.FormatFloat(ratio, 'g', -1, 64))
+	}
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// label quotes a label value, escaping as the text format requires.
+func label(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Metrics serves the metrics in the Prometheus text format.
+func (a *App) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	a.Stats.WriteTo(w, sseManager)
+}
+
+// streamManager is the sse.Manager of the event stream. It delivers the
+// messages to its listeners itself rather than through the workers of
+// sse.NewManager, which drop messages for a full buffer without a trace and
+// may send to the channel of a client that just disconnected. Messages are
+// not kept for clients that connect later, the clock sends one every second.
+type streamManager struct {
+	mu        sync.Mutex
+	listeners map[string]sse.Listener
+	dropped   uint64
+	sent      time.Time
+
+	// started is when the manager was made, before it sent anything
+	started time.Time
+}
+
+func newStreamManager() *streamManager {
+	return &streamManager{listeners: map[string]sse.Listener{}, started: time.Now()}
+}
+
+// Handle implements sse.Manager. It writes the messages of the client to the
+// response until the request is done.
+func (m *streamManager) Handle(w http.ResponseWriter, r *http.Request, cl sse.Listener) {
+	m.mu.Lock()
+	m.listeners[cl.ID()] = cl
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.listeners, cl.ID())
+		m.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	flusher, _ := w.(http.Flusher)
+	for {
+		select {
+		case msg := <-cl.Chan():
+			if _, err := fmt.Fprint(w, msg.String()); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Send implements sse.Manager. Messages are delivered without blocking, a
+// client with a full buffer misses the message.
+func (m *streamManager) Send(message sse.Envelope) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, cl := range m.listeners {
+		select {
+		case cl.Chan() <- message:
+		default:
+			m.dropped++
+		}
+	}
+	m.sent = time.Now()
+}
+
+// Clients implements sse.Manager.
+func (m *streamManager) Clients() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.listeners))
+	for id := range m.listeners {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// LastSent returns when a message was last sent, the clock sends one every
+// second.
+func (m *streamManager) LastSent() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sent
+}
+
+// Dropped returns the number of messages dropped so far.
+func (m *streamManager) Dropped() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.dropped
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donseba/go-htmx/sse"
+)
+
+type testListener struct {
+	id string
+	ch chan sse.Envelope
+}
+
+func (l *testListener) ID() string              { return l.id }
+func (l *testListener) Chan() chan sse.Envelope { return l.ch }
+
+func TestStreamManagerCountsDroppedMessages(t *testing.T) {
+	m := newStreamManager()
+	m.listeners["a"] = &testListener{id: "a", ch: make(chan sse.Envelope, 2)}
+	m.listeners["b"] = &testListener{id: "b", ch: make(chan sse.Envelope, 5)}
+
+	for range 4 {
+		m.Send(sse.NewMessage("tick"))
+	}
+
+	if got := m.Dropped(); got != 2 {
+		t.Fatalf("got %d dropped messages, want 2", got)
+	}
+	if m.LastSent().IsZero() {
+		t.Fatal("last sent is not set")
+	}
+}
+
+func TestStreamManagerHandle(t *testing.T) {
+	m := newStreamManager()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/sse", nil).WithContext(ctx)
+	w := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	done := make(chan struct{})
+	go func() {
+		m.Handle(w, r, sse.NewClient("a"))
+		close(done)
+	}()
+
+	for len(m.Clients()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	m.Send(sse.NewMessage("12:00:00").WithEvent("time"))
+
+	for !strings.Contains(w.String(), "data: 12:00:00") {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	// the client is gone, sending to nobody drops nothing
+	m.Send(sse.NewMessage("tick"))
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "clients", got: len(m.Clients()), want: 0},
+		{name: "dropped", got: m.Dropped(), want: uint64(0)},
+		{name: "content type", got: w.Header().Get("Content-Type"), want: "text/event-stream"},
+		{name: "stream", got: w.String(), want: "event: time\ndata: 12:00:00\n\n"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// lockedRecorder lets a test read what a handler writes while it runs.
+type lockedRecorder struct {
+	mu sync.Mutex
+	*httptest.ResponseRecorder
+}
+
+func (r *lockedRecorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.ResponseRecorder.Write(b)
+}
+
+func (r *lockedRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Body.String()
+}
+
+func TestMetricsWriteToCallsCachesUnlocked(t *testing.T) {
+	m := newMetrics()
+	m.Evaluation(time.Millisecond, nil)
+	m.Evaluation(time.Millisecond, context.DeadlineExceeded)
+
+	// a cache whose lock is also held while calculating, like the sessions
+	m.Cache("sessions", func() (uint64, uint64) {
+		m.Call("sqrt", nil)
+		return 3, 1
+	})
+
+	done := make(chan string)
+	go func() {
+		sb := strings.Builder{}
+		m.WriteTo(&sb, newStreamManager())
+		done <- sb.String()
+	}()
+
+	var out string
+	select {
+	case out = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("WriteTo deadlocked")
+	}
+
+	for _, want := range []string{
+		`goculator_evaluations_total{outcome="ok"} 1`,
+		`goculator_evaluations_total{outcome="timeout"} 1`,
+		`goculator_cache_requests_total{cache="sessions",result="hit"} 3`,
+		`goculator_cache_hit_ratio{cache="sessions"} 0.75`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in\n%s", want, out)
+		}
+	}
+}
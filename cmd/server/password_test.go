@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		err      error
+	}{
+		{name: "match", hash: hash, password: "correct horse", want: true},
+		{name: "mismatch", hash: hash, password: "battery staple"},
+		// PBKDF2-HMAC-SHA256 of "password" with the salt "salt" and one
+		// iteration, so hashes made before keep working
+		{name: "known vector", hash: "pbkdf2-sha256$1$c2FsdA$Eg+2z/z4syxD5yJSVsT4N6hlSMkszDVICAWYfLcL4Xs", password: "password", want: true},
+		{name: "unknown scheme", hash: "bcrypt$10$abc$def", password: "x", err: errPasswordFormat},
+		{name: "bad iterations", hash: "pbkdf2-sha256$0$c2FsdA$AAAA", password: "x", err: errPasswordFormat},
+		{name: "bad salt", hash: "pbkdf2-sha256$1$!!$AAAA", password: "x", err: errPasswordFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkPassword(tt.hash, tt.password)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+// caseRow is a row of the test matrix in the playground form, the
+// variables as the JSON object they are entered as.
+type caseRow struct {
+	Name      string
+	Variables string
+	Expect    bool
+}
+
+type playgroundPage struct {
+	Name      string
+	Condition string
+	Cases     []caseRow
+	Saved     template.HTML
+}
+
+// Playground renders the condition playground, with the saved condition
+// named in the query loaded into the editor.
+func (a *App) Playground(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("playground.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sess := a.session(w, r)
+	page := playgroundPage{Saved: template.HTML(savedList(a.Conditions.List(sess.ID)))}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		c, ok := a.Conditions.Get(sess.ID, name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		page.Name, page.Condition = c.Name, c.Condition
+		for _, tc := range c.Cases {
+			vars, _ := json.Marshal(tc.Variables)
+			page.Cases = append(page.Cases, caseRow{Name: tc.Name, Variables: string(vars), Expect: tc.Expect})
+		}
+	}
+	if len(page.Cases) == 0 {
+		page.Cases = []caseRow{{Expect: true}}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// readCases reads the condition and its test matrix from the form, the
+// columns of the matrix are posted as repeated fields.
+func readCases(r *http.Request) (string, []goculator.Case, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", nil, err
+	}
+
+	condition := strings.TrimSpace(r.PostFormValue("condition"))
+	if condition == "" {
+		return "", nil, errors.New("missing condition")
+	}
+
+	names, vars, expects := r.PostForm["case_name"], r.PostForm["case_vars"], r.PostForm["case_expect"]
+	if len(vars) != len(names) || len(expects) != len(names) {
+		return "", nil, errors.New("incomplete test matrix")
+	}
+
+	cases := make([]goculator.Case, len(names))
+	for i := range names {
+		v, err := parseVariables([]byte(vars[i]))
+		if err != nil {
+			return "", nil, fmt.Errorf("case %d: %w", i+1, err)
+		}
+
+		cases[i] = goculator.Case{Name: names[i], Variables: v, Expect: expects[i] == "true"}
+	}
+
+	return condition, cases, nil
+}
+
+// PlaygroundRun evaluates the condition for every case of the matrix and
+// renders the pass or fail grid.
+func (a *App) PlaygroundRun(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	condition, cases, err := readCases(r)
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	ctx, cancel := a.session(w, r).calcContext(r)
+	defer cancel()
+
+	results, err := goculator.CheckCondition(ctx, condition, cases)
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	passed := 0
+	for _, res := range results {
+		if res.Pass {
+			passed++
+		}
+	}
+	if passed == len(results) {
+		h.TriggerInfo(fmt.Sprintf("all %d cases pass", len(results)))
+	} else {
+		h.TriggerWarning(fmt.Sprintf("%d of %d cases fail", len(results)-passed, len(results)))
+	}
+
+	_, _ = h.Write([]byte(caseGrid(results)))
+}
+
+// caseGrid renders the outcome of every case as a row coloured by whether it
+// passed, results that are not booleans are flagged apart from failures.
+func caseGrid(results []goculator.CaseResult) string {
+	sb := strings.Builder{}
+	sb.WriteString(`<table class="w-full text-xs text-left"><thead><tr class="text-gray-500"><th>case</th><th>variables</th><th>expect</th><th>got</th><th></th></tr></thead><tbody>`)
+
+	for i, res := range results {
+		name := res.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		vars, _ := json.Marshal(res.Variables)
+
+		got, status, class := fmt.Sprint(res.Got), "pass", "bg-green-100"
+		switch {
+		case res.NotCondition:
+			got, status, class = res.Error, "not a boolean", "bg-yellow-100"
+		case res.Error != "":
+			got, status, class = res.Error, "error", "bg-red-100"
+		case !res.Pass:
+			status, class = "fail", "bg-red-100"
+		}
+
+		fmt.Fprintf(&sb, `<tr class="%s"><td class="p-1">%s</td><td class="p-1 font-mono">%s</td><td class="p-1">%t</td><td class="p-1">%s</td><td class="p-1 font-bold">%s</td></tr>`,
+			class, html.EscapeString(name), html.EscapeString(string(vars)), res.Expect, html.EscapeString(got), status)
+	}
+
+	sb.WriteString(`</tbody></table>`)
+	return sb.String()
+}
+
+// PlaygroundSave saves the condition with its test matrix under the name
+// entered in the form and renders the updated list of saved conditions.
+// Conditions belong to the session, like its functions and variables.
+func (a *App) PlaygroundSave(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+	h := a.HTMX.NewHandler(w, r)
+
+	condition, cases, err := readCases(r)
+	if err == nil {
+		_, err = goculator.Parse(condition)
+	}
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if err == nil && name == "" {
+		err = errors.New("missing name")
+	}
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte(savedList(a.Conditions.List(sess.ID))))
+		return
+	}
+
+	err = a.Conditions.Save(savedCondition{Owner: sess.ID, Name: name, Condition: condition, Cases: cases, Saved: time.Now()})
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+	} else {
+		h.TriggerInfo(fmt.Sprintf("saved %s", name))
+	}
+
+	_, _ = h.Write([]byte(savedList(a.Conditions.List(sess.ID))))
+}
+
+// PlaygroundDelete removes a condition the session saved and renders the
+// updated list.
+func (a *App) PlaygroundDelete(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+	h := a.HTMX.NewHandler(w, r)
+
+	if err := a.Conditions.Delete(sess.ID, r.PathValue("name")); err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+	}
+
+	_, _ = h.Write([]byte(savedList(a.Conditions.List(sess.ID))))
+}
+
+// savedList renders the saved conditions as links loading them into the
+// editor.
+func savedList(list []savedCondition) string {
+	sb := strings.Builder{}
+	sb.WriteString(`<ul id="saved" class="text-xs space-y-1">`)
+	for _, c := range list {
+		name := html.EscapeString(c.Name)
+		fmt.Fprintf(&sb, `<li class="flex justify-between"><a class="underline" href="/playground?name=%s">%s</a><span class="text-gray-400 font-mono truncate mx-2">%s</span><button type="button" class="text-red-600" hx-delete="/playground/%s" hx-target="#saved" hx-swap="outerHTML" hx-confirm="Delete %s?">×</button></li>`,
+			url.QueryEscape(c.Name), name, html.EscapeString(c.Condition), url.PathEscape(c.Name), name)
+	}
+	if len(list) == 0 {
+		sb.WriteString(`<li class="text-gray-400">nothing saved yet</li>`)
+	}
+	sb.WriteString(`</ul>`)
+	return sb.String()
+}
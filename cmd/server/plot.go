@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/donseba/goculator"
+)
+
+const (
+	plotWidth  = 520
+	plotHeight = 320
+)
+
+// Plot renders the graph panel for the expressions in the query, it is used
+// by the zoom and pan buttons of the panel itself.
+func (a *App) Plot(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	ctx, cancel := a.session(w, r).calcContext(r)
+	defer cancel()
+
+	p, err := plotFromQuery(ctx, r)
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	_, _ = h.Write([]byte(plotPanel(p)))
+}
+
+// PlotSVG serves the plot as a downloadable SVG file.
+func (a *App) PlotSVG(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.session(w, r).calcContext(r)
+	defer cancel()
+
+	p, err := plotFromQuery(ctx, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="plot.svg"`)
+	_, _ = w.Write([]byte(p.SVG(plotWidth, plotHeight)))
+}
+
+// plotFromQuery samples the plot described by the expr, var, from and to
+// query parameters. expr can be repeated for several series.
+func plotFromQuery(ctx context.Context, r *http.Request) (*goculator.Plot, error) {
+	q := r.URL.Query()
+
+	from, err := strconv.ParseFloat(q.Get("from"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %q", q.Get("from"))
+	}
+
+	to, err := strconv.ParseFloat(q.Get("to"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to: %q", q.Get("to"))
+	}
+
+	variable := q.Get("var")
+	if variable == "" {
+		variable = "x"
+	}
+
+	return goculator.NewPlot(ctx, q["expr"], variable, from, to)
+}
+
+// plotQuery encodes the plot for the given range as query parameters.
+func plotQuery(p *goculator.Plot, from, to float64) string {
+	q := url.Values{}
+	for _, s := range p.Series {
+		q.Add("expr", s.Expr)
+	}
+	q.Set("var", p.Variable)
+	q.Set("from", strconv.FormatFloat(from, 'g', -1, 64))
+	q.Set("to", strconv.FormatFloat(to, 'g', -1, 64))
+
+	return q.Encode()
+}
+
+// plotPanel renders the graph panel: the chart with zoom, pan and download
+// controls.
+func plotPanel(p *goculator.Plot) string {
+	width := p.To - p.From
+	mid := p.From + width/2
+
+	button := func(label string, from, to float64) string {
+		return fmt.Sprintf(`<button type="button" class="bg-gray-200 hover:bg-gray-300 rounded-md px-2" hx-get="/plot?%s" hx-target="#graph">%s</button>`,
+			html.EscapeString(plotQuery(p, from, to)), label)
+	}
+
+	return fmt.Sprintf(`<div class="m-3 text-sm"><div class="flex space-x-1 mb-1">%s%s%s%s<a class="ml-auto text-blue-600" href="/plot.svg?%s" download="plot.svg">download SVG</a></div>%s</div>`,
+		button("−", mid-width, mid+width),
+		button("+", mid-width/4, mid+width/4),
+		button("←", p.From-width/4, p.To-width/4),
+		button("→", p.From+width/4, p.To+width/4),
+		html.EscapeString(plotQuery(p, p.From, p.To)),
+		p.SVG(plotWidth, plotHeight),
+	)
+}
+
+// graphPanel renders the out-of-band swap of the graph panel for a plot
+// result. Other results leave the last graph in place.
+func graphPanel(out any) string {
+	p, ok := out.(*goculator.Plot)
+	if !ok {
+		return ""
+	}
+
+	return `<div id="graph" hx-swap-oob="true">` + plotPanel(p) + `</div>`
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+// previewTimeout bounds a preview, which runs on every pause in typing.
+const previewTimeout = time.Second
+
+// Preview renders the input as it is being typed: the result when it
+// calculates, the syntax error with its position when it does not, and the
+// brackets that do not match. Nothing is recorded, assigned or defined, and
+// builtins such as rand and ai are not called.
+func (a *App) Preview(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	in := r.PostFormValue("calc")
+	if strings.TrimSpace(in) == "" {
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	sess := a.session(w, r)
+	ctx, cancel := context.WithTimeout(sess.context(r.Context()), previewTimeout)
+	defer cancel()
+
+	out, err := goculator.Preview(ctx, in)
+
+	var marks []goculator.Span
+	var se *goculator.SyntaxError
+	if errors.As(err, &se) {
+		marks = append(marks, se.Span)
+	}
+	brackets := goculator.UnmatchedBrackets(in)
+	marks = append(marks, brackets...)
+
+	sb := strings.Builder{}
+	sb.WriteString(`<div class="text-right text-xs font-mono">`)
+	if len(marks) > 0 {
+		sb.WriteString(`<div class="text-gray-700">` + markSpans(in, marks) + `</div>`)
+	}
+
+	switch {
+	case err == nil:
+		fmt.Fprintf(&sb, `<div class="text-gray-500">= %s</div>`, html.EscapeString(goculator.Format(out)))
+	case errors.Is(err, goculator.ErrNotAllowed):
+		fmt.Fprintf(&sb, `<div class="text-gray-500">%s, not previewed</div>`, html.EscapeString(err.Error()))
+	case errors.Is(err, context.DeadlineExceeded):
+		sb.WriteString(`<div class="text-gray-500">takes too long to preview</div>`)
+	default:
+		fmt.Fprintf(&sb, `<div class="text-red-600">%s</div>`, html.EscapeString(err.Error()))
+	}
+	switch len(brackets) {
+	case 0:
+	case 1:
+		sb.WriteString(`<div class="text-red-600">1 unmatched bracket</div>`)
+	default:
+		fmt.Fprintf(&sb, `<div class="text-red-600">%d unmatched brackets</div>`, len(brackets))
+	}
+
+	sb.WriteString(`</div>`)
+	_, _ = h.Write([]byte(sb.String()))
+}
+
+// markSpans renders the input escaped, with the spans underlined in red. An
+// empty span, such as the end of the input, is marked by a caret.
+func markSpans(in string, spans []goculator.Span) string {
+	marked := make([]bool, len(in)+1)
+	for _, s := range spans {
+		if s.End <= s.Pos {
+			marked[min(s.Pos, len(in))] = true
+			continue
+		}
+		for i := s.Pos; i < s.End && i < len(in); i++ {
+			marked[i] = true
+		}
+	}
+
+	sb := strings.Builder{}
+	for i := 0; i <= len(in); i++ {
+		if i == len(in) {
+			if marked[i] {
+				sb.WriteString(`<span class="text-red-600">^</span>`)
+			}
+			break
+		}
+
+		// keep multi-byte characters together
+		j := i + 1
+		for j < len(in) && in[j]&0xC0 == 0x80 {
+			j++
+		}
+		c := html.EscapeString(in[i:j])
+		if marked[i] {
+			c = `<span class="text-red-600 font-bold underline">` + c + `</span>`
+		}
+		sb.WriteString(c)
+		i = j - 1
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bucket is the token bucket of a single client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter hands out tokens per client, refilled at a steady rate up to
+// the burst size.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*bucket{}, swept: time.Now()}
+}
+
+// Allow takes a token of the client, when there is none it returns how long
+// until the next one.
+func (l *rateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the clients whose bucket has filled up again, they are in
+// the same state as a client that was never seen.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// connLimiter caps the number of connections a client holds open at once,
+// a maximum of 0 is no limit.
+type connLimiter struct {
+	mu    sync.Mutex
+	max   int
+	conns map[string]int
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{max: max, conns: map[string]int{}}
+}
+
+// Acquire reserves a connection of the client, reporting false when it has
+// the maximum open already.
+func (l *connLimiter) Acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.conns[client] >= l.max {
+		return false
+	}
+	l.conns[client]++
+	return true
+}
+
+// Release returns a connection reserved by Acquire.
+func (l *connLimiter) Release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns[client]--
+	if l.conns[client] <= 0 {
+		delete(l.conns, client)
+	}
+}
+
+type apiKeyKey struct{}
+
+// clientID returns who a request is counted against: the API key it carries,
+// otherwise the IP address it came from.
+func clientID(r *http.Request) string {
+	if k, ok := r.Context().Value(apiKeyKey{}).(apiKey); ok {
+		return "key:" + k.ID
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limit only lets requests through while the client has tokens left, others
+// are answered with 429 Too Many Requests: an error body for the API, a
+// warning for the UI.
+func (a *App) limit(next http.HandlerFunc) http.HandlerFunc {
+	if a.Limiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := a.Limiter.Allow(clientID(r))
+		if ok {
+			next(w, r)
+			return
+		}
+
+		retry := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		err := fmt.Errorf("too many calculations, try again in %ds", retry)
+
+		if r.Header.Get("HX-Request") != "true" {
+			writeAPIError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		h := a.HTMX.NewHandler(w, r)
+		h.TriggerWarning(err.Error())
+		h.WriteHeader(http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/donseba/go-htmx"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(1, 3)
+
+	tests := []struct {
+		client string
+		// elapsed moves the last refill of the client back, as if that much
+		// time passed
+		elapsed time.Duration
+		want    bool
+	}{
+		{client: "a", want: true},
+		{client: "a", want: true},
+		{client: "a", want: true},
+		{client: "a", want: false},
+		// other clients have buckets of their own
+		{client: "b", want: true},
+		{client: "a", elapsed: time.Second, want: true},
+		{client: "a", want: false},
+		// the bucket never holds more than the burst
+		{client: "a", elapsed: time.Hour, want: true},
+		{client: "a", want: true},
+		{client: "a", want: true},
+		{client: "a", want: false},
+	}
+
+	for i, tt := range tests {
+		if b, ok := l.buckets[tt.client]; ok {
+			b.last = b.last.Add(-tt.elapsed)
+		}
+
+		ok, wait := l.Allow(tt.client)
+		if ok != tt.want {
+			t.Fatalf("%d: %s allowed: got %v, want %v", i, tt.client, ok, tt.want)
+		}
+		if !ok && (wait <= 0 || wait > time.Second) {
+			t.Fatalf("%d: got wait %s", i, wait)
+		}
+	}
+}
+
+func TestRateLimiterSweeps(t *testing.T) {
+	l := newRateLimiter(1, 2)
+	l.Allow("a")
+	l.Allow("b")
+
+	// a full bucket is forgotten, a client still waiting for tokens is not
+	l.buckets["a"].last = l.buckets["a"].last.Add(-time.Minute)
+	l.swept = l.swept.Add(-2 * time.Minute)
+	l.Allow("c")
+
+	if _, ok := l.buckets["a"]; ok {
+		t.Fatal("a was not swept")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Fatal("b was swept")
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	l := newConnLimiter(2)
+
+	for i, want := range []bool{true, true, false} {
+		if got := l.Acquire("a"); got != want {
+			t.Fatalf("%d: got %v, want %v", i, got, want)
+		}
+	}
+	l.Release("a")
+	if !l.Acquire("a") {
+		t.Fatal("the released connection was not handed out again")
+	}
+	if !l.Acquire("b") {
+		t.Fatal("b is limited by the connections of a")
+	}
+
+	unlimited := newConnLimiter(0)
+	for range 10 {
+		if !unlimited.Acquire("a") {
+			t.Fatal("a limiter without a maximum refused a connection")
+		}
+	}
+}
+
+func TestClientID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if got := clientID(r); got != "ip:192.0.2.1" {
+		t.Fatalf("got %s", got)
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, apiKey{ID: "k1"}))
+	if got := clientID(r); got != "key:k1" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	app := &App{HTMX: htmx.New(), Limiter: newRateLimiter(0.001, 1)}
+	handler := app.limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		htmx   bool
+		status int
+	}{
+		{name: "allowed", status: http.StatusNoContent},
+		{name: "api", status: http.StatusTooManyRequests},
+		{name: "ui", htmx: true, status: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/calc", nil)
+			if tt.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Fatal("no Retry-After header")
+			}
+			if tt.htmx && w.Header().Get("HX-Trigger") == "" {
+				t.Fatal("no warning triggered")
+			}
+		})
+	}
+}
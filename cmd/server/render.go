@@ -0,0 +1,60 @@
+package main
+
+import (
+	"html"
+	"strings"
+
+	"github.com/donseba/goculator"
+)
+
+// renderResult renders an evaluation result for the #result element.
+// Matrices are rendered as a table, everything else as escaped text. The
+// data-value attribute holds the result in expression syntax so the keypad
+// can continue calculating with it.
+func renderResult(out any) string {
+	switch v := out.(type) {
+	case goculator.Solution:
+		return renderReported(v, goculator.Format(v.Value), v.Report())
+	case goculator.Roots:
+		return renderReported(v, v.Vector().String(), v.Report())
+	case goculator.Estimate:
+		return renderReported(v, goculator.Format(v.Value), v.Report())
+	}
+
+	m, ok := out.(goculator.Matrix)
+	if !ok {
+		return html.EscapeString(goculator.Format(out))
+	}
+
+	rows := m.Rows
+	if m.IsVector() {
+		// show vectors as a single row, they print as a flat list as well
+		rows = 1
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(`<table class="ml-auto text-xl font-normal" data-value="` + html.EscapeString(m.String()) + `">`)
+	for i := 0; i < rows; i++ {
+		sb.WriteString("<tr>")
+
+		values := m.Row(i)
+		if m.IsVector() {
+			values = m.Data
+		}
+		for _, v := range values {
+			sb.WriteString(`<td class="px-2 border-l border-r border-gray-300">` + goculator.Format(v) + "</td>")
+		}
+
+		sb.WriteString("</tr>")
+	}
+	sb.WriteString("</table>")
+
+	return sb.String()
+}
+
+// renderReported renders a numerically approximated result, such as the
+// result of solve or integrate, with a line describing how it was found.
+func renderReported(out any, value, report string) string {
+	return `<div data-value="` + html.EscapeString(value) + `">` + html.EscapeString(goculator.Format(out)) + `</div>` +
+		`<div class="text-gray-500 text-xs font-normal">` + html.EscapeString(report) + `</div>`
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/donseba/expronaut"
+	"github.com/donseba/goculator"
+)
+
+const sessionCookie = "goculator_session"
+
+// session holds the state of a visitor across requests. Functions and
+// variables are kept in the store under the session id as well, so a
+// session outlives a restart of the server.
+type session struct {
+	ID        string
+	Functions *goculator.Functions
+
+	mu        sync.Mutex
+	variables map[string]any
+	// keypad is the mode the calculator is in, empty for the first
+	keypad string
+	// sheet is the worksheet last calculated in the editor, the lines an
+	// edit leaves alone keep their result from it
+	sheet []goculator.SheetLine
+
+	// used is when the session was last used, guarded by the lock of the
+	// sessionStore
+	used time.Time
+}
+
+func newSession(id string) *session {
+	return &session{ID: id, Functions: goculator.NewFunctions(), variables: map[string]any{}}
+}
+
+// sessionStore keeps the sessions in use in memory. Sessions that were not
+// used within the TTL are dropped, and beyond the maximum the least recently
+// used ones, they are restored from the store when used again.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*list.Element // of *session
+	lru      *list.List               // most recently used first
+	loading  map[string]*restoring
+
+	max int
+	ttl time.Duration
+
+	// hits counts sessions found in memory, misses those looked up in the
+	// store
+	hits, misses uint64
+}
+
+// restoring is a session being restored from the store. Requests for it
+// wait for the restore started first instead of starting another.
+type restoring struct {
+	done chan struct{}
+	sess *session
+	ok   bool
+}
+
+// newSessionStore returns a store keeping at most max sessions for the ttl
+// after their last use, zero values do not limit.
+func newSessionStore(max int, ttl time.Duration) *sessionStore {
+	return &sessionStore{
+		sessions: make(map[string]*list.Element),
+		lru:      list.New(),
+		loading:  make(map[string]*restoring),
+		max:      max,
+		ttl:      ttl,
+	}
+}
+
+// CacheStats returns how often a session was found in memory and how often
+// it had to be looked up in the store.
+func (s *sessionStore) CacheStats() (hits, misses uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hits, s.misses
+}
+
+// Len returns the number of sessions in memory.
+func (s *sessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len()
+}
+
+// Expire drops the sessions that were not used within the TTL.
+func (s *sessionStore) Expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := s.lru.Back(); e != nil && s.expired(e.Value.(*session), now); e = s.lru.Back() {
+		s.remove(e)
+	}
+}
+
+func (s *sessionStore) expired(sess *session, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(sess.used) > s.ttl
+}
+
+// lookup returns the session with the id if it is in memory, with s.mu
+// held.
+func (s *sessionStore) lookup(id string, now time.Time) (*session, bool) {
+	e, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+
+	sess := e.Value.(*session)
+	if s.expired(sess, now) {
+		s.remove(e)
+		return nil, false
+	}
+
+	sess.used = now
+	s.lru.MoveToFront(e)
+	return sess, true
+}
+
+// add keeps the session in memory and returns it, or the session with the
+// same id that is already kept. The least recently used sessions beyond the
+// maximum are dropped. With s.mu held.
+func (s *sessionStore) add(sess *session, now time.Time) *session {
+	if kept, ok := s.lookup(sess.ID, now); ok {
+		return kept
+	}
+
+	sess.used = now
+	s.sessions[sess.ID] = s.lru.PushFront(sess)
+	for s.max > 0 && s.lru.Len() > s.max {
+		s.remove(s.lru.Back())
+	}
+	return sess
+}
+
+func (s *sessionStore) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.sessions, e.Value.(*session).ID)
+}
+
+// Add keeps a new session in memory.
+func (s *sessionStore) Add(sess *session) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(sess, time.Now())
+}
+
+// Load returns the session with the id from memory, or restores it with
+// restore, which is called without holding the lock: restoring evaluates
+// the stored variables, which can take a while. Loads of the same id wait
+// for the one that restores it.
+func (s *sessionStore) Load(id string, restore func(id string) (*session, bool)) (*session, bool) {
+	s.mu.Lock()
+	if sess, ok := s.lookup(id, time.Now()); ok {
+		s.hits++
+		s.mu.Unlock()
+		return sess, true
+	}
+	s.misses++
+
+	if l, ok := s.loading[id]; ok {
+		s.mu.Unlock()
+		<-l.done
+		return l.sess, l.ok
+	}
+	l := &restoring{done: make(chan struct{})}
+	s.loading[id] = l
+	s.mu.Unlock()
+
+	defer close(l.done)
+	l.sess, l.ok = restore(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loading, id)
+	if l.ok {
+		l.sess = s.add(l.sess, time.Now())
+	}
+	return l.sess, l.ok
+}
+
+// session returns the session of the request. A session that is not in
+// memory is restored from the store, a request without a session cookie
+// starts a new one. With accounts enabled the session belongs to the user.
+func (a *App) session(w http.ResponseWriter, r *http.Request) *session {
+	// the restore is shared by the requests waiting for it, it does not end
+	// with the request that started it
+	ctx := context.WithoutCancel(r.Context())
+	restore := func(id string) (*session, bool) {
+		return a.restoreSession(ctx, id)
+	}
+
+	// a signed in user has one session in every browser and API key
+	if u, ok := currentUser(r); ok {
+		id := "user:" + u.Name
+		if sess, ok := a.Sessions.Load(id, restore); ok {
+			return sess
+		}
+		return a.Sessions.Add(newSession(id))
+	}
+
+	if c, err := r.Cookie(sessionCookie); err == nil && c.Value != "" {
+		// a cookie the store knows nothing about, such as one from before
+		// the data file was removed, starts a new session
+		if sess, ok := a.Sessions.Load(c.Value, restore); ok {
+			return sess
+		}
+	}
+
+	sess := a.Sessions.Add(newSession(newSessionID()))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sess.ID,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return sess
+}
+
+// restoreSession loads the functions and variables of the session from the
+// store, reporting whether the store has anything for it. Definitions that
+// no longer evaluate, for instance because a builtin of the same name was
+// added, are skipped.
+func (a *App) restoreSession(ctx context.Context, id string) (*session, bool) {
+	sess := newSession(id)
+
+	defs, err := a.Store.Functions(ctx, id)
+	if err != nil {
+		logger(ctx).Error("restoring functions of a session", "err", err)
+	}
+	vars, err := a.Store.Variables(ctx, id)
+	if err != nil {
+		logger(ctx).Error("restoring variables of a session", "err", err)
+	}
+	history, err := a.Store.History(ctx, id, 1)
+	if err != nil {
+		logger(ctx).Error("restoring history of a session", "err", err)
+	}
+	settings, err := a.Store.Settings(ctx, id)
+	if err != nil {
+		logger(ctx).Error("restoring settings of a session", "err", err)
+	}
+	if len(defs) == 0 && len(vars) == 0 && len(history) == 0 && len(settings) == 0 {
+		return nil, false
+	}
+
+	sess.keypad = settings[keypadSetting]
+
+	// functions may call each other, define them until no more succeed
+	for progress := true; progress && len(defs) > 0; {
+		progress = false
+		for name, def := range defs {
+			f, err := goculator.ParseDefinition(def)
+			if err == nil && sess.Functions.Define(f) == nil {
+				delete(defs, name)
+				progress = true
+			}
+		}
+	}
+
+	// variables may refer to each other as well
+	for progress := true; progress && len(vars) > 0; {
+		progress = false
+		pending := vars[:0]
+		for _, v := range vars {
+			out, err := goculator.Evaluate(sess.context(ctx), v.Expression)
+			if err != nil {
+				pending = append(pending, v)
+				continue
+			}
+			sess.variables[v.Name] = out
+			progress = true
+		}
+		vars = pending
+	}
+
+	return sess, true
+}
+
+// Variables returns a copy of the variables of the session.
+func (s *session) Variables() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.variables)
+}
+
+// SetVariable binds the name to the value for the following calculations.
+func (s *session) SetVariable(name string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.variables[name] = value
+}
+
+// DeleteVariable removes the variable, reporting whether it was set.
+func (s *session) DeleteVariable(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.variables[name]
+	delete(s.variables, name)
+	return ok
+}
+
+// Keypad returns the mode the calculator is in, empty when none was chosen.
+func (s *session) Keypad() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.keypad
+}
+
+// SetKeypad switches the calculator to the mode.
+func (s *session) SetKeypad(mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keypad = mode
+}
+
+// Sheet returns the worksheet last calculated in the editor.
+func (s *session) Sheet() []goculator.SheetLine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sheet
+}
+
+// SetSheet keeps the worksheet calculated in the editor, for the next edit.
+func (s *session) SetSheet(sheet []goculator.SheetLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sheet = sheet
+}
+
+// context returns ctx with the functions and variables of the session.
+func (s *session) context(ctx context.Context) context.Context {
+	ctx = goculator.WithFunctions(ctx, s.Functions)
+	return expronaut.SetVariables(ctx, s.Variables())
+}
+
+// calcContext returns the context calculations of the request run in: the
+// functions and variables of the session can be used and it ends after the
+// timeout.
+func (s *session) calcContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.context(r.Context()), *timeoutFlag)
+}
+
+// newSessionID returns a random session id, unlike randStringRunes it can
+// not be guessed.
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
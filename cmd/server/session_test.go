@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := newSessionStore(2, 0)
+
+	s.Add(newSession("a"))
+	s.Add(newSession("b"))
+	// using a makes b the least recently used
+	if _, ok := s.Load("a", noRestore); !ok {
+		t.Fatal("a is not in memory")
+	}
+	s.Add(newSession("c"))
+
+	tests := []struct {
+		id   string
+		kept bool
+	}{
+		{id: "a", kept: true},
+		{id: "b"},
+		{id: "c", kept: true},
+	}
+	for _, tt := range tests {
+		if _, ok := s.Load(tt.id, noRestore); ok != tt.kept {
+			t.Errorf("session %s kept: got %v, want %v", tt.id, ok, tt.kept)
+		}
+	}
+}
+
+func TestSessionStoreExpire(t *testing.T) {
+	s := newSessionStore(0, time.Hour)
+	s.Add(newSession("a"))
+	s.Add(newSession("b"))
+
+	s.Expire(time.Now().Add(30 * time.Minute))
+	if got := s.Len(); got != 2 {
+		t.Fatalf("got %d sessions, want 2", got)
+	}
+
+	s.Expire(time.Now().Add(2 * time.Hour))
+	if got := s.Len(); got != 0 {
+		t.Fatalf("got %d sessions, want none", got)
+	}
+}
+
+func TestSessionStoreRestoresOnce(t *testing.T) {
+	s := newSessionStore(0, 0)
+
+	var restores atomic.Int32
+	release := make(chan struct{})
+	restore := func(id string) (*session, bool) {
+		restores.Add(1)
+		<-release
+		return newSession(id), true
+	}
+
+	var wg sync.WaitGroup
+	got := make([]*session, 5)
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i], _ = s.Load("a", restore)
+		}()
+	}
+
+	// another session can be used while a is being restored
+	done := make(chan struct{})
+	go func() {
+		s.Add(newSession("b"))
+		_, _ = s.Load("b", noRestore)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the store is locked while a session is restored")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := restores.Load(); n != 1 {
+		t.Fatalf("restored %d times, want once", n)
+	}
+	for _, sess := range got {
+		if sess != got[0] {
+			t.Fatal("concurrent loads returned different sessions")
+		}
+	}
+}
+
+func noRestore(id string) (*session, bool) {
+	return nil, false
+}
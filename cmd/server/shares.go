@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+// Share keeps the calculation in the input, with the variables and
+// functions of the session it reads, and renders its link. The address bar
+// is set to the link as well.
+func (a *App) Share(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	sess := a.session(w, r)
+	ctx, cancel := sess.calcContext(r)
+	defer cancel()
+
+	share, err := a.shareOf(ctx, sess, strings.TrimSpace(r.PostFormValue("calc")))
+	if err == nil {
+		err = a.Store.SaveShare(r.Context(), share)
+	}
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	link := "/s/" + share.ID
+	h.PushURL(link)
+	h.TriggerInfo("link to the calculation created")
+
+	fmt.Fprintf(h, `<input type="text" readonly class="w-full bg-gray-200 rounded-md px-1" value="%s" _="on click call me.select()" /><a class="underline" href="%s">%s</a>`,
+		html.EscapeString(absoluteURL(r, link)), link, link)
+}
+
+// shareOf returns the share of the calculation: the expression, the
+// variables and functions of the session it reads, directly or through
+// each other, and its result.
+func (a *App) shareOf(ctx context.Context, sess *session, in string) (goculator.Share, error) {
+	if in == "" {
+		return goculator.Share{}, errors.New("missing input")
+	}
+
+	tree, err := goculator.Parse(in)
+	if err != nil {
+		return goculator.Share{}, err
+	}
+	out, err := tree.Evaluate(ctx)
+	if err != nil {
+		return goculator.Share{}, err
+	}
+
+	vars, err := a.Store.Variables(ctx, sess.ID)
+	if err != nil {
+		return goculator.Share{}, err
+	}
+
+	share := goculator.Share{Expression: in, Result: goculator.Format(out), Created: time.Now()}
+	seen := map[string]bool{}
+	for pending := tree.Uses(); len(pending) > 0; {
+		name := pending[0]
+		pending = pending[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if i := slices.IndexFunc(vars, func(v goculator.Variable) bool { return v.Name == name }); i >= 0 {
+			share.Variables = append(share.Variables, vars[i])
+			if t, err := goculator.Parse(vars[i].Expression); err == nil {
+				pending = append(pending, t.Uses()...)
+			}
+		}
+		if f, ok := sess.Functions.Get(name); ok {
+			share.Functions = append(share.Functions, f.String())
+			pending = append(pending, f.Uses()...)
+		}
+	}
+	slices.SortFunc(share.Variables, func(a, b goculator.Variable) int { return strings.Compare(a.Name, b.Name) })
+	slices.Sort(share.Functions)
+
+	share.ID = shareID(share)
+	return share, nil
+}
+
+// shareID derives the ID from the expression, variables and functions, so
+// sharing the same calculation again gives the same link.
+func shareID(s goculator.Share) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", s.Expression)
+	for _, v := range s.Variables {
+		fmt.Fprintf(h, "%s=%s\x00", v.Name, v.Expression)
+	}
+	for _, f := range s.Functions {
+		fmt.Fprintf(h, "%s\x00", f)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:8])
+}
+
+// absoluteURL returns the URL of the path on the host the request was made
+// to.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// SharedCalculation renders a shared calculation read-only, to anyone with
+// the link.
+func (a *App) SharedCalculation(w http.ResponseWriter, r *http.Request) {
+	share, err := a.Store.Share(r.Context(), r.PathValue("id"))
+	if errors.Is(err, goculator.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("share.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, share); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ForkShare adds the variables and functions of a shared calculation to the
+// session, replacing those of the same name, and opens the calculator with
+// its expression.
+func (a *App) ForkShare(w http.ResponseWriter, r *http.Request) {
+	share, err := a.Store.Share(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	sess := a.session(w, r)
+	if err := a.fork(r.Context(), sess, share); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	http.Redirect(w, r, "/?calc="+url.QueryEscape(share.Expression), http.StatusSeeOther)
+}
+
+// fork defines the functions and assigns the variables of the share in the
+// session. Both may refer to each other, so they are added until no more
+// succeed, like a session is restored.
+func (a *App) fork(ctx context.Context, sess *session, share goculator.Share) error {
+	defs := slices.Clone(share.Functions)
+	for progress := true; progress && len(defs) > 0; {
+		progress = false
+		pending := defs[:0]
+		for _, def := range defs {
+			f, err := goculator.ParseDefinition(def)
+			if err == nil {
+				err = sess.Functions.Define(f)
+			}
+			if err != nil {
+				pending = append(pending, def)
+				continue
+			}
+			if err := a.Store.SaveFunction(ctx, sess.ID, f.Name, f.String()); err != nil {
+				return err
+			}
+			progress = true
+		}
+		defs = pending
+	}
+
+	vars := slices.Clone(share.Variables)
+	for progress := true; progress && len(vars) > 0; {
+		progress = false
+		pending := vars[:0]
+		for _, v := range vars {
+			out, err := goculator.Evaluate(sess.context(ctx), v.Expression)
+			if err != nil {
+				pending = append(pending, v)
+				continue
+			}
+			if err := a.Store.SetVariable(ctx, sess.ID, v); err != nil {
+				return err
+			}
+			sess.SetVariable(v.Name, out)
+			progress = true
+		}
+		vars = pending
+	}
+
+	if len(defs) > 0 || len(vars) > 0 {
+		return fmt.Errorf("%d functions and %d variables of the share could not be added", len(defs), len(vars))
+	}
+	return nil
+}
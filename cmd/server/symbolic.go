@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/donseba/goculator"
+)
+
+// Symbolic renders the symbolic tab: the simplified input and its
+// derivative. Errors are shown inline instead of as a notification, the tab
+// refreshes with every calculation and most inputs have no derivative.
+func (a *App) Symbolic(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+
+	in := r.PostFormValue("calc")
+	if in == "" {
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	variable := strings.TrimSpace(r.PostFormValue("var"))
+	if variable == "" {
+		variable = "x"
+	}
+
+	tree, err := goculator.Parse(in)
+	if err != nil {
+		_, _ = h.Write([]byte(symbolicRow("error", err.Error(), "")))
+		return
+	}
+
+	sb := strings.Builder{}
+
+	simplified := goculator.Expression{Node: goculator.Simplify(tree.Root)}
+	sb.WriteString(symbolicRow("simplified", simplified.String(), simplified.Tree()))
+
+	label := fmt.Sprintf("d/d%s", variable)
+	if d, err := goculator.Derive(tree.Root, variable); err != nil {
+		sb.WriteString(symbolicRow(label, err.Error(), ""))
+	} else {
+		derivative := goculator.Expression{Node: goculator.Simplify(d)}
+		sb.WriteString(symbolicRow(label, derivative.String(), derivative.Tree()))
+	}
+
+	_, _ = h.Write([]byte(sb.String()))
+}
+
+// symbolicRow renders one labelled expression, with the node tree below it.
+func symbolicRow(label, expr, tree string) string {
+	return fmt.Sprintf(`<div class="flex justify-between items-baseline"><span class="text-gray-500 text-xs font-normal">%s</span><span>%s</span></div><div class="text-gray-400 text-xs font-normal font-mono">%s</div>`,
+		html.EscapeString(label), html.EscapeString(expr), html.EscapeString(tree))
+}
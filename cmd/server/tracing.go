@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span kinds as numbered by OpenTelemetry.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+)
+
+// span is a finished or running operation of a trace. It follows the
+// OpenTelemetry data model, so spans can be sent to any OTLP collector
+// without the OpenTelemetry SDK.
+type span struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Kind       int            `json:"kind"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// exporter sends finished spans somewhere.
+type exporter interface {
+	Export(ctx context.Context, spans []*span) error
+}
+
+type spanKey struct{}
+
+// tracer records spans for requests and, as goculator.Instrument, for
+// parsing, evaluation and builtin calls. Finished spans are exported in
+// batches, when the exporter falls behind spans are dropped and counted.
+type tracer struct {
+	exporter exporter
+	spans    chan *span
+	dropped  atomic.Uint64
+}
+
+func newTracer(e exporter) *tracer {
+	t := &tracer{exporter: e, spans: make(chan *span, 2048)}
+	go t.run()
+	return t
+}
+
+// Start implements goculator.Instrument.
+func (t *tracer) Start(ctx context.Context, operation string, attrs map[string]any) (context.Context, func(map[string]any, error)) {
+	ctx, s := t.start(ctx, operation, spanKindInternal, attrs)
+	return ctx, func(attrs map[string]any, err error) { t.end(s, attrs, err) }
+}
+
+// start starts a span, as a child of the span of ctx if there is one.
+func (t *tracer) start(ctx context.Context, name string, kind int, attrs map[string]any) (context.Context, *span) {
+	s := &span{Name: name, Kind: kind, Start: time.Now(), SpanID: randomID(8), Attributes: map[string]any{}}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.TraceID, s.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		s.TraceID = randomID(16)
+	}
+	for k, v := range attrs {
+		s.Attributes[k] = v
+	}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// end finishes the span and queues it for export.
+func (t *tracer) end(s *span, attrs map[string]any, err error) {
+	s.mu.Lock()
+	s.End = time.Now()
+	for k, v := range attrs {
+		s.Attributes[k] = v
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.mu.Unlock()
+
+	select {
+	case t.spans <- s:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of spans dropped so far.
+func (t *tracer) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+// run exports the finished spans every few seconds, or as soon as a batch
+// is full.
+func (t *tracer) run() {
+	const batchSize = 512
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	batch := make([]*span, 0, batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("exporting spans", "spans", len(batch), "err", err)
+		}
+		batch = make([]*span, 0, batchSize)
+	}
+
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) == batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		}
+	}
+}
+
+// middleware records a server span for every request. A W3C traceparent
+// header sent by the client makes the span part of the client's trace.
+func (t *tracer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if traceID, parentID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, spanKey{}, &span{TraceID: traceID, SpanID: parentID})
+		}
+
+		ctx, s := t.start(ctx, r.Method+" "+r.URL.Path, spanKindServer, map[string]any{
+			"http.request.method": r.Method,
+			"url.path":            r.URL.Path,
+			"client.address":      r.RemoteAddr,
+		})
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		var err error
+		if rec.status >= http.StatusInternalServerError {
+			err = fmt.Errorf("status %d", rec.status)
+		}
+		t.end(s, map[string]any{"http.response.status_code": rec.status}, err)
+	})
+}
+
+// parseTraceparent reads the trace and parent span id of a W3C trace
+// context header such as 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(h string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", "", false
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", "", false
+	}
+
+	return parts[1], parts[2], true
+}
+
+// traceID returns the id of the trace ctx belongs to, empty outside one.
+func traceID(ctx context.Context) string {
+	if s, ok := ctx.Value(spanKey{}).(*span); ok {
+		return s.TraceID
+	}
+	return ""
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// stdoutExporter writes every span as a line of JSON.
+type stdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (e *stdoutExporter) Export(ctx context.Context, spans []*span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// otlpExporter sends spans to an OpenTelemetry collector with OTLP over
+// HTTP, in its JSON encoding.
+type otlpExporter struct {
+	Endpoint string
+	Service  string
+	Client   *http.Client
+}
+
+func (e *otlpExporter) Export(ctx context.Context, spans []*span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// request builds an ExportTraceServiceRequest, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+func (e *otlpExporter) request(spans []*span) map[string]any {
+	list := make([]map[string]any, len(spans))
+	for i, s := range spans {
+		s.mu.Lock()
+		out := map[string]any{
+			"traceId":           s.TraceID,
+			"spanId":            s.SpanID,
+			"name":              s.Name,
+			"kind":              s.Kind,
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+		}
+		if s.ParentID != "" {
+			out["parentSpanId"] = s.ParentID
+		}
+		if s.Error != "" {
+			out["status"] = map[string]any{"code": 2, "message": s.Error}
+		}
+		s.mu.Unlock()
+
+		list[i] = out
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes(map[string]any{"service.name": e.Service}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/donseba/goculator"},
+				"spans": list,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes converts attributes into OTLP key values, integers are
+// encoded as strings like the JSON encoding of int64 requires.
+func otlpAttributes(attrs map[string]any) []any {
+	list := make([]any, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		list = append(list, map[string]any{"key": k, "value": value})
+	}
+	return list
+}
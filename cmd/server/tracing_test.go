@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTracerCountsDroppedSpans(t *testing.T) {
+	// no exporter runs, so the queue fills up
+	tr := &tracer{spans: make(chan *span, 2)}
+	for range 5 {
+		_, end := tr.Start(context.Background(), "goculator.call", nil)
+		end(nil, nil)
+	}
+
+	if got := tr.Dropped(); got != 3 {
+		t.Fatalf("got %d dropped spans, want 3", got)
+	}
+
+	stats := newMetrics()
+	stats.Tracer(tr.Dropped)
+
+	var b strings.Builder
+	stats.WriteTo(&b, newStreamManager())
+	if !strings.Contains(b.String(), "\ngoculator_trace_dropped_spans_total 3\n") {
+		t.Fatalf("dropped spans missing from the metrics:\n%s", b.String())
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header   string
+		traceID  string
+		parentID string
+		ok       bool
+	}{
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceID: "4bf92f3577b34da6a3ce929d0e0e4736", parentID: "00f067aa0ba902b7", ok: true},
+		{header: ""},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+		{header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			traceID, parentID, ok := parseTraceparent(tt.header)
+			if traceID != tt.traceID || parentID != tt.parentID || ok != tt.ok {
+				t.Fatalf("got %q, %q, %v, want %q, %q, %v", traceID, parentID, ok, tt.traceID, tt.parentID, tt.ok)
+			}
+		})
+	}
+}
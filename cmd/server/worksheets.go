@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donseba/goculator"
+)
+
+type worksheetPage struct {
+	ID       string
+	Name     string
+	Rows     template.HTML
+	List     template.HTML
+	History  template.HTML
+	Share    template.HTML
+	ReadOnly bool
+
+	// Revision is set when an earlier revision is loaded into the editor.
+	Revision int
+}
+
+// Worksheets renders the worksheets of the session, with the one of the
+// path loaded into the editor. The revision in the query loads an earlier
+// version of its lines.
+func (a *App) Worksheets(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+
+	list, err := a.Store.Worksheets(r.Context(), sess.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := worksheetPage{List: template.HTML(worksheetList(list))}
+
+	if id := r.PathValue("id"); id != "" {
+		ws, err := a.Store.Worksheet(r.Context(), sess.ID, id)
+		if errors.Is(err, goculator.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		lines := ws.Lines
+		if rev, err := strconv.Atoi(r.URL.Query().Get("revision")); err == nil && rev != ws.Revision {
+			var ok bool
+			if lines, ok = ws.AtRevision(rev); !ok {
+				http.NotFound(w, r)
+				return
+			}
+			page.Revision = rev
+		}
+
+		ctx, cancel := sheetContext(r)
+		defer cancel()
+
+		sheet := goculator.EvaluateSheet(ctx, lines)
+		sess.SetSheet(sheet)
+
+		page.ID, page.Name = ws.ID, ws.Name
+		page.Rows = template.HTML(sheetRows(sheet, false, -1))
+		page.History = template.HTML(revisionList(ws))
+		page.Share = template.HTML(shareLink(ws))
+	}
+
+	renderWorksheet(w, page)
+}
+
+// SharedWorksheet renders a shared worksheet read-only, to anyone with the
+// link.
+func (a *App) SharedWorksheet(w http.ResponseWriter, r *http.Request) {
+	ws, err := a.Store.SharedWorksheet(r.Context(), r.PathValue("id"))
+	if errors.Is(err, goculator.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := sheetContext(r)
+	defer cancel()
+
+	renderWorksheet(w, worksheetPage{
+		ID:       ws.ID,
+		Name:     ws.Name,
+		Rows:     template.HTML(sheetRows(goculator.EvaluateSheet(ctx, ws.Lines), true, -1)),
+		ReadOnly: true,
+	})
+}
+
+func renderWorksheet(w http.ResponseWriter, page worksheetPage) {
+	tmpl, err := template.ParseFiles("worksheet.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// sheetContext returns the context a worksheet is calculated in. A
+// worksheet only sees its own variables and functions, so it calculates the
+// same for everyone it is shared with.
+func sheetContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), *timeoutFlag)
+}
+
+// CreateWorksheet starts a worksheet with the lines posted, empty unless
+// it copies a shared worksheet, and opens it.
+func (a *App) CreateWorksheet(w http.ResponseWriter, r *http.Request) {
+	sess := a.session(w, r)
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	lines := r.PostForm["line"]
+	if id := r.PathValue("id"); id != "" {
+		shared, err := a.Store.SharedWorksheet(r.Context(), id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		name, lines = "copy of "+shared.Name, shared.Lines
+	}
+	if name == "" {
+		name = "untitled"
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+
+	now := time.Now()
+	ws := goculator.Worksheet{ID: randomID(8), Name: name, Created: now}
+	ws.Revise(lines, now)
+	if err := a.Store.SaveWorksheet(r.Context(), sess.ID, ws); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/worksheets/"+ws.ID, http.StatusSeeOther)
+}
+
+// SaveWorksheet saves the lines of the editor as a new revision and renders
+// the updated revision history.
+func (a *App) SaveWorksheet(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	sess := a.session(w, r)
+
+	ws, err := a.Store.Worksheet(r.Context(), sess.ID, r.PathValue("id"))
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	if name := strings.TrimSpace(r.PostFormValue("name")); name != "" {
+		ws.Name = name
+	}
+	changed := ws.Revise(r.PostForm["line"], time.Now())
+	if err := a.Store.SaveWorksheet(r.Context(), sess.ID, ws); err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte(revisionList(ws)))
+		return
+	}
+
+	if changed {
+		h.TriggerInfo(fmt.Sprintf("saved revision %d", ws.Revision))
+	} else {
+		h.TriggerInfo("no changes since the last revision")
+	}
+
+	_, _ = h.Write([]byte(revisionList(ws)))
+}
+
+// DeleteWorksheet removes a worksheet and returns to the list.
+func (a *App) DeleteWorksheet(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	sess := a.session(w, r)
+
+	if err := a.Store.DeleteWorksheet(r.Context(), sess.ID, r.PathValue("id")); err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	h.Redirect("/worksheets")
+}
+
+// ShareWorksheet turns sharing of a worksheet on or off and renders its
+// link.
+func (a *App) ShareWorksheet(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	sess := a.session(w, r)
+
+	ws, err := a.Store.Worksheet(r.Context(), sess.ID, r.PathValue("id"))
+	if err == nil {
+		ws.Shared = !ws.Shared
+		err = a.Store.SaveWorksheet(r.Context(), sess.ID, ws)
+	}
+	if err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+	}
+
+	_, _ = h.Write([]byte(shareLink(ws)))
+}
+
+// SheetCalc recalculates the worksheet after a line was edited. Only the
+// line and the lines depending on it are calculated again, the others keep
+// their result from the worksheet the session calculated last. It renders
+// the result of the line, and the results of the lines depending on it as
+// out-of-band swaps, the other lines are left as they are.
+func (a *App) SheetCalc(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	sess := a.session(w, r)
+
+	if err := r.ParseForm(); err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+	lines, names := r.PostForm["line"], r.PostForm["names"]
+
+	i, err := strconv.Atoi(r.URL.Query().Get("line"))
+	if err != nil || i < 0 || i >= len(lines) {
+		h.TriggerError("error: no such line")
+		_, _ = h.Write([]byte{})
+		return
+	}
+
+	ctx, cancel := sheetContext(r)
+	defer cancel()
+
+	// the name the line assigned before the edit changes as well
+	var previous []string
+	if i < len(names) {
+		previous = append(previous, names[i])
+	}
+
+	sheet := goculator.RecalculateSheet(ctx, sess.Sheet(), lines, i, previous...)
+	sess.SetSheet(sheet)
+
+	_, _ = h.Write([]byte(sheetResult(sheet[i])))
+	for _, j := range append([]int{i}, goculator.Dependents(sheet, i, previous...)...) {
+		if j != i {
+			fmt.Fprintf(h, `<div id="result-%d" class="%s" hx-swap-oob="true">%s</div>`, j, resultClass, sheetResult(sheet[j]))
+		}
+		fmt.Fprintf(h, `<input type="hidden" id="name-%d" name="names" value="%s" hx-swap-oob="true" />`, j, html.EscapeString(sheet[j].Name))
+	}
+}
+
+// SheetRows adds or removes a line of the worksheet and renders all lines
+// again.
+func (a *App) SheetRows(w http.ResponseWriter, r *http.Request) {
+	h := a.HTMX.NewHandler(w, r)
+	sess := a.session(w, r)
+
+	if err := r.ParseForm(); err != nil {
+		h.TriggerError(fmt.Sprintf("error: %v", err))
+		_, _ = h.Write([]byte{})
+		return
+	}
+	lines := slices.Clone(r.PostForm["line"])
+
+	focus := -1
+	if i, err := strconv.Atoi(r.URL.Query().Get("remove")); err == nil && i >= 0 && i < len(lines) {
+		lines = slices.Delete(lines, i, i+1)
+	} else {
+		lines = append(lines, "")
+		focus = len(lines) - 1
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+
+	ctx, cancel := sheetContext(r)
+	defer cancel()
+
+	sheet := goculator.EvaluateSheet(ctx, lines)
+	sess.SetSheet(sheet)
+
+	_, _ = h.Write([]byte(sheetRows(sheet, false, focus)))
+}
+
+const resultClass = "w-1/3 text-right font-mono text-sm p-1 truncate"
+
+// sheetRows renders the lines of a worksheet with their results in the
+// gutter, as inputs unless the worksheet is read-only. The line at focus is
+// focused once it is swapped in.
+func sheetRows(sheet []goculator.SheetLine, readOnly bool, focus int) string {
+	sb := strings.Builder{}
+	for i, l := range sheet {
+		sb.WriteString(`<div class="flex items-center border-b border-gray-100">`)
+
+		if readOnly {
+			fmt.Fprintf(&sb, `<div class="flex-1 font-mono p-1 whitespace-pre">%s</div>`, html.EscapeString(l.Input))
+		} else {
+			autofocus := ""
+			if i == focus {
+				autofocus = " autofocus"
+			}
+			fmt.Fprintf(&sb, `<input type="text" name="line" autocomplete="off" class="flex-1 font-mono bg-transparent p-1 outline-0" value="%s" hx-post="/worksheets/calc?line=%d" hx-trigger="keyup changed delay:300ms" hx-target="#result-%d"%s />`,
+				html.EscapeString(l.Input), i, i, autofocus)
+			fmt.Fprintf(&sb, `<input type="hidden" id="name-%d" name="names" value="%s" />`, i, html.EscapeString(l.Name))
+		}
+
+		fmt.Fprintf(&sb, `<div id="result-%d" class="%s">%s</div>`, i, resultClass, sheetResult(l))
+
+		if !readOnly {
+			fmt.Fprintf(&sb, `<button type="button" class="text-red-600 px-1" hx-post="/worksheets/rows?remove=%d" hx-target="#lines">×</button>`, i)
+		}
+		sb.WriteString(`</div>`)
+	}
+	return sb.String()
+}
+
+// sheetResult renders the result of a line for the gutter.
+func sheetResult(l goculator.SheetLine) string {
+	switch v := l.Value.(type) {
+	case nil:
+		if l.Err != nil {
+			return `<span class="text-red-600" title="` + html.EscapeString(l.Err.Error()) + `">` + html.EscapeString(l.Err.Error()) + `</span>`
+		}
+		return ""
+	case *goculator.Function:
+		return `<span class="text-gray-500">` + html.EscapeString(fmt.Sprintf("%s(%s)", v.Name, strings.Join(v.Params, ", "))) + `</span>`
+	}
+
+	return html.EscapeString(goculator.Format(l.Value))
+}
+
+// worksheetList renders the worksheets as links opening them.
+func worksheetList(list []goculator.Worksheet) string {
+	sb := strings.Builder{}
+	sb.WriteString(`<ul class="text-xs space-y-1">`)
+	for _, ws := range list {
+		fmt.Fprintf(&sb, `<li class="flex justify-between"><a class="underline" href="/worksheets/%s">%s</a><span class="text-gray-400">%s</span></li>`,
+			ws.ID, html.EscapeString(ws.Name), ws.Updated.Format(time.DateTime))
+	}
+	if len(list) == 0 {
+		sb.WriteString(`<li class="text-gray-400">no worksheets yet</li>`)
+	}
+	sb.WriteString(`</ul>`)
+	return sb.String()
+}
+
+// revisionList renders the revisions of a worksheet, the most recent first,
+// as links loading them into the editor.
+func revisionList(ws goculator.Worksheet) string {
+	sb := strings.Builder{}
+	sb.WriteString(`<ul id="revisions" class="text-xs space-y-1">`)
+	fmt.Fprintf(&sb, `<li class="flex justify-between"><a class="underline" href="/worksheets/%s">revision %d</a><span class="text-gray-400">%s</span></li>`,
+		ws.ID, ws.Revision, ws.Updated.Format(time.DateTime))
+	for i := len(ws.Revisions) - 1; i >= 0; i-- {
+		rev := ws.Revisions[i]
+		fmt.Fprintf(&sb, `<li class="flex justify-between"><a class="underline" href="/worksheets/%s?revision=%d">revision %d</a><span class="text-gray-400">%s</span></li>`,
+			ws.ID, rev.Number, rev.Number, rev.Saved.Format(time.DateTime))
+	}
+	sb.WriteString(`</ul>`)
+	return sb.String()
+}
+
+// shareLink renders the link of a shared worksheet and the button turning
+// sharing on or off.
+func shareLink(ws goculator.Worksheet) string {
+	if !ws.Shared {
+		return fmt.Sprintf(`<div id="share" class="text-xs"><button type="button" class="bg-gray-200 hover:bg-gray-300 rounded-md px-2" hx-post="/worksheets/%s/share" hx-target="#share" hx-swap="outerHTML">share</button></div>`, ws.ID)
+	}
+
+	return fmt.Sprintf(`<div id="share" class="text-xs space-x-2"><a class="underline" href="/w/%s">/w/%s</a><button type="button" class="bg-gray-200 hover:bg-gray-300 rounded-md px-2" hx-post="/worksheets/%s/share" hx-target="#share" hx-swap="outerHTML">stop sharing</button></div>`,
+		ws.ID, ws.ID, ws.ID)
+}
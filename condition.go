@@ -0,0 +1,55 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+
+	"github.com/donseba/expronaut"
+)
+
+// Case is a set of variables to test a condition with and the outcome the
+// condition should have for them.
+type Case struct {
+	Name      string         `json:"name,omitempty"`
+	Variables map[string]any `json:"variables"`
+	Expect    bool           `json:"expect"`
+}
+
+// CaseResult is the outcome of a condition for a Case. NotCondition is set
+// when the condition evaluated to something other than a boolean, the value
+// it evaluated to is then part of Error.
+type CaseResult struct {
+	Case
+	Got          bool   `json:"got"`
+	Pass         bool   `json:"pass"`
+	NotCondition bool   `json:"not_condition,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// CheckCondition evaluates the condition with EvaluateBool for every case,
+// the way expronaut.Exp evaluates it inside a template. Only a condition
+// that does not parse is an error, the failure of a single case is part of
+// its result.
+func CheckCondition(ctx context.Context, condition string, cases []Case) ([]CaseResult, error) {
+	if _, err := Parse(condition); err != nil {
+		return nil, err
+	}
+
+	results := make([]CaseResult, len(cases))
+	for i, c := range cases {
+		res := CaseResult{Case: c}
+
+		got, err := EvaluateBool(expronaut.SetVariables(ctx, c.Variables), condition)
+		if err != nil {
+			res.Error = err.Error()
+			res.NotCondition = errors.Is(err, ErrNotCondition)
+		} else {
+			res.Got = got
+			res.Pass = got == c.Expect
+		}
+
+		results[i] = res
+	}
+
+	return results, nil
+}
@@ -0,0 +1,56 @@
+package goculator
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckCondition(t *testing.T) {
+	cases := []Case{
+		{Name: "adult", Variables: map[string]any{"age": 30, "country": "NL"}, Expect: true},
+		{Name: "minor", Variables: map[string]any{"age": 12, "country": "NL"}, Expect: false},
+		{Name: "wrong expectation", Variables: map[string]any{"age": 40, "country": "BE"}, Expect: true},
+		{Name: "missing variable", Variables: map[string]any{"country": "NL"}},
+	}
+
+	tests := []struct {
+		condition string
+		// outcome per case: pass, fail, error or not a condition
+		want    []string
+		wantErr bool
+	}{
+		{condition: `age >= 18 && country == "NL"`, want: []string{"pass", "pass", "fail", "error"}},
+		{condition: "age + 1", want: []string{"not a condition", "not a condition", "not a condition", "error"}},
+		{condition: "age >=", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			results, err := CheckCondition(context.Background(), tt.condition, cases)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, res := range results {
+				got := "fail"
+				switch {
+				case res.NotCondition:
+					got = "not a condition"
+				case res.Error != "":
+					got = "error"
+				case res.Pass:
+					got = "pass"
+				}
+				if got != tt.want[i] {
+					t.Errorf("%s: got %s, want %s", res.Name, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
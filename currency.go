@@ -0,0 +1,436 @@
+package goculator
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donseba/expronaut"
+)
+
+// ErrNoRates is returned when a currency conversion is attempted without a
+// rate source, or when the source does not know one of the currencies.
+var ErrNoRates = errors.New("no exchange rate")
+
+type (
+	// Rates is an exchange rate table. Every rate is the amount of that
+	// currency one unit of Base buys.
+	Rates struct {
+		Base  string             `json:"base"`
+		AsOf  time.Time          `json:"as_of"`
+		Rates map[string]float64 `json:"rates"`
+	}
+
+	// RateSource provides exchange rates. Implementations decide how fresh
+	// the returned table is, the evaluator calls Rates for every lookup.
+	RateSource interface {
+		Rates(ctx context.Context) (*Rates, error)
+	}
+)
+
+var (
+	rateSourceMu sync.RWMutex
+	rateSource   RateSource
+)
+
+// SetRateSource sets the source used for currency values and conversions.
+func SetRateSource(src RateSource) {
+	rateSourceMu.Lock()
+	defer rateSourceMu.Unlock()
+
+	rateSource = src
+}
+
+func currentRates(ctx context.Context) (*Rates, error) {
+	rateSourceMu.RLock()
+	src := rateSource
+	rateSourceMu.RUnlock()
+
+	if src == nil {
+		return nil, fmt.Errorf("%w: no rate source configured", ErrNoRates)
+	}
+
+	return src.Rates(ctx)
+}
+
+// Has reports whether the table knows the currency.
+func (r *Rates) Has(code string) bool {
+	if code == r.Base {
+		return true
+	}
+	_, ok := r.Rates[code]
+	return ok
+}
+
+// Rate returns how much of currency to one unit of currency from buys.
+func (r *Rates) Rate(from, to string) (float64, error) {
+	rate := func(code string) (float64, error) {
+		if code == r.Base {
+			return 1, nil
+		}
+		v, ok := r.Rates[code]
+		if !ok || v <= 0 {
+			return 0, fmt.Errorf("%w for %s", ErrNoRates, code)
+		}
+		return v, nil
+	}
+
+	f, err := rate(from)
+	if err != nil {
+		return 0, err
+	}
+	t, err := rate(to)
+	if err != nil {
+		return 0, err
+	}
+
+	return t / f, nil
+}
+
+// LookupCurrency resolves an ISO 4217 code known to the rate source to one
+// unit of that currency.
+func LookupCurrency(ctx context.Context, code string) (Money, bool) {
+	if len(code) != 3 || strings.ToUpper(code) != code {
+		return Money{}, false
+	}
+
+	rates, err := currentRates(ctx)
+	if err != nil || !rates.Has(code) {
+		return Money{}, false
+	}
+
+	return Money{Amount: 1, Currency: code}, true
+}
+
+// Money is an amount in a currency. AsOf is set on the result of a
+// conversion to the date of the rates that were used.
+type Money struct {
+	Amount   float64
+	Currency string
+	AsOf     time.Time
+}
+
+func (m Money) String() string {
+	return strconv.FormatFloat(m.Amount, 'f', 2, 64) + " " + m.Currency
+}
+
+// Operate implements Operand. Amounts in different currencies have to be
+// converted explicitly before they can be combined.
+func (m Money) Operate(ctx context.Context, op expronaut.TokenType, other any, reverse bool) (any, error) {
+	var o Money
+	switch v := other.(type) {
+	case Money:
+		o = v
+	case int:
+		o = Money{Amount: float64(v)}
+	case float64:
+		o = Money{Amount: v}
+	default:
+		return nil, ErrUnsupported
+	}
+
+	l, r := m, o
+	if reverse {
+		l, r = o, m
+	}
+
+	same := l.Currency == r.Currency
+	mixed := l.Currency != "" && r.Currency != "" && !same
+
+	switch op {
+	case expronaut.TokenTypePlus, expronaut.TokenTypeMinus:
+		if !same {
+			if mixed {
+				return nil, fmt.Errorf("cannot %s %s and %s, convert one of them first", verbs[op], l.Currency, r.Currency)
+			}
+			return nil, fmt.Errorf("cannot %s a plain number and an amount in %s", verbs[op], m.Currency)
+		}
+		if op == expronaut.TokenTypePlus {
+			return Money{Amount: l.Amount + r.Amount, Currency: l.Currency}, nil
+		}
+		return Money{Amount: l.Amount - r.Amount, Currency: l.Currency}, nil
+	case expronaut.TokenTypeMultiply:
+		if l.Currency != "" && r.Currency != "" {
+			return nil, fmt.Errorf("cannot multiply two amounts of money")
+		}
+		return Money{Amount: l.Amount * r.Amount, Currency: l.Currency + r.Currency}, nil
+	case expronaut.TokenTypeDivide:
+		switch {
+		case same:
+			// EUR / EUR is a plain ratio
+			return l.Amount / r.Amount, nil
+		case r.Currency == "":
+			return Money{Amount: l.Amount / r.Amount, Currency: l.Currency}, nil
+		}
+		return nil, fmt.Errorf("cannot divide %s by %s", l.Currency, r.Currency)
+	case expronaut.TokenTypeEqual, expronaut.TokenTypeNotEqual,
+		expronaut.TokenTypeLessThan, expronaut.TokenTypeLessThanOrEqual,
+		expronaut.TokenTypeGreaterThan, expronaut.TokenTypeGreaterThanOrEqual:
+		if !same {
+			return nil, fmt.Errorf("cannot compare %s and %s, convert one of them first", l.Currency, r.Currency)
+		}
+		node := &expronaut.BinaryOperationNode{Left: valueNode{l.Amount}, Operator: op, Right: valueNode{r.Amount}}
+		return node.Evaluate(ctx)
+	}
+
+	return nil, fmt.Errorf("operator %s is not supported for money", op)
+}
+
+// Convert implements Converter for "120 EUR to USD".
+func (m Money) Convert(ctx context.Context, target any) (any, error) {
+	t, ok := target.(Money)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	rates, err := currentRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := rates.Rate(m.Currency, t.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return Money{Amount: m.Amount * rate / t.Amount, Currency: t.Currency, AsOf: rates.AsOf}, nil
+}
+
+// Apply implements Applier for the builtins that make sense for money.
+func (m Money) Apply(ctx context.Context, name string, args []any) (any, error) {
+	switch name {
+	case "abs", "round", "floor", "ceil":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s function expects a single argument", name)
+		}
+
+		fn := map[string]func(float64) float64{"abs": math.Abs, "round": math.Round, "floor": math.Floor, "ceil": math.Ceil}[name]
+		return Money{Amount: fn(m.Amount), Currency: m.Currency, AsOf: m.AsOf}, nil
+	case "min", "max":
+		var best Money
+		for i, arg := range args {
+			a, ok := arg.(Money)
+			if !ok || a.Currency != m.Currency {
+				return nil, fmt.Errorf("%s function expects amounts in the same currency", name)
+			}
+			if i == 0 || (name == "min" && a.Amount < best.Amount) || (name == "max" && a.Amount > best.Amount) {
+				best = a
+			}
+		}
+		return best, nil
+	}
+
+	return nil, fmt.Errorf("%s function does not accept money", name)
+}
+
+// FileSource reads rates from a JSON or CSV file and reloads it whenever
+// the modification time changes, so the file can be replaced while the
+// server runs.
+//
+// JSON files hold a single Rates object:
+//
+//	{"base": "EUR", "as_of": "2026-10-16T16:00:00Z", "rates": {"USD": 1.08}}
+//
+// CSV files have a header and one row per rate:
+//
+//	base,currency,rate,as_of
+//	EUR,USD,1.08,2026-10-16T16:00:00Z
+type FileSource struct {
+	Path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	rates   *Rates
+}
+
+// NewFileSource returns a source for the file at path and loads it once to
+// report errors early.
+func NewFileSource(path string) (*FileSource, error) {
+	fs := &FileSource{Path: path}
+	if _, err := fs.Rates(context.Background()); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// Rates implements RateSource. When a reload fails the previously loaded
+// table is kept.
+func (fs *FileSource) Rates(ctx context.Context) (*Rates, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := os.Stat(fs.Path)
+	if err != nil {
+		if fs.rates != nil {
+			return fs.rates, nil
+		}
+		return nil, err
+	}
+
+	if fs.rates != nil && info.ModTime().Equal(fs.modTime) {
+		return fs.rates, nil
+	}
+
+	rates, err := fs.load()
+	if err != nil {
+		if fs.rates != nil {
+			return fs.rates, nil
+		}
+		return nil, err
+	}
+
+	fs.rates, fs.modTime = rates, info.ModTime()
+	return fs.rates, nil
+}
+
+func (fs *FileSource) load() (*Rates, error) {
+	f, err := os.Open(fs.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(fs.Path), ".csv") {
+		return decodeRatesCSV(f)
+	}
+
+	return decodeRatesJSON(f)
+}
+
+func decodeRatesJSON(r io.Reader) (*Rates, error) {
+	var rates Rates
+	if err := json.NewDecoder(r).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("decoding rates: %w", err)
+	}
+
+	if rates.Base == "" {
+		return nil, fmt.Errorf("decoding rates: missing base currency")
+	}
+
+	return &rates, nil
+}
+
+func decodeRatesCSV(r io.Reader) (*Rates, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("decoding rates: %w", err)
+	}
+
+	if len(records) < 2 {
+		return nil, fmt.Errorf("decoding rates: no rates found")
+	}
+
+	rates := &Rates{Rates: make(map[string]float64, len(records)-1)}
+	for i, record := range records[1:] {
+		if len(record) != 4 {
+			return nil, fmt.Errorf("decoding rates: line %d: expected 4 fields, got %d", i+2, len(record))
+		}
+
+		base, code := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if rates.Base == "" {
+			rates.Base = base
+		} else if rates.Base != base {
+			return nil, fmt.Errorf("decoding rates: line %d: base %s differs from %s", i+2, base, rates.Base)
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("decoding rates: line %d: %w", i+2, err)
+		}
+
+		asOf, err := time.Parse(time.RFC3339, strings.TrimSpace(record[3]))
+		if err != nil {
+			return nil, fmt.Errorf("decoding rates: line %d: %w", i+2, err)
+		}
+
+		rates.Rates[code] = rate
+		if asOf.After(rates.AsOf) {
+			rates.AsOf = asOf
+		}
+	}
+
+	return rates, nil
+}
+
+// HTTPSource fetches rates in the JSON file format from a URL, for example
+// a local stand-in for an external rate provider. Responses are cached for
+// TTL.
+type HTTPSource struct {
+	URL    string
+	Client *http.Client
+	TTL    time.Duration
+
+	mu      sync.Mutex
+	fetched time.Time
+	rates   *Rates
+	hits    uint64
+	misses  uint64
+}
+
+// Rates implements RateSource. When a refresh fails the previously fetched
+// table is kept.
+func (hs *HTTPSource) Rates(ctx context.Context) (*Rates, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.rates != nil && time.Since(hs.fetched) < hs.TTL {
+		hs.hits++
+		return hs.rates, nil
+	}
+	hs.misses++
+
+	rates, err := hs.fetch(ctx)
+	if err != nil {
+		if hs.rates != nil {
+			return hs.rates, nil
+		}
+		return nil, err
+	}
+
+	hs.rates, hs.fetched = rates, time.Now()
+	return hs.rates, nil
+}
+
+// CacheStats returns how often Rates was answered from the cached table and
+// how often the table had to be fetched.
+func (hs *HTTPSource) CacheStats() (hits, misses uint64) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	return hs.hits, hs.misses
+}
+
+func (hs *HTTPSource) fetch(ctx context.Context) (*Rates, error) {
+	client := hs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching rates: unexpected status %s", resp.Status)
+	}
+
+	return decodeRatesJSON(resp.Body)
+}
@@ -0,0 +1,189 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticRates is a rate source that always returns the same table.
+type staticRates struct {
+	rates Rates
+}
+
+func (s *staticRates) Rates(ctx context.Context) (*Rates, error) {
+	return &s.rates, nil
+}
+
+// useRates sets the rate source for the test.
+func useRates(t *testing.T, src RateSource) {
+	SetRateSource(src)
+	t.Cleanup(func() { SetRateSource(nil) })
+}
+
+func TestCurrencyEvaluate(t *testing.T) {
+	useRates(t, &staticRates{Rates{Base: "EUR", Rates: map[string]float64{"USD": 1.08, "JPY": 160}}})
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "120 EUR to USD", want: "129.60 USD"},
+		{input: "108 USD in EUR", want: "100.00 EUR"},
+		{input: "1 USD to JPY", want: "148.15 JPY"},
+		{input: "10 EUR + 5 EUR", want: "15.00 EUR"},
+		{input: "3 * 10 EUR", want: "30.00 EUR"},
+		{input: "10 EUR / 4 EUR", want: "2.5"},
+		{input: "round(10.4 EUR)", want: "10.00 EUR"},
+		{input: "max(1 EUR, 3 EUR, 2 EUR)", want: "3.00 EUR"},
+		{input: "10 EUR > 5 EUR", want: "true"},
+		{input: "10 EUR + 5 USD", wantErr: true},
+		{input: "10 EUR + 5", wantErr: true},
+		{input: "10 EUR * 5 EUR", wantErr: true},
+		{input: "10 EUR > 5 USD", wantErr: true},
+		{input: "sqrt(10 EUR)", wantErr: true},
+		// GBP is not in the table, so it is not a currency at all
+		{input: "10 EUR to GBP", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", Format(out))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatesRate(t *testing.T) {
+	rates := &Rates{Base: "EUR", Rates: map[string]float64{"USD": 2, "BAD": 0}}
+
+	tests := []struct {
+		from, to string
+		want     float64
+		err      error
+	}{
+		{from: "EUR", to: "USD", want: 2},
+		{from: "USD", to: "EUR", want: 0.5},
+		{from: "EUR", to: "EUR", want: 1},
+		{from: "EUR", to: "GBP", err: ErrNoRates},
+		{from: "BAD", to: "EUR", err: ErrNoRates},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" "+tt.to, func(t *testing.T) {
+			got, err := rates.Rate(tt.from, tt.to)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoRateSource(t *testing.T) {
+	useRates(t, nil)
+
+	if _, err := Evaluate(context.Background(), "10 EUR"); err == nil {
+		t.Fatal("got no error without a rate source")
+	}
+}
+
+func TestDecodeRates(t *testing.T) {
+	tests := []struct {
+		name    string
+		decode  func(string) (*Rates, error)
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name:   "json",
+			decode: func(s string) (*Rates, error) { return decodeRatesJSON(strings.NewReader(s)) },
+			input:  `{"base": "EUR", "as_of": "2026-10-16T16:00:00Z", "rates": {"USD": 1.08}}`,
+			want:   1.08,
+		},
+		{
+			name:    "json without base",
+			decode:  func(s string) (*Rates, error) { return decodeRatesJSON(strings.NewReader(s)) },
+			input:   `{"rates": {"USD": 1.08}}`,
+			wantErr: true,
+		},
+		{
+			name:   "csv",
+			decode: func(s string) (*Rates, error) { return decodeRatesCSV(strings.NewReader(s)) },
+			input:  "base,currency,rate,as_of\nEUR,USD,1.08,2026-10-16T16:00:00Z\n",
+			want:   1.08,
+		},
+		{
+			name:    "csv with two bases",
+			decode:  func(s string) (*Rates, error) { return decodeRatesCSV(strings.NewReader(s)) },
+			input:   "base,currency,rate,as_of\nEUR,USD,1.08,2026-10-16T16:00:00Z\nUSD,JPY,150,2026-10-16T16:00:00Z\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv with a bad rate",
+			decode:  func(s string) (*Rates, error) { return decodeRatesCSV(strings.NewReader(s)) },
+			input:   "base,currency,rate,as_of\nEUR,USD,lots,2026-10-16T16:00:00Z\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := tt.decode(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rates.Base != "EUR" || rates.Rates["USD"] != tt.want {
+				t.Fatalf("got %+v", rates)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceCaches(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"base": "EUR", "rates": {"USD": 1.08}}`))
+	}))
+	defer srv.Close()
+
+	hs := &HTTPSource{URL: srv.URL, TTL: time.Hour}
+	for range 3 {
+		if _, err := hs.Rates(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("got %d requests, want 1", requests)
+	}
+	if hits, misses := hs.CacheStats(); hits != 2 || misses != 1 {
+		t.Fatalf("got %d hits and %d misses, want 2 and 1", hits, misses)
+	}
+}
@@ -0,0 +1,169 @@
+package goculator
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// FunctionDoc describes a function for help, completion and signature
+// hints. Args name the arguments in order, a trailing "..." marks a
+// variadic argument and brackets an optional one.
+type FunctionDoc struct {
+	Name        string   `json:"name"`
+	Category    string   `json:"category"`
+	Args        []string `json:"args"`
+	Returns     string   `json:"returns"`
+	Description string   `json:"description"`
+}
+
+// Signature returns the function as it is called, such as
+// "hypot(a, b) number".
+func (d FunctionDoc) Signature() string {
+	return d.Name + "(" + strings.Join(d.Args, ", ") + ") " + d.Returns
+}
+
+var (
+	functionDocsMu sync.RWMutex
+	functionDocs   = map[string]FunctionDoc{}
+)
+
+// DocumentFunction adds the documentation of a builtin, for functions
+// registered with expronaut.RegisterFunction or RegisterLazyFunction.
+func DocumentFunction(doc FunctionDoc) {
+	functionDocsMu.Lock()
+	defer functionDocsMu.Unlock()
+
+	functionDocs[doc.Name] = doc
+}
+
+// BuiltinDocs returns the documentation of every builtin, sorted by name.
+// Builtins nobody documented are in the category other.
+func BuiltinDocs() []FunctionDoc {
+	functionDocsMu.RLock()
+	defer functionDocsMu.RUnlock()
+
+	names := Builtins()
+	docs := make([]FunctionDoc, len(names))
+	for i, name := range names {
+		doc, ok := functionDocs[name]
+		if !ok {
+			doc = FunctionDoc{Name: name, Category: "other", Args: []string{"args..."}, Returns: "any"}
+		}
+		docs[i] = doc
+	}
+	return docs
+}
+
+// Doc describes the user-defined function, its body serves as description.
+func (f *Function) Doc() FunctionDoc {
+	return FunctionDoc{
+		Name:        f.Name,
+		Category:    "user",
+		Args:        slices.Clone(f.Params),
+		Returns:     "any",
+		Description: f.String(),
+	}
+}
+
+func init() {
+	for _, doc := range []FunctionDoc{
+		// arithmetic
+		{"add", "arithmetic", []string{"a", "b"}, "number", "Adds two numbers, or joins two strings."},
+		{"sub", "arithmetic", []string{"a", "b"}, "number", "Subtracts b from a."},
+		{"mul", "arithmetic", []string{"a", "b"}, "number", "Multiplies two numbers."},
+		{"div", "arithmetic", []string{"a", "b"}, "number", "Divides a by b, integer division when both are integers."},
+		{"divint", "arithmetic", []string{"a", "b"}, "int", "Divides a by b and drops the fraction."},
+		{"mod", "arithmetic", []string{"a", "b"}, "number", "Returns the remainder of dividing a by b."},
+		{"double", "arithmetic", []string{"x"}, "number", "Multiplies a number by two."},
+		{"abs", "arithmetic", []string{"x"}, "number", "Returns the absolute value of a number."},
+		{"pow", "arithmetic", []string{"x", "y"}, "number", "Raises x to the power y."},
+		{"exp", "arithmetic", []string{"x", "y"}, "number", "Raises x to the power y, like pow."},
+		{"sqrt", "arithmetic", []string{"x"}, "number", "Returns the square root of a number."},
+		{"root", "arithmetic", []string{"x", "n"}, "number", "Returns the nth root of x."},
+		{"hypot", "arithmetic", []string{"a", "b"}, "number", "Returns the hypotenuse of a right triangle with sides a and b."},
+
+		// logarithms
+		{"log", "logarithm", []string{"x", "base"}, "number", "Returns the logarithm of x to the base."},
+		{"ln", "logarithm", []string{"x"}, "number", "Returns the natural logarithm of x."},
+		{"log10", "logarithm", []string{"x"}, "number", "Returns the base 10 logarithm of x."},
+		{"log2", "logarithm", []string{"x"}, "number", "Returns the base 2 logarithm of x."},
+
+		// rounding
+		{"ceil", "rounding", []string{"x"}, "int", "Rounds a number up to an integer."},
+		{"floor", "rounding", []string{"x"}, "int", "Rounds a number down to an integer."},
+		{"round", "rounding", []string{"x"}, "int", "Rounds a number to the nearest integer."},
+
+		// trigonometry
+		{"sin", "trigonometry", []string{"angle"}, "number", "Returns the sine of an angle in radians."},
+		{"cos", "trigonometry", []string{"angle"}, "number", "Returns the cosine of an angle in radians."},
+		{"tan", "trigonometry", []string{"angle"}, "number", "Returns the tangent of an angle in radians."},
+		{"asin", "trigonometry", []string{"x"}, "number", "Returns the arc sine of x in radians."},
+		{"acos", "trigonometry", []string{"x"}, "number", "Returns the arc cosine of x in radians."},
+		{"atan", "trigonometry", []string{"x"}, "number", "Returns the arc tangent of x in radians."},
+		{"sinh", "trigonometry", []string{"x"}, "number", "Returns the hyperbolic sine of x."},
+		{"cosh", "trigonometry", []string{"x"}, "number", "Returns the hyperbolic cosine of x."},
+		{"tanh", "trigonometry", []string{"x"}, "number", "Returns the hyperbolic tangent of x."},
+		{"deg2rad", "trigonometry", []string{"degrees"}, "number", "Converts degrees to radians."},
+		{"rad2deg", "trigonometry", []string{"radians"}, "number", "Converts radians to degrees."},
+
+		// statistics
+		{"sum", "statistics", []string{"numbers..."}, "number", "Adds up the numbers."},
+		{"mean", "statistics", []string{"numbers..."}, "number", "Returns the average of the numbers."},
+		{"median", "statistics", []string{"numbers..."}, "number", "Returns the middle value of the numbers."},
+		{"mode", "statistics", []string{"numbers..."}, "number", "Returns the most frequent of the numbers."},
+		{"min", "statistics", []string{"numbers..."}, "number", "Returns the smallest of the numbers."},
+		{"max", "statistics", []string{"numbers..."}, "number", "Returns the largest of the numbers."},
+		{"stddev", "statistics", []string{"numbers..."}, "number", "Returns the standard deviation of the numbers."},
+		{"variance", "statistics", []string{"numbers..."}, "number", "Returns the variance of at least two numbers."},
+
+		// lists and strings
+		{"len", "list", []string{"list"}, "int", "Returns the length of a list or string."},
+		{"slice", "list", []string{"list", "start", "end"}, "list", "Returns the elements from start up to end."},
+		{"sort", "list", []string{"list"}, "list", "Sorts a list."},
+		{"reverse", "list", []string{"list"}, "list", "Reverses a list or string."},
+		{"unique", "list", []string{"list"}, "list", "Drops repeated elements of a list."},
+		{"shuffle", "list", []string{"list"}, "list", "Puts the elements of a list in random order."},
+		{"filter", "list", []string{"list", "condition"}, "list", "Keeps the elements x for which the condition string holds."},
+		{"map", "list", []string{"list", "expression"}, "list", "Calculates the expression string for every element _x at index _i."},
+		{"reduce", "list", []string{"list", "function", "[initial]"}, "any", "Combines the elements with a function such as \"add\"."},
+		{"concat", "string", []string{"strings..."}, "string", "Joins two or more strings."},
+
+		// random
+		{"rand", "random", []string{"type", "[n]"}, "number", "Returns a random \"int\" or \"float64\", below n when given."},
+
+		// dates and times
+		{"date", "date", []string{"text"}, "date", "Parses a date such as \"2024-03-17\"."},
+		{"time", "date", []string{"text"}, "date", "Parses a time such as \"15:04:05\"."},
+		{"datetime", "date", []string{"text"}, "date", "Parses a date and time such as \"2024-03-17 15:04:05\"."},
+		{"diffdate", "date", []string{"a", "b"}, "duration", "Returns the time between two dates."},
+		{"difftime", "date", []string{"a", "b"}, "duration", "Returns the time between two times."},
+
+		// matrices
+		{"det", "matrix", []string{"m"}, "number", "Returns the determinant of a square matrix."},
+		{"inv", "matrix", []string{"m"}, "matrix", "Returns the inverse of a square matrix."},
+		{"transpose", "matrix", []string{"m"}, "matrix", "Swaps the rows and columns of a matrix."},
+		{"eig", "matrix", []string{"m"}, "vector", "Returns the eigenvalues of a symmetric matrix."},
+		{"dot", "matrix", []string{"a", "b"}, "number", "Returns the dot product of two vectors."},
+		{"cross", "matrix", []string{"a", "b"}, "vector", "Returns the cross product of two vectors of length 3."},
+		{"identity", "matrix", []string{"n"}, "matrix", "Returns the n by n identity matrix."},
+
+		// calculus
+		{"diff", "calculus", []string{"expr", "x", "[at]"}, "number", "Differentiates expr to x at a point, or symbolically without one."},
+		{"integrate", "calculus", []string{"expr", "x", "a", "b"}, "number", "Integrates expr over x from a to b."},
+		{"limit", "calculus", []string{"expr", "x", "at"}, "number", "Returns the limit of expr as x approaches at."},
+		{"sum_series", "calculus", []string{"expr", "n", "from", "[to]"}, "number", "Sums expr over n from from to to, or to infinity."},
+
+		// solving and symbolic math
+		{"solve", "solver", []string{"equation", "x", "guess"}, "number", "Solves an equation such as \"x**2 == 2\" for x near the guess, or a linear system solve(A, b)."},
+		{"roots", "solver", []string{"expr", "x", "a", "b"}, "list", "Returns every root of expr for x between a and b."},
+		{"simplify", "symbolic", []string{"expr"}, "expression", "Simplifies an expression without calculating it."},
+		{"plot", "plot", []string{"expr", "x", "from", "to"}, "plot", "Plots expr, or a list of expressions, over x from from to to."},
+
+		// AI
+		{"ai", "ai", []string{"provider", "prompt..."}, "string", "Asks an AI provider such as \"gpt\"."},
+		{"predict", "ai", []string{"provider", "text"}, "string", "Lets an AI provider continue the text."},
+	} {
+		functionDocs[doc.Name] = doc
+	}
+}
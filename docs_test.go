@@ -0,0 +1,112 @@
+package goculator
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestFunctionDocSignature(t *testing.T) {
+	tests := []struct {
+		doc  FunctionDoc
+		want string
+	}{
+		{doc: FunctionDoc{Name: "hypot", Args: []string{"a", "b"}, Returns: "number"}, want: "hypot(a, b) number"},
+		{doc: FunctionDoc{Name: "concat", Args: []string{"strings..."}, Returns: "string"}, want: "concat(strings...) string"},
+		{doc: FunctionDoc{Name: "pi", Returns: "number"}, want: "pi() number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.doc.Signature(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltinDocs(t *testing.T) {
+	docs := BuiltinDocs()
+
+	names := make([]string, len(docs))
+	for i, doc := range docs {
+		names[i] = doc.Name
+	}
+	if !slices.Equal(names, Builtins()) {
+		t.Fatalf("got %v, want the builtins %v", names, Builtins())
+	}
+
+	tests := []struct {
+		name     string
+		category string
+	}{
+		{name: "hypot", category: "arithmetic"},
+		{name: "integrate", category: "calculus"},
+		{name: "plot", category: "plot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := slices.Index(names, tt.name)
+			if i < 0 {
+				t.Fatal("not listed")
+			}
+			if doc := docs[i]; doc.Category != tt.category || doc.Description == "" {
+				t.Fatalf("got %+v, want the category %s and a description", doc, tt.category)
+			}
+		})
+	}
+}
+
+func TestFunctionDoc(t *testing.T) {
+	f, err := ParseDefinition("area(w, h) = w * h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := f.Doc()
+	if got, want := doc.Signature(), "area(w, h) any"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if doc.Category != "user" || doc.Description != f.String() {
+		t.Fatalf("got %+v", doc)
+	}
+
+	// the doc has its own arguments
+	doc.Args[0] = "x"
+	if f.Params[0] != "w" {
+		t.Fatal("changing the doc changed the function")
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	fs := NewFunctions()
+	f, _ := ParseDefinition("mine(x) = x")
+	if err := fs.Define(f); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithFunctions(context.Background(), fs)
+	ctx = WithFunctionPolicy(ctx, func(name string) bool { return name == "sqrt" })
+
+	tests := []struct {
+		ctx  context.Context
+		name string
+		want bool
+	}{
+		{ctx: ctx, name: "sqrt", want: true},
+		{ctx: ctx, name: "sin"},
+		// functions defined by the user are always allowed
+		{ctx: ctx, name: "mine", want: true},
+		// without a policy everything is
+		{ctx: context.Background(), name: "sin", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allowed(tt.ctx, tt.name); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
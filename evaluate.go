@@ -0,0 +1,444 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+var (
+	// ErrUnsupported is returned by Operand, Applier and Converter
+	// implementations to let the evaluator fall back to the next strategy.
+	ErrUnsupported = errors.New("unsupported operation")
+
+	// ErrTypeMismatch is returned when an operator cannot be applied to the
+	// types of its operands.
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrDivisionByZero is returned for integer division by zero, which
+	// would otherwise panic inside expronaut.
+	ErrDivisionByZero = errors.New("division by zero")
+
+	// ErrNotCondition is returned by EvaluateBool when the input evaluates
+	// to something other than a boolean.
+	ErrNotCondition = errors.New("expected a condition")
+
+	// ErrUnknownFunction is returned when an expression calls a function
+	// that is neither a builtin nor defined by the user.
+	ErrUnknownFunction = errors.New("unknown function")
+
+	// ErrUndefinedVariable is returned for an identifier that is neither a
+	// variable, a unit nor a currency.
+	ErrUndefinedVariable = errors.New("not defined")
+
+	// ErrInternal wraps a panic recovered while evaluating, such as one of
+	// an expronaut builtin called with arguments it does not expect.
+	ErrInternal = errors.New("internal error")
+)
+
+type (
+	// Operand is implemented by values that define their own arithmetic,
+	// such as quantities with units. When reverse is set the receiver is
+	// the right-hand side of the operation.
+	Operand interface {
+		Operate(ctx context.Context, op expronaut.TokenType, other any, reverse bool) (any, error)
+	}
+
+	// Applier is implemented by values that handle builtin function calls
+	// they are passed to, for example sqrt of an area.
+	Applier interface {
+		Apply(ctx context.Context, name string, args []any) (any, error)
+	}
+
+	// Converter is implemented by values that can be converted with the
+	// "in" and "to" operators.
+	Converter interface {
+		Convert(ctx context.Context, target any) (any, error)
+	}
+)
+
+// scalar is implemented by results that carry extra information, such as
+// how a root was found, but calculate like a plain number.
+type scalar interface {
+	Float() float64
+}
+
+// LazyFunction is a builtin that receives its arguments unevaluated, so it
+// can evaluate an expression argument many times with different variables,
+// like plot(sin(x), x, 0, 10).
+type LazyFunction func(ctx context.Context, args []expronaut.ASTNode) (any, error)
+
+var lazyFunctions = map[string]LazyFunction{}
+
+// RegisterLazyFunction registers a builtin that receives its arguments as
+// nodes. Lazy functions take precedence over the expronaut builtins.
+func RegisterLazyFunction(name string, fn LazyFunction) {
+	lazyFunctions[name] = fn
+}
+
+// Evaluate parses and evaluates the input.
+func Evaluate(ctx context.Context, input string) (any, error) {
+	tree, err := ParseContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.Evaluate(ctx)
+}
+
+// EvaluateBool evaluates a condition such as "x**2 == 2 && x > 0". It is
+// an error when the input does not evaluate to a boolean.
+func EvaluateBool(ctx context.Context, input string) (bool, error) {
+	out, err := Evaluate(ctx, input)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := out.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w, got %s", ErrNotCondition, Format(out))
+	}
+	return b, nil
+}
+
+// Evaluate computes the value of the tree.
+func (t *Tree) Evaluate(ctx context.Context) (any, error) {
+	ctx, end := startEvaluation(ctx, t.Input)
+
+	out, err := Eval(ctx, t.Root)
+	end(out, err)
+
+	return out, err
+}
+
+// Eval computes the value of a node. Variables are read from the context
+// set with expronaut.SetVariables, identifiers that are not variables are
+// looked up as units and then as currencies. A panic while evaluating is
+// returned as ErrInternal.
+func Eval(ctx context.Context, node expronaut.ASTNode) (out any, err error) {
+	defer recoverPanic(&err)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if t, ok := ctx.Value(traceKey{}).(*Trace); ok && t != nil {
+		return t.eval(ctx, node)
+	}
+
+	return eval(ctx, node)
+}
+
+// recoverPanic turns a panic into an error, so input that trips up expronaut
+// cannot crash the caller.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: %v", ErrInternal, r)
+	}
+}
+
+// eval computes the value of a node, its children are evaluated with Eval.
+func eval(ctx context.Context, node expronaut.ASTNode) (any, error) {
+	switch n := node.(type) {
+	case *expronaut.VariableNode:
+		return lookup(ctx, n.Name)
+	case *UnaryOperationNode:
+		operand, err := Eval(ctx, n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return unary(ctx, n.Operator, operand)
+	case *expronaut.BinaryOperationNode:
+		left, err := Eval(ctx, n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := Eval(ctx, n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return binary(ctx, n.Operator, left, right)
+	case *expronaut.LogicalOperationNode:
+		return logical(ctx, n)
+	case *expronaut.FunctionCallNode:
+		if err := checkPolicy(ctx, n.FunctionName); err != nil {
+			return nil, err
+		}
+		if fn, ok := lazyFunctions[n.FunctionName]; ok {
+			// lazy functions evaluate their arguments many times, a trace
+			// records the call as a single step and the instrument is told
+			// only about the call
+			ctx, end := startCall(ctx, n.FunctionName)
+			out, err := fn(quiet(context.WithValue(ctx, traceKey{}, (*Trace)(nil))), n.Arguments)
+			end(out, err)
+			observeCall(n.FunctionName, err)
+			return out, err
+		}
+
+		args := make([]any, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			val, err := Eval(ctx, arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = val
+		}
+		ctx, end := startCall(ctx, n.FunctionName)
+		out, err := call(ctx, n.FunctionName, args)
+		end(out, err)
+		observeCall(n.FunctionName, err)
+		return out, err
+	case *expronaut.ArrayNode:
+		elements := make([]any, len(n.Elements))
+		for i, element := range n.Elements {
+			val, err := Eval(ctx, element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = val
+		}
+		return elements, nil
+	case *MatrixNode:
+		elements := make([]any, len(n.Elements))
+		for i, element := range n.Elements {
+			val, err := Eval(ctx, element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = val
+		}
+		return newMatrixOrArray(elements)
+	case *ConversionNode:
+		value, err := Eval(ctx, n.Value)
+		if err != nil {
+			return nil, err
+		}
+		target, err := Eval(ctx, n.Target)
+		if err != nil {
+			return nil, err
+		}
+		return convert(ctx, value, target)
+	default:
+		// literals
+		return node.Evaluate(ctx)
+	}
+}
+
+// lookup resolves an identifier as a variable, a unit or a currency code.
+// Dotted names walk nested maps, like expronaut does.
+func lookup(ctx context.Context, name string) (any, error) {
+	if vars, ok := ctx.Value(expronaut.ContextKey).(map[string]any); ok {
+		parts := strings.Split(name, ".")
+
+		value, exists := vars[parts[0]]
+		for _, part := range parts[1:] {
+			if !exists {
+				break
+			}
+
+			m, ok := value.(map[string]any)
+			if !ok {
+				exists = false
+				break
+			}
+			value, exists = m[part]
+		}
+
+		if exists {
+			return value, nil
+		}
+	}
+
+	if q, ok := LookupUnit(name); ok {
+		return q, nil
+	}
+
+	if m, ok := LookupCurrency(ctx, name); ok {
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("variable %s %w", name, ErrUndefinedVariable)
+}
+
+func unary(ctx context.Context, op expronaut.TokenType, operand any) (any, error) {
+	switch op {
+	case expronaut.TokenTypePlus:
+		return operand, nil
+	case expronaut.TokenTypeMinus:
+		switch v := operand.(type) {
+		case int:
+			return -v, nil
+		case float64:
+			return -v, nil
+		}
+		return binary(ctx, expronaut.TokenTypeMultiply, -1, operand)
+	}
+
+	return nil, fmt.Errorf("unknown or unsupported operator: %v", op)
+}
+
+func binary(ctx context.Context, op expronaut.TokenType, left, right any) (any, error) {
+	if o, ok := left.(Operand); ok {
+		out, err := o.Operate(ctx, op, right, false)
+		if !errors.Is(err, ErrUnsupported) {
+			return out, err
+		}
+	}
+
+	if o, ok := right.(Operand); ok {
+		out, err := o.Operate(ctx, op, left, true)
+		if !errors.Is(err, ErrUnsupported) {
+			return out, err
+		}
+	}
+
+	// the elementwise operators only differ from the plain ones for matrices
+	if plain, ok := elementwiseOperators[op]; ok {
+		op = plain
+	}
+
+	switch op {
+	case expronaut.TokenTypeDivide:
+		if _, ok := left.(int); ok && right == 0 {
+			return nil, ErrDivisionByZero
+		}
+	case expronaut.TokenTypeDivideInteger, expronaut.TokenTypeModulo:
+		// expronaut truncates both sides to int for these operators
+		if f, ok := right.(float64); ok && int(f) == 0 || right == 0 {
+			return nil, ErrDivisionByZero
+		}
+	case expronaut.TokenTypeLeftShift, expronaut.TokenTypeRightShift:
+		if n, ok := right.(int); ok && n < 0 {
+			return nil, fmt.Errorf("negative shift count %d", n)
+		}
+	}
+
+	// everything else keeps the expronaut semantics
+	node := &expronaut.BinaryOperationNode{Left: valueNode{left}, Operator: op, Right: valueNode{right}}
+
+	out, err := node.Evaluate(ctx)
+	if err == nil && out == nil {
+		return nil, fmt.Errorf("%w: %T(%v) %s %T(%v)", ErrTypeMismatch, left, left, op, right, right)
+	}
+
+	return out, err
+}
+
+func logical(ctx context.Context, n *expronaut.LogicalOperationNode) (any, error) {
+	left, err := Eval(ctx, n.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	leftBool, ok := left.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operands for logical operation must be boolean")
+	}
+
+	// short-circuit
+	if n.Operator == expronaut.TokenTypeAnd && !leftBool || n.Operator == expronaut.TokenTypeOr && leftBool {
+		return leftBool, nil
+	}
+
+	right, err := Eval(ctx, n.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	rightBool, ok := right.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operands for logical operation must be boolean")
+	}
+
+	return rightBool, nil
+}
+
+func call(ctx context.Context, name string, args []any) (any, error) {
+	// user-defined functions take any argument, the Appliers only know the
+	// builtins
+	fs, _ := ctx.Value(functionsKey{}).(*Functions)
+	if f, ok := fs.Get(name); ok {
+		return f.Call(ctx, args...)
+	}
+
+	for _, arg := range args {
+		a, ok := arg.(Applier)
+		if !ok {
+			continue
+		}
+
+		out, err := a.Apply(ctx, name, args)
+		if !errors.Is(err, ErrUnsupported) {
+			return out, err
+		}
+	}
+
+	f, ok := expronaut.BuiltinFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFunction, name)
+	}
+
+	if err := checkArguments(name, args); err != nil {
+		return nil, err
+	}
+
+	return f(ctx, args...)
+}
+
+// checkArguments rejects arguments that an expronaut builtin would panic on
+// rather than return an error for.
+func checkArguments(name string, args []any) error {
+	switch name {
+	case "slice":
+		if len(args) != 3 {
+			return nil
+		}
+		arr, ok := args[0].([]any)
+		start, sok := args[1].(int)
+		end, eok := args[2].(int)
+		if ok && sok && eok && (start < 0 || end < start || end > len(arr)) {
+			return fmt.Errorf("slice bounds [%d:%d] out of range for %d elements", start, end, len(arr))
+		}
+	}
+	return nil
+}
+
+// operateScalar implements Operand for scalar results.
+func operateScalar(ctx context.Context, s scalar, op expronaut.TokenType, other any, reverse bool) (any, error) {
+	if reverse {
+		return binary(ctx, op, other, s.Float())
+	}
+	return binary(ctx, op, s.Float(), other)
+}
+
+// applyScalars implements Applier for scalar results, replacing them with
+// their values before calling the builtin.
+func applyScalars(ctx context.Context, name string, args []any) (any, error) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(scalar); ok {
+			arg = s.Float()
+		}
+		values[i] = arg
+	}
+
+	return call(ctx, name, values)
+}
+
+func convert(ctx context.Context, value, target any) (any, error) {
+	if c, ok := value.(Converter); ok {
+		out, err := c.Convert(ctx, target)
+		if !errors.Is(err, ErrUnsupported) {
+			return out, err
+		}
+	}
+
+	if t, ok := target.(Quantity); ok {
+		return nil, fmt.Errorf("%w: cannot convert dimensionless %s to %s", ErrDimensionMismatch, Format(value), t.describe())
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to %s", Format(value), Format(target))
+}
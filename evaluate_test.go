@@ -0,0 +1,99 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/donseba/expronaut"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "1 + 2 * 3", want: "7"},
+		{input: "(1 + 2) * 3", want: "9"},
+		{input: "2 ** 10", want: "1024"},
+		{input: "7 // 2", want: "3"},
+		{input: "7 % 4", want: "3"},
+		{input: "1 << 4", want: "16"},
+		{input: "16 >> 2", want: "4"},
+		{input: "-3 + 5", want: "2"},
+		{input: "5 - -3", want: "8"},
+		{input: "1 < 2 && 2 < 3", want: "true"},
+		{input: "sqrt(16)", want: "4"},
+		{input: "slice([1, 2, 3], 1, 2)", want: "[2]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{input: "1 / 0", err: ErrDivisionByZero},
+		{input: "1 // 0", err: ErrDivisionByZero},
+		{input: "1 % 0", err: ErrDivisionByZero},
+		{input: "nope(1)", err: ErrUnknownFunction},
+		{input: "foo + 1", err: ErrUndefinedVariable},
+		{input: "1 >> -1"},
+		{input: "1 << -1"},
+		{input: "slice([1, 2, 3], 5, 1)"},
+		{input: "slice([1, 2, 3], 0, 4)"},
+		{input: "sum([1, [2]])", err: ErrInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if err == nil {
+				t.Fatalf("got %s, want an error", Format(out))
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEvaluateVariables(t *testing.T) {
+	ctx := expronaut.SetVariables(context.Background(), map[string]any{
+		"x":    2,
+		"user": map[string]any{"age": 40},
+	})
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "x * 3", want: "6"},
+		{input: "user.age + x", want: "42"},
+		{input: "3x", want: "6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(ctx, tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
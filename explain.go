@@ -0,0 +1,117 @@
+package goculator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donseba/expronaut"
+)
+
+// Step is one evaluated node of a trace.
+type Step struct {
+	ID       int    `json:"id"`
+	Parent   int    `json:"parent"` // -1 for the root
+	Depth    int    `json:"depth"`
+	Kind     string `json:"kind"`
+	Operator string `json:"operator,omitempty"`
+	Span     Span   `json:"span"`
+	Source   string `json:"source"`
+	Value    string `json:"value,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Trace records the evaluation of a tree node by node. Steps are recorded
+// when a node has been evaluated, so children come before their parent and
+// the order of the steps is the order of the evaluation. IDs number the
+// nodes in the order they were entered, root first.
+type Trace struct {
+	Steps []Step
+
+	tree  *Tree
+	stack []int
+	next  int
+}
+
+type traceKey struct{}
+
+// Explain parses and evaluates the input like Evaluate, recording every
+// evaluated node.
+func Explain(ctx context.Context, input string) (any, []Step, error) {
+	tree, err := ParseContext(ctx, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tree.Explain(ctx)
+}
+
+// Explain evaluates the tree like Evaluate, recording every evaluated node.
+func (t *Tree) Explain(ctx context.Context) (any, []Step, error) {
+	ctx, end := startEvaluation(ctx, t.Input)
+	trace := &Trace{tree: t}
+
+	out, err := Eval(context.WithValue(ctx, traceKey{}, trace), t.Root)
+	end(out, err)
+
+	return out, trace.Steps, err
+}
+
+func (t *Trace) eval(ctx context.Context, node expronaut.ASTNode) (any, error) {
+	id, parent := t.next, -1
+	if len(t.stack) > 0 {
+		parent = t.stack[len(t.stack)-1]
+	}
+
+	t.next++
+	t.stack = append(t.stack, id)
+	out, err := eval(ctx, node)
+	t.stack = t.stack[:len(t.stack)-1]
+
+	kind, operator := describeNode(node)
+	step := Step{
+		ID:       id,
+		Parent:   parent,
+		Depth:    len(t.stack),
+		Kind:     kind,
+		Operator: operator,
+		Source:   t.tree.Source(node),
+	}
+	step.Span, _ = t.tree.Span(node)
+
+	if err != nil {
+		step.Error = err.Error()
+	} else {
+		step.Value = Format(out)
+	}
+
+	t.Steps = append(t.Steps, step)
+	return out, err
+}
+
+// describeNode returns the kind of node and the operator or function it
+// applies.
+func describeNode(node expronaut.ASTNode) (string, string) {
+	switch n := node.(type) {
+	case *expronaut.IntLiteralNode, *expronaut.FloatLiteralNode, *expronaut.StringLiteralNode, *expronaut.BooleanLiteralNode:
+		return "literal", ""
+	case *expronaut.VariableNode:
+		return "identifier", n.Name
+	case *UnaryOperationNode:
+		return "unary", operatorSymbols[n.Operator]
+	case *expronaut.BinaryOperationNode:
+		return "binary", operatorSymbols[n.Operator]
+	case *expronaut.LogicalOperationNode:
+		return "logical", operatorSymbols[n.Operator]
+	case *ConversionNode:
+		return "conversion", n.Keyword
+	case *expronaut.FunctionCallNode:
+		if _, ok := lazyFunctions[n.FunctionName]; ok {
+			return "lazy function", n.FunctionName
+		}
+		return "function", n.FunctionName
+	case *expronaut.ArrayNode, *MatrixNode:
+		return "list", ""
+	}
+
+	return fmt.Sprintf("%T", node), ""
+}
@@ -0,0 +1,101 @@
+package goculator
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		input string
+		// steps are the sources of the steps, in the order they were
+		// evaluated
+		steps   []string
+		value   string
+		wantErr bool
+	}{
+		{
+			input: "1 + 2 * 3",
+			steps: []string{"1", "2", "3", "2 * 3", "1 + 2 * 3"},
+			value: "7",
+		},
+		{
+			input: "sqrt(16) - 1",
+			steps: []string{"16", "sqrt(16)", "1", "sqrt(16) - 1"},
+			value: "3",
+		},
+		{
+			// a lazy function is a single step
+			input: "diff(x**2, x, 3) + 1",
+			steps: []string{"diff(x**2, x, 3)", "1", "diff(x**2, x, 3) + 1"},
+			value: "7",
+		},
+		{
+			input:   "1 + nope",
+			steps:   []string{"1", "nope", "1 + nope"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, steps, err := Explain(context.Background(), tt.input)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got error %v", err)
+			}
+
+			if len(steps) != len(tt.steps) {
+				t.Fatalf("got %d steps %+v, want %d", len(steps), steps, len(tt.steps))
+			}
+			for i, s := range steps {
+				if s.Source != tt.steps[i] {
+					t.Errorf("step %d: got %q, want %q", i, s.Source, tt.steps[i])
+				}
+				if s.Span.End-s.Span.Pos != len(s.Source) {
+					t.Errorf("step %d: span %+v does not cover %q", i, s.Span, s.Source)
+				}
+			}
+
+			root := steps[len(steps)-1]
+			if root.Parent != -1 || root.Depth != 0 || root.ID != 0 {
+				t.Fatalf("the last step is not the root: %+v", root)
+			}
+			if tt.wantErr {
+				if root.Error == "" {
+					t.Fatal("the root step has no error")
+				}
+				return
+			}
+			if got := Format(out); got != tt.value || root.Value != tt.value {
+				t.Fatalf("got %s and root step %s, want %s", got, root.Value, tt.value)
+			}
+		})
+	}
+}
+
+func TestExplainParents(t *testing.T) {
+	_, steps, err := Explain(context.Background(), "(1 + 2) * abs(-3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID := map[int]Step{}
+	for _, s := range steps {
+		byID[s.ID] = s
+	}
+	for _, s := range steps {
+		if s.Parent == -1 {
+			continue
+		}
+		parent, ok := byID[s.Parent]
+		if !ok {
+			t.Fatalf("step %d has an unknown parent %d", s.ID, s.Parent)
+		}
+		if parent.Depth != s.Depth-1 {
+			t.Fatalf("step %d at depth %d has a parent at depth %d", s.ID, s.Depth, parent.Depth)
+		}
+		if parent.Span.Pos > s.Span.Pos || parent.Span.End < s.Span.End {
+			t.Fatalf("step %d lies outside its parent", s.ID)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package goculator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Format renders a result for display. Floats are rounded to 12 significant
+// digits to hide binary rounding noise such as 0.1+0.2, values that
+// implement fmt.Stringer, such as quantities, render themselves.
+func Format(v any) string {
+	switch val := v.(type) {
+	case float64:
+		return formatFloat(val)
+	case []any:
+		elements := make([]string, len(val))
+		for i, e := range val {
+			elements[i] = Format(e)
+		}
+		return "[" + strings.Join(elements, " ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 12, 64), 64)
+
+	if abs := math.Abs(rounded); abs == 0 || (abs >= 1e-6 && abs < 1e21) {
+		return strconv.FormatFloat(rounded, 'f', -1, 64)
+	}
+
+	return strconv.FormatFloat(rounded, 'g', -1, 64)
+}
+
+// Kind names the kind of a result, such as number, quantity or matrix, for
+// logs and metrics.
+func Kind(v any) string {
+	switch v.(type) {
+	case int, float64, scalar:
+		return "number"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case Quantity:
+		return "quantity"
+	case Money:
+		return "money"
+	case Matrix:
+		return "matrix"
+	case []any:
+		return "list"
+	case nil:
+		return "nil"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
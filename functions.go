@@ -0,0 +1,292 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/donseba/expronaut"
+)
+
+// MaxCallDepth limits the nesting of user-defined function calls, so a
+// function calling itself fails instead of exhausting the stack.
+const MaxCallDepth = 200
+
+var (
+	// ErrNotDefinition is returned by ParseDefinition for input that is not
+	// a function definition.
+	ErrNotDefinition = errors.New("not a function definition")
+
+	// ErrNotAssignment is returned by ParseAssignment for input that is not
+	// an assignment.
+	ErrNotAssignment = errors.New("not an assignment")
+
+	// ErrReservedName is returned when a definition would replace a builtin
+	// or lazy function.
+	ErrReservedName = errors.New("name of a builtin function")
+)
+
+// Function is a function defined by the user, such as f(x, y) = x**2 + y.
+type Function struct {
+	Name   string
+	Params []string
+	Body   string
+	Tree   *Tree
+}
+
+func (f *Function) String() string {
+	return fmt.Sprintf("%s(%s) = %s", f.Name, strings.Join(f.Params, ", "), f.Body)
+}
+
+// Functions is a set of user-defined functions. Only a context carrying the
+// set through WithFunctions can call them, so every session can have a set
+// of its own.
+type Functions struct {
+	mu   sync.RWMutex
+	defs map[string]*Function
+}
+
+type (
+	functionsKey struct{}
+	callDepthKey struct{}
+)
+
+// NewFunctions returns an empty set of functions.
+func NewFunctions() *Functions {
+	return &Functions{defs: make(map[string]*Function)}
+}
+
+// WithFunctions returns a context in which the functions of the set can be
+// called.
+func WithFunctions(ctx context.Context, fs *Functions) context.Context {
+	return context.WithValue(ctx, functionsKey{}, fs)
+}
+
+// ParseDefinition parses input such as "f(x, y) = x**2 + y". Input that
+// does not start like a definition returns ErrNotDefinition, syntax errors
+// in the body have their span in the whole input.
+func ParseDefinition(input string) (*Function, error) {
+	tokens := Tokenize(input)
+	if len(tokens) < 4 || tokens[0].Type != expronaut.TokenTypeFunction || tokens[1].Type != expronaut.TokenTypeParenLeft {
+		return nil, ErrNotDefinition
+	}
+
+	f := &Function{Name: tokens[0].Literal}
+
+	i := 2
+	for tokens[i].Type != expronaut.TokenTypeParenRight {
+		if len(f.Params) > 0 {
+			if tokens[i].Type != expronaut.TokenTypeComma {
+				return nil, ErrNotDefinition
+			}
+			i++
+		}
+		if tokens[i].Type != expronaut.TokenTypeVariable {
+			return nil, ErrNotDefinition
+		}
+		f.Params = append(f.Params, tokens[i].Literal)
+		i++
+	}
+	i++
+
+	if tokens[i].Type != TokenTypeAssign {
+		return nil, ErrNotDefinition
+	}
+	offset := tokens[i].End
+
+	for j, p := range f.Params {
+		if slices.Contains(f.Params[:j], p) {
+			return nil, &SyntaxError{Span: Span{Pos: tokens[2].Pos, End: tokens[i-1].End}, Msg: fmt.Sprintf("duplicate parameter %s", p)}
+		}
+	}
+
+	tree, err := Parse(input[offset:])
+	if err != nil {
+		var se *SyntaxError
+		if errors.As(err, &se) {
+			return nil, &SyntaxError{Span: Span{Pos: se.Pos + offset, End: se.End + offset}, Msg: se.Msg}
+		}
+		return nil, err
+	}
+
+	f.Body, f.Tree = strings.TrimSpace(tree.Input), tree
+	return f, nil
+}
+
+// ParseAssignment parses input such as "r = 2 km", returning the name of
+// the variable and the parsed expression. Input that does not start like an
+// assignment returns ErrNotAssignment, syntax errors in the expression have
+// their span in the whole input.
+func ParseAssignment(input string) (string, *Tree, error) {
+	tokens := Tokenize(input)
+	if len(tokens) < 3 || tokens[0].Type != expronaut.TokenTypeVariable || tokens[1].Type != TokenTypeAssign {
+		return "", nil, ErrNotAssignment
+	}
+
+	offset := tokens[1].End
+	tree, err := Parse(input[offset:])
+	if err != nil {
+		var se *SyntaxError
+		if errors.As(err, &se) {
+			return "", nil, &SyntaxError{Span: Span{Pos: se.Pos + offset, End: se.End + offset}, Msg: se.Msg}
+		}
+		return "", nil, err
+	}
+
+	return tokens[0].Literal, tree, nil
+}
+
+// Define adds the function to the set, replacing an earlier definition of
+// the same name. The name may not be the one of a builtin, and the body may
+// only use its parameters, units, currencies and functions that exist.
+func (fs *Functions) Define(f *Function) error {
+	if _, ok := lazyFunctions[f.Name]; ok || isBuiltin(f.Name) {
+		return fmt.Errorf("cannot define %s: %w", f.Name, ErrReservedName)
+	}
+
+	if err := fs.validate(f); err != nil {
+		return fmt.Errorf("cannot define %s: %w", f.Name, err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.defs[f.Name] = f
+	return nil
+}
+
+// Remove removes the function from the set, reporting whether it was
+// defined.
+func (fs *Functions) Remove(name string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	_, ok := fs.defs[name]
+	delete(fs.defs, name)
+	return ok
+}
+
+// Get returns the function defined under the name.
+func (fs *Functions) Get(name string) (*Function, bool) {
+	if fs == nil {
+		return nil, false
+	}
+
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	f, ok := fs.defs[name]
+	return f, ok
+}
+
+// List returns the functions ordered by name.
+func (fs *Functions) List() []*Function {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	list := make([]*Function, 0, len(fs.defs))
+	for _, f := range fs.defs {
+		list = append(list, f)
+	}
+	slices.SortFunc(list, func(a, b *Function) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+// validate checks that every identifier of the body is a parameter or a
+// unit, and that every function it calls exists. The arguments of lazy
+// functions bind variables of their own and are not checked, neither are the
+// targets of conversions, which may be currencies without a rate source yet.
+func (fs *Functions) validate(f *Function) error {
+	var check func(node expronaut.ASTNode) error
+	check = func(node expronaut.ASTNode) error {
+		switch n := node.(type) {
+		case *expronaut.VariableNode:
+			if slices.Contains(f.Params, n.Name) {
+				return nil
+			}
+			if _, err := lookup(context.Background(), n.Name); err != nil {
+				return fmt.Errorf("%s is not a parameter: %w", n.Name, err)
+			}
+		case *ConversionNode:
+			return check(n.Value)
+		case *expronaut.FunctionCallNode:
+			if _, ok := lazyFunctions[n.FunctionName]; ok {
+				return nil
+			}
+
+			_, defined := fs.Get(n.FunctionName)
+			if n.FunctionName != f.Name && !isBuiltin(n.FunctionName) && !defined {
+				return fmt.Errorf("%w: %s", ErrUnknownFunction, n.FunctionName)
+			}
+		}
+
+		for _, c := range children(node) {
+			if err := check(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return check(f.Tree.Root)
+}
+
+// isBuiltin reports whether the name is a builtin expronaut function. The
+// builtins are all registered in init functions, the map is only read
+// afterwards.
+func isBuiltin(name string) bool {
+	_, ok := expronaut.BuiltinFunctions[name]
+	return ok
+}
+
+// Builtins returns the names of the builtin functions, those of expronaut
+// and the lazy functions of goculator, sorted.
+func Builtins() []string {
+	names := make([]string, 0, len(expronaut.BuiltinFunctions)+len(lazyFunctions))
+	for name := range expronaut.BuiltinFunctions {
+		names = append(names, name)
+	}
+	for name := range lazyFunctions {
+		if _, ok := expronaut.BuiltinFunctions[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+	return names
+}
+
+// Call evaluates the body with the parameters bound to the arguments, on top
+// of the variables already set with expronaut.SetVariables.
+func (f *Function) Call(ctx context.Context, args ...any) (any, error) {
+	if len(args) != len(f.Params) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", f.Name, len(f.Params), len(args))
+	}
+
+	depth, _ := ctx.Value(callDepthKey{}).(int)
+	if depth >= MaxCallDepth {
+		return nil, fmt.Errorf("%s: calls nested deeper than %d", f.Name, MaxCallDepth)
+	}
+
+	vars, _ := ctx.Value(expronaut.ContextKey).(map[string]any)
+	bound := make(map[string]any, len(vars)+len(args))
+	maps.Copy(bound, vars)
+	for i, p := range f.Params {
+		bound[p] = args[i]
+	}
+
+	ctx = expronaut.SetVariables(ctx, bound)
+	ctx = context.WithValue(ctx, callDepthKey{}, depth+1)
+	// the body is not part of the traced input, a trace records the call as
+	// a single step
+	ctx = context.WithValue(ctx, traceKey{}, (*Trace)(nil))
+
+	return Eval(ctx, f.Tree.Root)
+}
@@ -0,0 +1,162 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestFunctionsDefine(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{input: "f(x) = x**2 + 1"},
+		{input: "g(a, b) = f(a) * b"},
+		{input: "d(t) = t * 1 km"},
+		{input: "sin(x) = 1", err: ErrReservedName},
+		{input: "plot(x) = x", err: ErrReservedName},
+		{input: "h(x) = y + 1", err: ErrUndefinedVariable},
+		{input: "k(x) = nope(x)", err: ErrUnknownFunction},
+	}
+
+	fs := NewFunctions()
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			f, err := ParseDefinition(tt.input)
+			if err != nil {
+				t.Fatalf("ParseDefinition: %v", err)
+			}
+
+			err = fs.Define(f)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Define: got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFunctionsCall(t *testing.T) {
+	fs := NewFunctions()
+	for _, def := range []string{"f(x) = x**2 + 1", "g(a, b) = f(a) * b", "loop(x) = loop(x)"} {
+		f, err := ParseDefinition(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Define(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "f(3)", want: "10"},
+		{input: "g(2, 3)", want: "15"},
+		{input: "f(1, 2)", wantErr: true},
+		{input: "loop(1)", wantErr: true},
+	}
+
+	ctx := WithFunctions(context.Background(), fs)
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(ctx, tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", Format(out))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFunctionsAreScopedToTheirSet(t *testing.T) {
+	fs := NewFunctions()
+	f, _ := ParseDefinition("scoped(x) = x + 1")
+	if err := fs.Define(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Evaluate(context.Background(), "scoped(1)"); !errors.Is(err, ErrUnknownFunction) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownFunction)
+	}
+
+	if isBuiltin("scoped") {
+		t.Fatal("a user-defined function is reported as a builtin")
+	}
+}
+
+func TestFunctionsDefineWhileEvaluating(t *testing.T) {
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 200 {
+			fs := NewFunctions()
+			f, _ := ParseDefinition("race(x) = x * 2")
+			if err := fs.Define(f); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 200 {
+			if _, err := Evaluate(context.Background(), "sqrt(16) + abs(-1)"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+}
+
+func TestBuiltins(t *testing.T) {
+	names := Builtins()
+	if !slices.IsSorted(names) {
+		t.Fatalf("not sorted: %v", names)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "sqrt", want: true},
+		// a lazy function of goculator
+		{name: "plot", want: true},
+		{name: "integrate", want: true},
+		{name: "nope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slices.Contains(names, tt.name); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a function defined by the user is no builtin
+	fs := NewFunctions()
+	f, _ := ParseDefinition("notbuiltin(x) = x")
+	if err := fs.Define(f); err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(Builtins(), "notbuiltin") {
+		t.Fatal("a user-defined function is listed as a builtin")
+	}
+}
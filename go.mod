@@ -6,3 +6,5 @@ require (
 	github.com/donseba/expronaut v0.0.0-20240317122124-ebaa65ecada0
 	github.com/donseba/go-htmx v1.8.0
 )
+
+require golang.org/x/crypto v0.31.0
@@ -0,0 +1,188 @@
+package goculator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/donseba/expronaut"
+)
+
+// templateOperators are the template functions of the operators expronaut's
+// TokenGoTemplate has no name for.
+var templateOperators = map[expronaut.TokenType]string{
+	expronaut.TokenTypeExponent:      "pow",
+	expronaut.TokenTypeDivideInteger: "divint",
+	TokenTypeElementwiseMultiply:     "mul",
+	TokenTypeElementwiseDivide:       "div",
+	TokenTypeElementwisePower:        "pow",
+}
+
+// templateComparisons replace the comparison functions of text/template,
+// which refuse to compare an int with a float, with the operators of the
+// evaluator.
+var templateComparisons = map[string]expronaut.TokenType{
+	"eq": expronaut.TokenTypeEqual,
+	"ne": expronaut.TokenTypeNotEqual,
+	"lt": expronaut.TokenTypeLessThan,
+	"le": expronaut.TokenTypeLessThanOrEqual,
+	"gt": expronaut.TokenTypeGreaterThan,
+	"ge": expronaut.TokenTypeGreaterThanOrEqual,
+}
+
+// ToGoTemplate converts the input into a text/template action, calling the
+// functions of TemplateFuncs for arithmetic. Unlike expronaut.ToGoTemplate
+// it reports syntax errors and the parts of the input a template cannot
+// express, such as units and lazy functions.
+func ToGoTemplate(input string) (string, error) {
+	tree, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+
+	pipeline, err := templatePipeline(tree.Root)
+	if err != nil {
+		return "", err
+	}
+
+	return "{{ " + pipeline + " }}", nil
+}
+
+// TemplateFuncs returns expronaut's builtin functions as template functions,
+// which is what the templates of ToGoTemplate are executed with. The
+// user-defined functions of a set passed with WithFunctions are included,
+// and comparisons compare numbers like the evaluator does.
+func TemplateFuncs(ctx context.Context) template.FuncMap {
+	funcs := make(template.FuncMap, len(expronaut.BuiltinFunctions))
+	for name, f := range expronaut.BuiltinFunctions {
+		funcs[name] = func(args ...any) (any, error) {
+			if err := checkPolicy(ctx, name); err != nil {
+				return nil, err
+			}
+			return f(ctx, args...)
+		}
+	}
+	for name, op := range templateComparisons {
+		funcs[name] = func(left, right any) (any, error) {
+			return binary(ctx, op, left, right)
+		}
+	}
+
+	if fs, ok := ctx.Value(functionsKey{}).(*Functions); ok && fs != nil {
+		for _, f := range fs.List() {
+			funcs[f.Name] = func(args ...any) (any, error) {
+				return f.Call(ctx, args...)
+			}
+		}
+	}
+
+	return funcs
+}
+
+// ExecuteTemplate executes a template, such as one made by ToGoTemplate,
+// with the variables as its data. Missing variables are an error rather than
+// "<no value>".
+func ExecuteTemplate(ctx context.Context, text string, variables map[string]any) (string, error) {
+	tmpl, err := template.New("expression").Funcs(TemplateFuncs(ctx)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	sb := strings.Builder{}
+	if err := tmpl.Execute(&sb, variables); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// templatePipeline renders a node as a template pipeline, a function name
+// followed by its arguments.
+func templatePipeline(node expronaut.ASTNode) (string, error) {
+	switch n := node.(type) {
+	case *expronaut.IntLiteralNode:
+		return strconv.Itoa(n.Value), nil
+	case *expronaut.FloatLiteralNode:
+		if math.IsInf(n.Value, 0) || math.IsNaN(n.Value) {
+			return "", fmt.Errorf("%v has no template literal: %w", n.Value, ErrUnsupported)
+		}
+		// a float without a fraction would be read back as an int
+		s := strconv.FormatFloat(n.Value, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	case *expronaut.StringLiteralNode:
+		return strconv.Quote(n.Value), nil
+	case *expronaut.BooleanLiteralNode:
+		return strconv.FormatBool(n.Value), nil
+	case *expronaut.VariableNode:
+		return "." + n.Name, nil
+	case *UnaryOperationNode:
+		operand, err := templateArgument(n.Operand)
+		if err != nil || n.Operator != expronaut.TokenTypeMinus {
+			return operand, err
+		}
+		return "sub 0 " + operand, nil
+	case *expronaut.BinaryOperationNode:
+		return templateOperation(n.Operator, n.Left, n.Right)
+	case *expronaut.LogicalOperationNode:
+		return templateOperation(n.Operator, n.Left, n.Right)
+	case *expronaut.FunctionCallNode:
+		if _, ok := lazyFunctions[n.FunctionName]; ok {
+			return "", fmt.Errorf("%s has no template function: %w", n.FunctionName, ErrUnsupported)
+		}
+		return templateCall(n.FunctionName, n.Arguments...)
+	case *ConversionNode:
+		return "", fmt.Errorf("conversions have no template equivalent: %w", ErrUnsupported)
+	}
+
+	return "", fmt.Errorf("%s has no template equivalent: %w", Infix(node), ErrUnsupported)
+}
+
+// templateOperation renders a binary operator as a call of the template
+// function applying it.
+func templateOperation(op expronaut.TokenType, left, right expronaut.ASTNode) (string, error) {
+	name, ok := templateOperators[op]
+	if !ok {
+		// TokenGoTemplate returns the token type for operators it has no
+		// function for
+		name = expronaut.TokenGoTemplate(op)
+		if name == string(op) {
+			return "", fmt.Errorf("%s has no template function: %w", operatorSymbols[op], ErrUnsupported)
+		}
+	}
+
+	return templateCall(name, left, right)
+}
+
+func templateCall(name string, args ...expronaut.ASTNode) (string, error) {
+	parts := []string{name}
+	for _, arg := range args {
+		s, err := templateArgument(arg)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// templateArgument renders a node as an argument, in parentheses when it
+// is a pipeline of its own.
+func templateArgument(node expronaut.ASTNode) (string, error) {
+	s, err := templatePipeline(node)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(s, " ") && !strings.HasPrefix(s, `"`) {
+		return "(" + s + ")", nil
+	}
+
+	return s, nil
+}
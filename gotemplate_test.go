@@ -0,0 +1,100 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/donseba/expronaut"
+)
+
+func TestToGoTemplate(t *testing.T) {
+	tests := []struct {
+		input    string
+		template string
+		err      error
+		wantErr  bool
+	}{
+		{input: "1 + 2", template: "{{ add 1 2 }}"},
+		{input: "a * (b - 1)", template: "{{ mul .a (sub .b 1) }}"},
+		{input: "2 ** 10", template: "{{ pow 2 10 }}"},
+		{input: "-a", template: "{{ sub 0 .a }}"},
+		{input: "sqrt(a) + 1.0", template: "{{ add (sqrt .a) 1.0 }}"},
+		{input: "1 km to m", err: ErrUnsupported},
+		{input: "diff(x**2, x)", err: ErrUnsupported},
+		{input: "1 +", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ToGoTemplate(tt.input)
+			if tt.err != nil || tt.wantErr {
+				if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.template {
+				t.Fatalf("got %s, want %s", got, tt.template)
+			}
+		})
+	}
+}
+
+// TestGoTemplateMatchesEvaluate executes the templates and compares their
+// output with evaluating the expressions.
+func TestGoTemplateMatchesEvaluate(t *testing.T) {
+	vars := map[string]any{"a": 9, "b": 2.5, "c": 4}
+	tests := []string{
+		"a + b * c",
+		"(a - c) / 2",
+		"a // c",
+		"sqrt(a) ** 3",
+		"abs(c - a) + max(a, c)",
+		"a > c && b < c",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			tmpl, err := ToGoTemplate(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ExecuteTemplate(context.Background(), tmpl, vars)
+			if err != nil {
+				t.Fatalf("%s: %v", tmpl, err)
+			}
+
+			want, err := Evaluate(expronaut.SetVariables(context.Background(), vars), input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != Format(want) {
+				g, gerr := strconv.ParseFloat(got, 64)
+				w, ok := toFloat(want)
+				if gerr != nil || !ok || g != w {
+					t.Fatalf("%s printed %s, want %s", tmpl, got, Format(want))
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteTemplateMissingVariable(t *testing.T) {
+	if _, err := ExecuteTemplate(context.Background(), "{{ add .a 1 }}", map[string]any{}); err == nil {
+		t.Fatal("got no error for a missing variable")
+	}
+}
+
+func TestTemplateFuncsFollowPolicy(t *testing.T) {
+	ctx := WithFunctionPolicy(context.Background(), func(name string) bool { return name != "sqrt" })
+
+	if _, err := ExecuteTemplate(ctx, "{{ sqrt 4 }}", nil); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("got error %v, want %v", err, ErrNotAllowed)
+	}
+}
@@ -0,0 +1,122 @@
+package goculator
+
+import (
+	"fmt"
+
+	"github.com/donseba/expronaut"
+)
+
+// Inspection is a JSON friendly description of a node and its children.
+type Inspection struct {
+	Kind     string        `json:"kind"`
+	Operator string        `json:"operator,omitempty"`
+	Value    any           `json:"value,omitempty"`
+	Span     *Span         `json:"span,omitempty"`
+	Source   string        `json:"source,omitempty"`
+	Children []*Inspection `json:"children,omitempty"`
+}
+
+// Inspect describes the tree, including the span of every node.
+func (t *Tree) Inspect() *Inspection {
+	return inspect(t.Root, t)
+}
+
+// Inspect describes a node that was not parsed by Parse, such as a tree
+// produced by the expronaut parser, or one created by Simplify.
+func Inspect(node expronaut.ASTNode) *Inspection {
+	return inspect(node, nil)
+}
+
+func inspect(node expronaut.ASTNode, tree *Tree) *Inspection {
+	if node == nil {
+		return &Inspection{Kind: "missing"}
+	}
+
+	kind, operator := describeNode(node)
+	out := &Inspection{Kind: kind, Operator: operator}
+
+	if tree != nil {
+		if span, ok := tree.Span(node); ok {
+			out.Span = &span
+			out.Source = tree.Source(node)
+		}
+	}
+
+	switch n := node.(type) {
+	case *expronaut.IntLiteralNode:
+		out.Value = n.Value
+	case *expronaut.FloatLiteralNode:
+		out.Value = n.Value
+	case *expronaut.StringLiteralNode:
+		out.Value = n.Value
+	case *expronaut.BooleanLiteralNode:
+		out.Value = n.Value
+	case *expronaut.VariableNode:
+		out.Operator, out.Value = "", n.Name
+	case *expronaut.BinaryOperationNode:
+		if out.Operator == "" {
+			// an operator without syntax of its own, keep the token type
+			out.Operator = string(n.Operator)
+		}
+	}
+
+	for _, c := range children(node) {
+		out.Children = append(out.Children, inspect(c, tree))
+	}
+
+	return out
+}
+
+// children returns the operands, arguments or elements of a node.
+func children(node expronaut.ASTNode) []expronaut.ASTNode {
+	switch n := node.(type) {
+	case *UnaryOperationNode:
+		return []expronaut.ASTNode{n.Operand}
+	case *expronaut.BinaryOperationNode:
+		return []expronaut.ASTNode{n.Left, n.Right}
+	case *expronaut.LogicalOperationNode:
+		return []expronaut.ASTNode{n.Left, n.Right}
+	case *ConversionNode:
+		return []expronaut.ASTNode{n.Value, n.Target}
+	case *expronaut.FunctionCallNode:
+		return n.Arguments
+	case *expronaut.ArrayNode:
+		return n.Elements
+	case *MatrixNode:
+		return n.Elements
+	}
+
+	return nil
+}
+
+// ExpronautTokens returns the tokens expronaut's own lexer produces for the
+// input, which differ from Tokenize: expronaut reads a minus directly in
+// front of a digit as part of the number, even after an operand.
+func ExpronautTokens(input string) []expronaut.Token {
+	lexer := expronaut.NewLexer(input)
+
+	var tokens []expronaut.Token
+	// every token consumes at least one byte, the bound guards against a
+	// lexer that gets stuck
+	for range len(input) + 1 {
+		tok := lexer.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == expronaut.TokenTypeEOF {
+			break
+		}
+	}
+
+	return tokens
+}
+
+// ExpronautParse parses the input with expronaut's own parser, to compare
+// its tree with the one Parse produces.
+func ExpronautParse(input string) (node expronaut.ASTNode, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			node, err = nil, fmt.Errorf("expronaut parser: %v", r)
+		}
+	}()
+
+	return expronaut.NewParser(expronaut.NewLexer(input)).Parse(), nil
+}
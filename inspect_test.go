@@ -0,0 +1,88 @@
+package goculator
+
+import (
+	"testing"
+
+	"github.com/donseba/expronaut"
+)
+
+func TestInspect(t *testing.T) {
+	tree, err := Parse("2 * sin(x) + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := tree.Inspect()
+
+	tests := []struct {
+		name     string
+		node     *Inspection
+		kind     string
+		operator string
+		source   string
+	}{
+		{name: "root", node: root, kind: "binary", operator: "+", source: "2 * sin(x) + 1"},
+		{name: "product", node: root.Children[0], kind: "binary", operator: "*", source: "2 * sin(x)"},
+		{name: "call", node: root.Children[0].Children[1], kind: "function", operator: "sin", source: "sin(x)"},
+		{name: "variable", node: root.Children[0].Children[1].Children[0], kind: "identifier", source: "x"},
+		{name: "literal", node: root.Children[1], kind: "literal", source: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := tt.node
+			if n.Kind != tt.kind || n.Operator != tt.operator || n.Source != tt.source {
+				t.Fatalf("got %s %q %q, want %s %q %q", n.Kind, n.Operator, n.Source, tt.kind, tt.operator, tt.source)
+			}
+			if n.Span == nil || tree.Input[n.Span.Pos:n.Span.End] != tt.source {
+				t.Fatalf("got span %v, want one covering %q", n.Span, tt.source)
+			}
+		})
+	}
+}
+
+func TestInspectWithoutTree(t *testing.T) {
+	node, err := ExpronautParse("1 + 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := Inspect(node)
+	if in.Kind != "binary" || len(in.Children) != 2 || in.Span != nil {
+		t.Fatalf("got %+v", in)
+	}
+}
+
+func TestExpronautParseRecovers(t *testing.T) {
+	// expronaut panics on some input it cannot parse, which must come back
+	// as an error instead
+	for _, input := range []string{"(", "1 +", "sin(", ")", "[1,"} {
+		t.Run(input, func(t *testing.T) {
+			_, _ = ExpronautParse(input)
+		})
+	}
+}
+
+func TestExpronautTokens(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{input: "", want: 1},
+		{input: "1 + 2", want: 4},
+		// expronaut reads the minus as the sign of 2
+		{input: "1-2", want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tokens := ExpronautTokens(tt.input)
+			if len(tokens) != tt.want {
+				t.Fatalf("got %d tokens %v, want %d", len(tokens), tokens, tt.want)
+			}
+			if tokens[len(tokens)-1].Type != expronaut.TokenTypeEOF {
+				t.Fatal("the tokens do not end with EOF")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package goculator
+
+import (
+	"context"
+	"sync"
+)
+
+// Instrument is told when parsing, evaluation and builtin calls start and
+// end, for instance to record them as tracing spans. Start returns the
+// context the operation runs in and the function called when it ends, with
+// the attributes known by then.
+//
+// Operations are "goculator.parse" and "goculator.evaluate", with the
+// attribute "goculator.expression.size", and "goculator.call" with
+// "goculator.function". Evaluations and calls end with
+// "goculator.result.type". A lazy function evaluates its arguments many
+// times, so the operations within it are not reported, its call stands for
+// them.
+type Instrument interface {
+	Start(ctx context.Context, operation string, attrs map[string]any) (context.Context, func(attrs map[string]any, err error))
+}
+
+var (
+	instrumentMu sync.RWMutex
+	instrument   Instrument
+)
+
+// SetInstrument sets the instrument told about every operation, nil to stop.
+func SetInstrument(i Instrument) {
+	instrumentMu.Lock()
+	defer instrumentMu.Unlock()
+
+	instrument = i
+}
+
+func currentInstrument() Instrument {
+	instrumentMu.RLock()
+	defer instrumentMu.RUnlock()
+
+	return instrument
+}
+
+// quietKey marks a context the instrument is not told about operations in.
+type quietKey struct{}
+
+// quiet returns ctx, with the operations in it kept from the instrument.
+func quiet(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quietKey{}, true)
+}
+
+// instrumentFor returns the instrument told about operations in ctx, nil if
+// there is none.
+func instrumentFor(ctx context.Context) Instrument {
+	if quiet, _ := ctx.Value(quietKey{}).(bool); quiet {
+		return nil
+	}
+	return currentInstrument()
+}
+
+// endNothing ends operations when no instrument is set, without allocating
+// on the hot path of evaluation.
+var endNothing = func(any, error) {}
+
+// startEvaluation starts evaluating the input with the instrument, the
+// returned function ends it with the result.
+func startEvaluation(ctx context.Context, input string) (context.Context, func(out any, err error)) {
+	i := instrumentFor(ctx)
+	if i == nil {
+		return ctx, endNothing
+	}
+
+	ctx, end := i.Start(ctx, "goculator.evaluate", map[string]any{"goculator.expression.size": len(input)})
+	return ctx, func(out any, err error) { end(map[string]any{"goculator.result.type": Kind(out)}, err) }
+}
+
+// startCall starts a call of a builtin or lazy function with the
+// instrument, the returned function ends it with the result.
+func startCall(ctx context.Context, name string) (context.Context, func(out any, err error)) {
+	i := instrumentFor(ctx)
+	if i == nil {
+		return ctx, endNothing
+	}
+
+	ctx, end := i.Start(ctx, "goculator.call", map[string]any{"goculator.function": name})
+	return ctx, func(out any, err error) { end(map[string]any{"goculator.result.type": Kind(out)}, err) }
+}
+
+// ParseContext parses the input like Parse, telling the instrument about it.
+func ParseContext(ctx context.Context, input string) (*Tree, error) {
+	i := instrumentFor(ctx)
+	if i == nil {
+		return Parse(input)
+	}
+
+	_, end := i.Start(ctx, "goculator.parse", map[string]any{"goculator.expression.size": len(input)})
+	tree, err := Parse(input)
+	end(nil, err)
+
+	return tree, err
+}
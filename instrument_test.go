@@ -0,0 +1,59 @@
+package goculator
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recorder is an instrument keeping the operations it is told about.
+type recorder struct {
+	mu         sync.Mutex
+	operations []string
+}
+
+func (r *recorder) Start(ctx context.Context, operation string, attrs map[string]any) (context.Context, func(map[string]any, error)) {
+	name := operation
+	if f, ok := attrs["goculator.function"].(string); ok {
+		name += " " + f
+	}
+
+	r.mu.Lock()
+	r.operations = append(r.operations, name)
+	r.mu.Unlock()
+
+	return ctx, func(map[string]any, error) {}
+}
+
+func TestInstrument(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{
+			input: "sqrt(16) + abs(-1)",
+			want:  []string{"goculator.parse", "goculator.evaluate", "goculator.call sqrt", "goculator.call abs"},
+		},
+		{
+			// the calls of sqrt within integrate are not reported
+			input: "integrate(1/sqrt(x), x, 0, 1)",
+			want:  []string{"goculator.parse", "goculator.evaluate", "goculator.call integrate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r := &recorder{}
+			SetInstrument(r)
+			t.Cleanup(func() { SetInstrument(nil) })
+
+			if _, err := Evaluate(context.Background(), tt.input); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(r.operations, tt.want) {
+				t.Fatalf("got %q, want %q", r.operations, tt.want)
+			}
+		})
+	}
+}
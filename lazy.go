@@ -0,0 +1,63 @@
+package goculator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/donseba/expronaut"
+)
+
+// ExpressionArg returns the expression passed to a lazy function. It can be
+// written inline, plot(x**2, x, 0, 1), or as a string like the expressions
+// expronaut's map and filter take, plot("x**2", x, 0, 1).
+func ExpressionArg(node expronaut.ASTNode) (expronaut.ASTNode, error) {
+	if s, ok := node.(*expronaut.StringLiteralNode); ok {
+		tree, err := Parse(s.Value)
+		if err != nil {
+			return nil, err
+		}
+		return tree.Root, nil
+	}
+
+	return node, nil
+}
+
+// VariableArg returns the name of the variable passed to a lazy function,
+// either as a bare identifier or as a string.
+func VariableArg(node expronaut.ASTNode) (string, error) {
+	switch n := node.(type) {
+	case *expronaut.VariableNode:
+		return n.Name, nil
+	case *expronaut.StringLiteralNode:
+		return n.Value, nil
+	}
+
+	return "", fmt.Errorf("expected a variable name, got %s", Infix(node))
+}
+
+// NumberArg evaluates an argument that has to be a number.
+func NumberArg(ctx context.Context, node expronaut.ASTNode) (float64, error) {
+	v, err := Eval(ctx, node)
+	if err != nil {
+		return 0, err
+	}
+
+	f, ok := toFloat(v)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, got %s", Format(v))
+	}
+	return f, nil
+}
+
+// WithVariable returns a context in which name is bound to value, on top of
+// the variables already set with expronaut.SetVariables.
+func WithVariable(ctx context.Context, name string, value any) context.Context {
+	vars, _ := ctx.Value(expronaut.ContextKey).(map[string]any)
+
+	bound := make(map[string]any, len(vars)+1)
+	maps.Copy(bound, vars)
+	bound[name] = value
+
+	return expronaut.SetVariables(ctx, bound)
+}
@@ -0,0 +1,218 @@
+package goculator
+
+import (
+	"github.com/donseba/expronaut"
+)
+
+const (
+	// TokenTypeAssign is the single '=' used by assignments and definitions.
+	// expronaut reports it as an illegal token.
+	TokenTypeAssign expronaut.TokenType = "ASSIGN"
+
+	// The elementwise operators for matrices, for numbers they behave like
+	// their plain counterparts.
+	TokenTypeElementwiseMultiply expronaut.TokenType = "ELEMENTWISE_MULTIPLY"
+	TokenTypeElementwiseDivide   expronaut.TokenType = "ELEMENTWISE_DIVIDE"
+	TokenTypeElementwisePower    expronaut.TokenType = "ELEMENTWISE_POWER"
+)
+
+var (
+	twoCharTokens = map[string]expronaut.TokenType{
+		"**": expronaut.TokenTypeExponent,
+		"//": expronaut.TokenTypeDivideInteger,
+		"<=": expronaut.TokenTypeLessThanOrEqual,
+		">=": expronaut.TokenTypeGreaterThanOrEqual,
+		"<<": expronaut.TokenTypeLeftShift,
+		">>": expronaut.TokenTypeRightShift,
+		"==": expronaut.TokenTypeEqual,
+		"!=": expronaut.TokenTypeNotEqual,
+		"&&": expronaut.TokenTypeAnd,
+		"||": expronaut.TokenTypeOr,
+		".*": TokenTypeElementwiseMultiply,
+		"./": TokenTypeElementwiseDivide,
+		".^": TokenTypeElementwisePower,
+	}
+
+	oneCharTokens = map[byte]expronaut.TokenType{
+		'(': expronaut.TokenTypeParenLeft,
+		')': expronaut.TokenTypeParenRight,
+		'+': expronaut.TokenTypePlus,
+		'-': expronaut.TokenTypeMinus,
+		'*': expronaut.TokenTypeMultiply,
+		'/': expronaut.TokenTypeDivide,
+		'%': expronaut.TokenTypeModulo,
+		'^': expronaut.TokenTypeExponent,
+		',': expronaut.TokenTypeComma,
+		'[': expronaut.TokenTypeArrayStart,
+		']': expronaut.TokenTypeArrayEnd,
+		'<': expronaut.TokenTypeLessThan,
+		'>': expronaut.TokenTypeGreaterThan,
+		'=': TokenTypeAssign,
+	}
+)
+
+// Token is an expronaut token together with the byte span it covers in the
+// input.
+type Token struct {
+	expronaut.Token
+	Pos int // byte offset of the first character
+	End int // byte offset just past the last character
+}
+
+// lexer turns the input into tokens. It uses the expronaut token types but
+// never glues a leading '-' onto a number, leaving the decision between
+// unary and binary minus to the parser.
+type lexer struct {
+	input string
+	pos   int
+}
+
+// Tokenize splits the input into tokens. The last token is always EOF.
+func Tokenize(input string) []Token {
+	l := &lexer{input: input}
+
+	var tokens []Token
+	for {
+		tok := l.next()
+		tokens = append(tokens, tok)
+		if tok.Type == expronaut.TokenTypeEOF {
+			return tokens
+		}
+	}
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.pos+offset]
+}
+
+func (l *lexer) emit(typ expronaut.TokenType, start int) Token {
+	return Token{
+		Token: expronaut.Token{Type: typ, Literal: l.input[start:l.pos]},
+		Pos:   start,
+		End:   l.pos,
+	}
+}
+
+func (l *lexer) next() Token {
+	for l.pos < len(l.input) && isSpace(l.input[l.pos]) {
+		l.pos++
+	}
+
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return l.emit(expronaut.TokenTypeEOF, start)
+	}
+
+	ch := l.input[l.pos]
+
+	// two character operators first
+	if typ, ok := twoCharTokens[string([]byte{ch, l.peek(1)})]; ok {
+		l.pos += 2
+		return l.emit(typ, start)
+	}
+
+	if typ, ok := oneCharTokens[ch]; ok {
+		l.pos++
+		return l.emit(typ, start)
+	}
+
+	switch {
+	case ch == '"' || ch == '\'':
+		return l.readString(ch)
+	case isDigit(ch) || (ch == '.' && isDigit(l.peek(1))):
+		return l.readNumber()
+	case isLetter(ch):
+		return l.readIdentifier()
+	}
+
+	l.pos++
+	return l.emit(expronaut.TokenTypeIllegal, start)
+}
+
+func (l *lexer) readString(quote byte) Token {
+	start := l.pos
+	l.pos++ // opening quote
+
+	for l.pos < len(l.input) && l.input[l.pos] != quote {
+		l.pos++
+	}
+
+	if l.pos >= len(l.input) {
+		// unterminated, report the whole remainder as illegal
+		return l.emit(expronaut.TokenTypeIllegal, start)
+	}
+
+	l.pos++ // closing quote
+	tok := l.emit(expronaut.TokenTypeString, start)
+	tok.Literal = tok.Literal[1 : len(tok.Literal)-1]
+	return tok
+}
+
+func (l *lexer) readNumber() Token {
+	start := l.pos
+	typ := expronaut.TokenTypeInt
+
+	for isDigit(l.peek(0)) {
+		l.pos++
+	}
+
+	if l.peek(0) == '.' {
+		typ = expronaut.TokenTypeFloat
+		l.pos++
+		for isDigit(l.peek(0)) {
+			l.pos++
+		}
+	}
+
+	// scientific notation: 1e3, 2.5E-4
+	if e := l.peek(0); e == 'e' || e == 'E' {
+		offset := 1
+		if s := l.peek(1); s == '+' || s == '-' {
+			offset = 2
+		}
+		if isDigit(l.peek(offset)) {
+			typ = expronaut.TokenTypeFloat
+			l.pos += offset
+			for isDigit(l.peek(0)) {
+				l.pos++
+			}
+		}
+	}
+
+	return l.emit(typ, start)
+}
+
+func (l *lexer) readIdentifier() Token {
+	start := l.pos
+
+	for isLetter(l.peek(0)) || isDigit(l.peek(0)) || (l.peek(0) == '.' && isLetter(l.peek(1))) {
+		l.pos++
+	}
+
+	tok := l.emit(expronaut.TokenTypeVariable, start)
+	switch {
+	case tok.Literal == "true" || tok.Literal == "false":
+		tok.Type = expronaut.TokenTypeBool
+	case l.peek(0) == '(':
+		tok.Type = expronaut.TokenTypeFunction
+	case l.peek(0) == '[':
+		tok.Type = expronaut.TokenTypeArray
+	}
+
+	return tok
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isLetter(ch byte) bool {
+	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
+}
@@ -0,0 +1,647 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+// ErrShapeMismatch is returned when matrix dimensions do not fit the
+// operation, e.g. adding a 2x2 to a 3x3 matrix.
+var ErrShapeMismatch = errors.New("shape mismatch")
+
+// elementwiseOperators maps the elementwise operators to the operator they
+// apply to each pair of elements.
+var elementwiseOperators = map[expronaut.TokenType]expronaut.TokenType{
+	TokenTypeElementwiseMultiply: expronaut.TokenTypeMultiply,
+	TokenTypeElementwiseDivide:   expronaut.TokenTypeDivide,
+	TokenTypeElementwisePower:    expronaut.TokenTypeExponent,
+}
+
+// Matrix is a dense matrix of float64 in row major order. A vector is a
+// matrix with a single column that was written as a flat list, it prints
+// back as one.
+type Matrix struct {
+	Rows, Cols int
+	Data       []float64
+
+	vector bool
+}
+
+// NewMatrix returns a zero matrix of the given size.
+func NewMatrix(rows, cols int) Matrix {
+	return Matrix{Rows: rows, Cols: cols, Data: make([]float64, rows*cols)}
+}
+
+// NewVector returns a vector holding the values.
+func NewVector(values ...float64) Matrix {
+	return Matrix{Rows: len(values), Cols: 1, Data: values, vector: true}
+}
+
+// Identity returns the n by n identity matrix.
+func Identity(n int) Matrix {
+	m := NewMatrix(n, n)
+	for i := 0; i < n; i++ {
+		m.Set(i, i, 1)
+	}
+	return m
+}
+
+// At returns the element at row i and column j.
+func (m Matrix) At(i, j int) float64 { return m.Data[i*m.Cols+j] }
+
+// Set sets the element at row i and column j.
+func (m Matrix) Set(i, j int, v float64) { m.Data[i*m.Cols+j] = v }
+
+// IsVector reports whether the matrix was written as a flat list.
+func (m Matrix) IsVector() bool { return m.vector }
+
+// Shape describes the size for error messages, e.g. "2x3".
+func (m Matrix) Shape() string { return fmt.Sprintf("%dx%d", m.Rows, m.Cols) }
+
+func (m Matrix) isSquare() bool { return m.Rows == m.Cols }
+
+func (m Matrix) clone() Matrix {
+	c := m
+	c.Data = append([]float64(nil), m.Data...)
+	return c
+}
+
+// Row returns row i as a slice.
+func (m Matrix) Row(i int) []float64 { return m.Data[i*m.Cols : (i+1)*m.Cols] }
+
+// String renders the matrix in the literal syntax, so it can be evaluated
+// again: [1, 2] for a vector and [[1, 2], [3, 4]] for a matrix.
+func (m Matrix) String() string {
+	format := func(values []float64) string {
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = formatFloat(v)
+		}
+		return "[" + strings.Join(s, ", ") + "]"
+	}
+
+	if m.vector {
+		return format(m.Data)
+	}
+
+	rows := make([]string, m.Rows)
+	for i := range rows {
+		rows[i] = format(m.Row(i))
+	}
+	return "[" + strings.Join(rows, ", ") + "]"
+}
+
+// newMatrixOrArray builds the value of a bracketed literal: numbers make a
+// vector, vectors of equal length make a matrix, anything else is kept as
+// a plain array.
+func newMatrixOrArray(elements []any) (any, error) {
+	if len(elements) == 0 {
+		return elements, nil
+	}
+
+	if values, ok := toFloats(elements); ok {
+		return NewVector(values...), nil
+	}
+
+	rows := make([][]float64, len(elements))
+	for i, element := range elements {
+		v, ok := element.(Matrix)
+		if !ok || !v.vector {
+			return elements, nil
+		}
+		if i > 0 && v.Rows != len(rows[0]) {
+			return nil, fmt.Errorf("%w: row %d has %d elements, expected %d", ErrShapeMismatch, i+1, v.Rows, len(rows[0]))
+		}
+		rows[i] = v.Data
+	}
+
+	m := NewMatrix(len(rows), len(rows[0]))
+	for i, row := range rows {
+		copy(m.Row(i), row)
+	}
+	return m, nil
+}
+
+func toFloats(elements []any) ([]float64, bool) {
+	values := make([]float64, len(elements))
+	for i, element := range elements {
+		switch v := element.(type) {
+		case int:
+			values[i] = float64(v)
+		case float64:
+			values[i] = v
+		default:
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+func toFloat(v any) (float64, bool) {
+	switch val := v.(type) {
+	case int:
+		return float64(val), true
+	case float64:
+		return val, true
+	case scalar:
+		return val.Float(), true
+	}
+	return 0, false
+}
+
+// elementwise applies fn to each pair of elements, broadcasting a scalar
+// operand over the matrix.
+func elementwise(l, r any, fn func(a, b float64) float64) (any, error) {
+	lm, lok := l.(Matrix)
+	rm, rok := r.(Matrix)
+
+	switch {
+	case lok && rok:
+		if lm.Rows != rm.Rows || lm.Cols != rm.Cols {
+			return nil, fmt.Errorf("%w: %s and %s", ErrShapeMismatch, lm.Shape(), rm.Shape())
+		}
+		out := lm.clone()
+		for i := range out.Data {
+			out.Data[i] = fn(lm.Data[i], rm.Data[i])
+		}
+		return out, nil
+	case lok:
+		s, ok := toFloat(r)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		out := lm.clone()
+		for i := range out.Data {
+			out.Data[i] = fn(lm.Data[i], s)
+		}
+		return out, nil
+	default:
+		s, ok := toFloat(l)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		out := rm.clone()
+		for i := range out.Data {
+			out.Data[i] = fn(s, rm.Data[i])
+		}
+		return out, nil
+	}
+}
+
+// Operate implements Operand. + and - work elementwise, * is the matrix
+// product (or scaling by a number), ** raises a square matrix to an integer
+// power and .*, ./ and .^ work elementwise.
+func (m Matrix) Operate(ctx context.Context, op expronaut.TokenType, other any, reverse bool) (any, error) {
+	var l, r any = m, other
+	if reverse {
+		l, r = other, m
+	}
+
+	switch other.(type) {
+	case Matrix, int, float64:
+	default:
+		return nil, ErrUnsupported
+	}
+
+	switch op {
+	case expronaut.TokenTypePlus:
+		return elementwise(l, r, func(a, b float64) float64 { return a + b })
+	case expronaut.TokenTypeMinus:
+		return elementwise(l, r, func(a, b float64) float64 { return a - b })
+	case TokenTypeElementwiseMultiply:
+		return elementwise(l, r, func(a, b float64) float64 { return a * b })
+	case TokenTypeElementwiseDivide:
+		return elementwise(l, r, func(a, b float64) float64 { return a / b })
+	case TokenTypeElementwisePower:
+		return elementwise(l, r, math.Pow)
+	case expronaut.TokenTypeMultiply:
+		lm, lok := l.(Matrix)
+		rm, rok := r.(Matrix)
+		if !lok || !rok {
+			return elementwise(l, r, func(a, b float64) float64 { return a * b })
+		}
+		return lm.Mul(rm)
+	case expronaut.TokenTypeDivide:
+		if _, ok := r.(Matrix); ok {
+			return nil, fmt.Errorf("cannot divide by a matrix, use inv() or solve()")
+		}
+		return elementwise(l, r, func(a, b float64) float64 { return a / b })
+	case expronaut.TokenTypeExponent:
+		lm, ok := l.(Matrix)
+		if !ok {
+			return nil, fmt.Errorf("cannot raise a number to a matrix power")
+		}
+		n, ok := toFloat(r)
+		if !ok || n != math.Trunc(n) {
+			return nil, fmt.Errorf("matrix power must be an integer, use .^ for elementwise powers")
+		}
+		return lm.Pow(ctx, int(n))
+	case expronaut.TokenTypeEqual, expronaut.TokenTypeNotEqual:
+		lm, lok := l.(Matrix)
+		rm, rok := r.(Matrix)
+		equal := lok && rok && lm.Rows == rm.Rows && lm.Cols == rm.Cols
+		for i := 0; equal && i < len(lm.Data); i++ {
+			equal = lm.Data[i] == rm.Data[i]
+		}
+		return equal == (op == expronaut.TokenTypeEqual), nil
+	}
+
+	return nil, fmt.Errorf("operator %s is not supported for matrices", op)
+}
+
+// Mul returns the matrix product m x o.
+func (m Matrix) Mul(o Matrix) (Matrix, error) {
+	if m.vector && o.vector {
+		return Matrix{}, fmt.Errorf("%w: cannot multiply two vectors, use dot() or cross()", ErrShapeMismatch)
+	}
+	if m.Cols != o.Rows {
+		return Matrix{}, fmt.Errorf("%w: cannot multiply %s by %s", ErrShapeMismatch, m.Shape(), o.Shape())
+	}
+
+	out := NewMatrix(m.Rows, o.Cols)
+	out.vector = o.vector
+	for i := 0; i < m.Rows; i++ {
+		for j := 0; j < o.Cols; j++ {
+			var sum float64
+			for k := 0; k < m.Cols; k++ {
+				sum += m.At(i, k) * o.At(k, j)
+			}
+			out.Set(i, j, sum)
+		}
+	}
+	return out, nil
+}
+
+// Pow raises a square matrix to an integer power by repeated squaring,
+// negative powers invert it first. It stops when the context is done.
+func (m Matrix) Pow(ctx context.Context, n int) (Matrix, error) {
+	if !m.isSquare() || m.vector {
+		return Matrix{}, fmt.Errorf("%w: only square matrices can be raised to a power, got %s", ErrShapeMismatch, m.Shape())
+	}
+
+	base := m
+	if n < 0 {
+		inv, err := m.Inverse()
+		if err != nil {
+			return Matrix{}, err
+		}
+		base, n = inv, -n
+	}
+
+	out := Identity(m.Rows)
+	for n > 0 {
+		if err := ctx.Err(); err != nil {
+			return Matrix{}, err
+		}
+
+		var err error
+		if n&1 == 1 {
+			if out, err = out.Mul(base); err != nil {
+				return Matrix{}, err
+			}
+		}
+		if n >>= 1; n > 0 {
+			if base, err = base.Mul(base); err != nil {
+				return Matrix{}, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// Transpose returns the transposed matrix. A vector becomes a single row.
+func (m Matrix) Transpose() Matrix {
+	out := NewMatrix(m.Cols, m.Rows)
+	for i := 0; i < m.Rows; i++ {
+		for j := 0; j < m.Cols; j++ {
+			out.Set(j, i, m.At(i, j))
+		}
+	}
+	return out
+}
+
+// lu computes the LU decomposition with partial pivoting in place and
+// returns the row permutation and its sign.
+func (m Matrix) lu() (lu Matrix, perm []int, sign float64, singular bool) {
+	n := m.Rows
+	lu = m.clone()
+	perm = make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	sign = 1
+
+	for k := 0; k < n; k++ {
+		pivot := k
+		for i := k + 1; i < n; i++ {
+			if math.Abs(lu.At(i, k)) > math.Abs(lu.At(pivot, k)) {
+				pivot = i
+			}
+		}
+
+		if math.Abs(lu.At(pivot, k)) < 1e-12 {
+			singular = true
+			continue
+		}
+
+		if pivot != k {
+			for j := 0; j < n; j++ {
+				a, b := lu.At(k, j), lu.At(pivot, j)
+				lu.Set(k, j, b)
+				lu.Set(pivot, j, a)
+			}
+			perm[k], perm[pivot] = perm[pivot], perm[k]
+			sign = -sign
+		}
+
+		for i := k + 1; i < n; i++ {
+			f := lu.At(i, k) / lu.At(k, k)
+			lu.Set(i, k, f)
+			for j := k + 1; j < n; j++ {
+				lu.Set(i, j, lu.At(i, j)-f*lu.At(k, j))
+			}
+		}
+	}
+
+	return lu, perm, sign, singular
+}
+
+// Det returns the determinant of a square matrix.
+func (m Matrix) Det() (float64, error) {
+	if !m.isSquare() || m.vector {
+		return 0, fmt.Errorf("%w: det needs a square matrix, got %s", ErrShapeMismatch, m.Shape())
+	}
+
+	lu, _, sign, singular := m.lu()
+	if singular {
+		return 0, nil
+	}
+
+	det := sign
+	for i := 0; i < m.Rows; i++ {
+		det *= lu.At(i, i)
+	}
+	return det, nil
+}
+
+// Solve solves m x = b for x, where b is a vector or a matrix with one
+// right hand side per column.
+func (m Matrix) Solve(b Matrix) (Matrix, error) {
+	if !m.isSquare() || m.vector {
+		return Matrix{}, fmt.Errorf("%w: solve needs a square coefficient matrix, got %s", ErrShapeMismatch, m.Shape())
+	}
+	if b.Rows != m.Rows {
+		return Matrix{}, fmt.Errorf("%w: right hand side has %d rows, expected %d", ErrShapeMismatch, b.Rows, m.Rows)
+	}
+
+	lu, perm, _, singular := m.lu()
+	if singular {
+		return Matrix{}, fmt.Errorf("matrix is singular")
+	}
+
+	n := m.Rows
+	x := NewMatrix(n, b.Cols)
+	x.vector = b.vector
+	for c := 0; c < b.Cols; c++ {
+		// forward substitution with the unit lower triangle
+		y := make([]float64, n)
+		for i := 0; i < n; i++ {
+			y[i] = b.At(perm[i], c)
+			for j := 0; j < i; j++ {
+				y[i] -= lu.At(i, j) * y[j]
+			}
+		}
+
+		// back substitution with the upper triangle
+		for i := n - 1; i >= 0; i-- {
+			v := y[i]
+			for j := i + 1; j < n; j++ {
+				v -= lu.At(i, j) * x.At(j, c)
+			}
+			x.Set(i, c, v/lu.At(i, i))
+		}
+	}
+
+	return x, nil
+}
+
+// Inverse returns the inverse of a square matrix.
+func (m Matrix) Inverse() (Matrix, error) {
+	if !m.isSquare() || m.vector {
+		return Matrix{}, fmt.Errorf("%w: inv needs a square matrix, got %s", ErrShapeMismatch, m.Shape())
+	}
+
+	return m.Solve(Identity(m.Rows))
+}
+
+// SymmetricEigenvalues returns the eigenvalues of a symmetric matrix in
+// ascending order, computed with the cyclic Jacobi method.
+func (m Matrix) SymmetricEigenvalues() ([]float64, error) {
+	if !m.isSquare() || m.vector {
+		return nil, fmt.Errorf("%w: eig needs a square matrix, got %s", ErrShapeMismatch, m.Shape())
+	}
+
+	n := m.Rows
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if math.Abs(m.At(i, j)-m.At(j, i)) > 1e-9*(1+math.Abs(m.At(i, j))) {
+				return nil, fmt.Errorf("eig only supports symmetric matrices")
+			}
+		}
+	}
+
+	a := m.clone()
+	for sweep := 0; sweep < 100; sweep++ {
+		var off float64
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				off += a.At(i, j) * a.At(i, j)
+			}
+		}
+		if off < 1e-22 {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(a.At(p, q)) < 1e-300 {
+					continue
+				}
+
+				theta := (a.At(q, q) - a.At(p, p)) / (2 * a.At(p, q))
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < n; k++ {
+					akp, akq := a.At(k, p), a.At(k, q)
+					a.Set(k, p, c*akp-s*akq)
+					a.Set(k, q, s*akp+c*akq)
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a.At(p, k), a.At(q, k)
+					a.Set(p, k, c*apk-s*aqk)
+					a.Set(q, k, s*apk+c*aqk)
+				}
+			}
+		}
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = a.At(i, i)
+	}
+	sort.Float64s(values)
+	return values, nil
+}
+
+// elementwiseFunctions are the single argument builtins that are applied
+// to every element when called with a matrix.
+var elementwiseFunctions = map[string]bool{
+	"abs": true, "ceil": true, "floor": true, "round": true, "sqrt": true, "double": true,
+	"log": true, "log10": true, "log2": true,
+	"sin": true, "cos": true, "tan": true, "asin": true, "acos": true, "atan": true,
+	"sinh": true, "cosh": true, "tanh": true, "deg2rad": true, "rad2deg": true,
+}
+
+// Apply implements Applier. Math builtins such as sqrt are applied to each
+// element, other builtins such as sum or len receive vectors as plain
+// arrays so they keep working on list literals.
+func (m Matrix) Apply(ctx context.Context, name string, args []any) (any, error) {
+	if _, ok := matrixFunctions[name]; ok {
+		return nil, ErrUnsupported
+	}
+
+	f, ok := expronaut.BuiltinFunctions[name]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	if elementwiseFunctions[name] && len(args) == 1 {
+		out := m.clone()
+		for i, v := range m.Data {
+			r, err := f(ctx, v)
+			if err != nil {
+				return nil, err
+			}
+			fv, ok := toFloat(r)
+			if !ok {
+				return nil, fmt.Errorf("%s function returned a non numeric value", name)
+			}
+			out.Data[i] = fv
+		}
+		return out, nil
+	}
+
+	plain := make([]any, len(args))
+	for i, arg := range args {
+		plain[i] = arg
+		if am, ok := arg.(Matrix); ok {
+			if !am.vector {
+				return nil, fmt.Errorf("%s function does not accept matrices", name)
+			}
+			values := make([]any, len(am.Data))
+			for j, v := range am.Data {
+				values[j] = v
+			}
+			plain[i] = values
+		}
+	}
+
+	if err := checkArguments(name, plain); err != nil {
+		return nil, err
+	}
+
+	return f(ctx, plain...)
+}
+
+// matrixFunctions are registered as expronaut builtins so they are listed
+// and called like any other function.
+var matrixFunctions = map[string]func(args []Matrix) (any, error){
+	"det": func(args []Matrix) (any, error) {
+		return args[0].Det()
+	},
+	"inv": func(args []Matrix) (any, error) {
+		return args[0].Inverse()
+	},
+	"transpose": func(args []Matrix) (any, error) {
+		return args[0].Transpose(), nil
+	},
+	"dot": func(args []Matrix) (any, error) {
+		a, b := args[0], args[1]
+		if !a.vector || !b.vector || a.Rows != b.Rows {
+			return nil, fmt.Errorf("%w: dot needs two vectors of the same length", ErrShapeMismatch)
+		}
+		var sum float64
+		for i := range a.Data {
+			sum += a.Data[i] * b.Data[i]
+		}
+		return sum, nil
+	},
+	"cross": func(args []Matrix) (any, error) {
+		a, b := args[0], args[1]
+		if !a.vector || !b.vector || a.Rows != 3 || b.Rows != 3 {
+			return nil, fmt.Errorf("%w: cross needs two vectors of length 3", ErrShapeMismatch)
+		}
+		x, y := a.Data, b.Data
+		return NewVector(x[1]*y[2]-x[2]*y[1], x[2]*y[0]-x[0]*y[2], x[0]*y[1]-x[1]*y[0]), nil
+	},
+	"solve": func(args []Matrix) (any, error) {
+		return args[0].Solve(args[1])
+	},
+	"eig": func(args []Matrix) (any, error) {
+		values, err := args[0].SymmetricEigenvalues()
+		if err != nil {
+			return nil, err
+		}
+		return NewVector(values...), nil
+	},
+}
+
+// matrixArity is the number of matrix arguments each function takes.
+var matrixArity = map[string]int{
+	"det": 1, "inv": 1, "transpose": 1, "eig": 1,
+	"dot": 2, "cross": 2, "solve": 2,
+}
+
+func init() {
+	for name, fn := range matrixFunctions {
+		expronaut.RegisterFunction(name, matrixBuiltin(name, fn))
+	}
+
+	expronaut.RegisterFunction("identity", func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("identity function expects a single argument")
+		}
+		n, ok := args[0].(int)
+		if !ok || n < 1 {
+			return nil, fmt.Errorf("identity function expects a positive int argument")
+		}
+		return Identity(n), nil
+	})
+}
+
+func matrixBuiltin(name string, fn func(args []Matrix) (any, error)) func(context.Context, ...any) (any, error) {
+	return func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != matrixArity[name] {
+			return nil, fmt.Errorf("%s function expects %d matrix arguments, got %d", name, matrixArity[name], len(args))
+		}
+
+		matrices := make([]Matrix, len(args))
+		for i, arg := range args {
+			m, ok := arg.(Matrix)
+			if !ok {
+				return nil, fmt.Errorf("%s function expects matrix arguments, got %T", name, arg)
+			}
+			matrices[i] = m
+		}
+
+		return fn(matrices)
+	}
+}
@@ -0,0 +1,66 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMatrixEvaluate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: "[[1,2],[3,4]] + [[1,1],[1,1]]", want: "[[2, 3], [4, 5]]"},
+		{input: "[[1,2],[3,4]] * [[1,0],[0,1]]", want: "[[1, 2], [3, 4]]"},
+		{input: "[[1,2],[3,4]] ** 3", want: "[[37, 54], [81, 118]]"},
+		{input: "[[1,1],[1,0]] ** 10", want: "[[89, 55], [55, 34]]"},
+		{input: "[[1,2],[3,4]] ** 0", want: "[[1, 0], [0, 1]]"},
+		{input: "[[1,2],[3,4]] ** -1", want: "[[-2, 1], [1.5, -0.5]]"},
+		{input: "[1,2] ** 2", err: ErrShapeMismatch},
+		{input: "[[1,2],[3,4]] * [[1,2,3]]", err: ErrShapeMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatrixPowLargeExponent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := Evaluate(ctx, "[[1,2],[3,4]] ** 1000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("took %s", d)
+	}
+}
+
+func TestMatrixPowCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m := Matrix{Rows: 2, Cols: 2, Data: []float64{1, 2, 3, 4}}
+	if _, err := m.Pow(ctx, 5); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+}
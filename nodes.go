@@ -0,0 +1,102 @@
+package goculator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+// UnaryOperationNode represents a prefix operator such as the minus in -x.
+type UnaryOperationNode struct {
+	Operator expronaut.TokenType
+	Operand  expronaut.ASTNode
+}
+
+// Evaluate computes the value of the unary operation.
+func (n *UnaryOperationNode) Evaluate(ctx context.Context) (any, error) {
+	return Eval(ctx, n)
+}
+
+func (n *UnaryOperationNode) String() string {
+	return fmt.Sprintf("(%s %s)", n.Operator, n.Operand.String())
+}
+
+// GoTemplate returns the Go template representation of the unary operation.
+func (n *UnaryOperationNode) GoTemplate() string {
+	operand := n.Operand.GoTemplate()
+	if _, ok := n.Operand.(*expronaut.BinaryOperationNode); ok {
+		operand = fmt.Sprintf("(%s)", operand)
+	}
+
+	if n.Operator == expronaut.TokenTypeMinus {
+		return fmt.Sprintf("sub 0 %s", operand)
+	}
+
+	return operand
+}
+
+// ConversionNode represents a conversion such as "3 km in m" or
+// "120 EUR to USD".
+type ConversionNode struct {
+	Value   expronaut.ASTNode
+	Keyword string // "in" or "to", kept to print the expression back
+	Target  expronaut.ASTNode
+}
+
+// Evaluate computes the converted value.
+func (n *ConversionNode) Evaluate(ctx context.Context) (any, error) {
+	return Eval(ctx, n)
+}
+
+func (n *ConversionNode) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.Value.String(), n.Keyword, n.Target.String())
+}
+
+// GoTemplate returns the Go template representation of the converted value.
+// Templates have no notion of units, so only the value is rendered.
+func (n *ConversionNode) GoTemplate() string {
+	return n.Value.GoTemplate()
+}
+
+// MatrixNode represents a bracketed literal without a type prefix, such as
+// [1, 2, 3] or [[1, 2], [3, 4]]. Rows of numbers evaluate to a Matrix, any
+// other content to a plain array like expronaut's typed arrays.
+type MatrixNode struct {
+	Elements []expronaut.ASTNode
+}
+
+// Evaluate computes the value of the literal.
+func (n *MatrixNode) Evaluate(ctx context.Context) (any, error) {
+	return Eval(ctx, n)
+}
+
+func (n *MatrixNode) String() string {
+	elements := make([]string, len(n.Elements))
+	for i, element := range n.Elements {
+		elements[i] = element.String()
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+// GoTemplate returns the Go template representation of the literal.
+func (n *MatrixNode) GoTemplate() string {
+	elements := make([]string, len(n.Elements))
+	for i, element := range n.Elements {
+		elements[i] = element.GoTemplate()
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+// valueNode wraps an already evaluated value so it can be handed to the
+// expronaut nodes, which only operate on nodes.
+type valueNode struct {
+	value any
+}
+
+func (n valueNode) Evaluate(ctx context.Context) (any, error) { return n.value, nil }
+func (n valueNode) String() string                            { return fmt.Sprint(n.value) }
+func (n valueNode) GoTemplate() string                        { return fmt.Sprint(n.value) }
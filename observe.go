@@ -0,0 +1,36 @@
+package goculator
+
+import "sync"
+
+var (
+	callObserverMu sync.RWMutex
+	callObserver   func(name string, err error)
+)
+
+// SetCallObserver sets a function called after every call of a builtin or
+// lazy function with the error it returned, for instance to count them.
+// Calls of functions defined by the user and of unknown functions are not
+// reported, the builtins the body of a user function calls are.
+func SetCallObserver(observer func(name string, err error)) {
+	callObserverMu.Lock()
+	defer callObserverMu.Unlock()
+
+	callObserver = observer
+}
+
+func observeCall(name string, err error) {
+	callObserverMu.RLock()
+	observer := callObserver
+	callObserverMu.RUnlock()
+
+	if observer == nil {
+		return
+	}
+
+	// unknown names are not reported, so they can be used as labels
+	if _, lazy := lazyFunctions[name]; !lazy && !isBuiltin(name) {
+		return
+	}
+
+	observer(name, err)
+}
@@ -0,0 +1,349 @@
+package goculator
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/donseba/expronaut"
+)
+
+// Span is a byte range in the parsed input.
+type Span struct {
+	Pos int `json:"pos"`
+	End int `json:"end"`
+}
+
+// Tree is the result of parsing an expression. The nodes are the expronaut
+// AST node types, extended with the goculator specific nodes from nodes.go.
+type Tree struct {
+	Input string
+	Root  expronaut.ASTNode
+
+	spans map[expronaut.ASTNode]Span
+}
+
+// Span returns the part of the input the node was parsed from.
+func (t *Tree) Span(node expronaut.ASTNode) (Span, bool) {
+	s, ok := t.spans[node]
+	return s, ok
+}
+
+// Source returns the input text the node was parsed from.
+func (t *Tree) Source(node expronaut.ASTNode) string {
+	s, ok := t.spans[node]
+	if !ok {
+		return ""
+	}
+	return t.Input[s.Pos:s.End]
+}
+
+// SyntaxError describes why and where the input could not be parsed.
+type SyntaxError struct {
+	Span
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// Parser is a recursive descent parser producing expronaut AST nodes.
+//
+// Unlike the expronaut parser it reports every token it could not consume,
+// treats a '-' in front of a number as binary minus when an operand precedes
+// it, and supports the goculator additions: implicit multiplication of a
+// value by an identifier ("3 km"), "in"/"to" conversions, matrix literals
+// and the elementwise operators.
+type Parser struct {
+	tokens  []Token
+	current int
+	spans   map[expronaut.ASTNode]Span
+}
+
+// Parse parses the input into a tree.
+func Parse(input string) (tree *Tree, err error) {
+	p := &Parser{
+		tokens: Tokenize(input),
+		spans:  make(map[expronaut.ASTNode]Span),
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			tree, err = nil, se
+		}
+	}()
+
+	if p.check(expronaut.TokenTypeEOF) {
+		p.fail(p.peek(), "empty expression")
+	}
+
+	root := p.expression()
+	if !p.check(expronaut.TokenTypeEOF) {
+		p.fail(p.peek(), fmt.Sprintf("unexpected %q", p.peek().Literal))
+	}
+
+	return &Tree{Input: input, Root: root, spans: p.spans}, nil
+}
+
+// conversionKeywords are the identifiers that act as the conversion operator
+// when they appear after an operand.
+var conversionKeywords = map[string]bool{
+	"in": true,
+	"to": true,
+}
+
+// expression handles the lowest precedence level: unit and currency
+// conversion with "in" or "to".
+func (p *Parser) expression() expronaut.ASTNode {
+	start := p.peek().Pos
+	node := p.logicalOr()
+
+	for p.check(expronaut.TokenTypeVariable) && conversionKeywords[p.peek().Literal] {
+		keyword := p.advance().Literal
+		target := p.logicalOr()
+		node = p.mark(&ConversionNode{Value: node, Keyword: keyword, Target: target}, start)
+	}
+
+	return node
+}
+
+// logicalOr handles ||.
+func (p *Parser) logicalOr() expronaut.ASTNode {
+	start := p.peek().Pos
+	node := p.logicalAnd()
+
+	for p.match(expronaut.TokenTypeOr) {
+		operator := p.previous()
+		right := p.logicalAnd()
+		node = p.mark(&expronaut.LogicalOperationNode{Left: node, Operator: operator.Type, Right: right}, start)
+	}
+
+	return node
+}
+
+// logicalAnd handles &&.
+func (p *Parser) logicalAnd() expronaut.ASTNode {
+	start := p.peek().Pos
+	node := p.equality()
+
+	for p.match(expronaut.TokenTypeAnd) {
+		operator := p.previous()
+		right := p.equality()
+		node = p.mark(&expronaut.LogicalOperationNode{Left: node, Operator: operator.Type, Right: right}, start)
+	}
+
+	return node
+}
+
+// equality handles == and !=.
+func (p *Parser) equality() expronaut.ASTNode {
+	return p.binary(p.comparison, expronaut.TokenTypeEqual, expronaut.TokenTypeNotEqual)
+}
+
+// comparison handles <, <=, >, and >=.
+func (p *Parser) comparison() expronaut.ASTNode {
+	return p.binary(p.shift,
+		expronaut.TokenTypeGreaterThan, expronaut.TokenTypeGreaterThanOrEqual,
+		expronaut.TokenTypeLessThan, expronaut.TokenTypeLessThanOrEqual)
+}
+
+// shift handles << and >>.
+func (p *Parser) shift() expronaut.ASTNode {
+	return p.binary(p.addition, expronaut.TokenTypeLeftShift, expronaut.TokenTypeRightShift)
+}
+
+// addition handles + and -.
+func (p *Parser) addition() expronaut.ASTNode {
+	return p.binary(p.multiplication, expronaut.TokenTypePlus, expronaut.TokenTypeMinus)
+}
+
+// multiplication handles *, /, //, % and the elementwise .* and ./.
+func (p *Parser) multiplication() expronaut.ASTNode {
+	return p.binary(p.implicit,
+		expronaut.TokenTypeMultiply, expronaut.TokenTypeDivide,
+		expronaut.TokenTypeDivideInteger, expronaut.TokenTypeModulo,
+		TokenTypeElementwiseMultiply, TokenTypeElementwiseDivide)
+}
+
+// binary parses a left associative chain of the given operators.
+func (p *Parser) binary(next func() expronaut.ASTNode, operators ...expronaut.TokenType) expronaut.ASTNode {
+	start := p.peek().Pos
+	node := next()
+
+	for p.match(operators...) {
+		operator := p.previous()
+		right := next()
+		node = p.mark(&expronaut.BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, start)
+	}
+
+	return node
+}
+
+// implicit handles a value directly followed by an identifier, such as
+// "3 km" or "2 pi". It binds tighter than the explicit operators so that
+// "3 km / 20 min" divides two quantities.
+func (p *Parser) implicit() expronaut.ASTNode {
+	start := p.peek().Pos
+	node := p.unary()
+
+	for p.check(expronaut.TokenTypeVariable) && !conversionKeywords[p.peek().Literal] {
+		right := p.power()
+		node = p.mark(&expronaut.BinaryOperationNode{Left: node, Operator: expronaut.TokenTypeMultiply, Right: right}, start)
+	}
+
+	return node
+}
+
+// unary handles a leading - or +.
+func (p *Parser) unary() expronaut.ASTNode {
+	if p.match(expronaut.TokenTypeMinus, expronaut.TokenTypePlus) {
+		operator := p.previous()
+		operand := p.unary()
+		return p.mark(&UnaryOperationNode{Operator: operator.Type, Operand: operand}, operator.Pos)
+	}
+
+	return p.power()
+}
+
+// power handles **, ^ and .^, which are right associative and bind tighter
+// than a unary minus on their left: -2**2 is -(2**2).
+func (p *Parser) power() expronaut.ASTNode {
+	start := p.peek().Pos
+	node := p.primary()
+
+	if p.match(expronaut.TokenTypeExponent, TokenTypeElementwisePower) {
+		operator := p.previous()
+		right := p.unary()
+		node = p.mark(&expronaut.BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, start)
+	}
+
+	return node
+}
+
+// primary handles literals, variables, calls, arrays and grouping.
+func (p *Parser) primary() expronaut.ASTNode {
+	tok := p.peek()
+
+	switch {
+	case p.match(expronaut.TokenTypeInt):
+		value, err := strconv.Atoi(tok.Literal)
+		if err != nil {
+			// too large for an int, keep it as a float
+			f, _ := strconv.ParseFloat(tok.Literal, 64)
+			return p.mark(&expronaut.FloatLiteralNode{Value: f}, tok.Pos)
+		}
+		return p.mark(&expronaut.IntLiteralNode{Value: value}, tok.Pos)
+	case p.match(expronaut.TokenTypeFloat):
+		value, err := strconv.ParseFloat(tok.Literal, 64)
+		if err != nil {
+			p.fail(tok, fmt.Sprintf("invalid number %q", tok.Literal))
+		}
+		return p.mark(&expronaut.FloatLiteralNode{Value: value}, tok.Pos)
+	case p.match(expronaut.TokenTypeString):
+		return p.mark(&expronaut.StringLiteralNode{Value: tok.Literal}, tok.Pos)
+	case p.match(expronaut.TokenTypeBool):
+		return p.mark(&expronaut.BooleanLiteralNode{Value: tok.Literal == "true"}, tok.Pos)
+	case p.match(expronaut.TokenTypeVariable):
+		return p.mark(&expronaut.VariableNode{Name: tok.Literal}, tok.Pos)
+	case p.match(expronaut.TokenTypeParenLeft):
+		expr := p.expression()
+		p.consume(expronaut.TokenTypeParenRight, "expected ')' after expression")
+		return expr
+	case p.match(expronaut.TokenTypeFunction):
+		p.consume(expronaut.TokenTypeParenLeft, "expected '(' after function")
+		arguments := p.list(expronaut.TokenTypeParenRight, "expected ')' after arguments to function")
+		return p.mark(&expronaut.FunctionCallNode{FunctionName: tok.Literal, Arguments: arguments}, tok.Pos)
+	case p.match(expronaut.TokenTypeArray):
+		// the element type prefix is informational only, expronaut evaluates
+		// every array to []any
+		p.consume(expronaut.TokenTypeArrayStart, "expected '[' after array type")
+		elements := p.list(expronaut.TokenTypeArrayEnd, "expected ']' after array elements")
+		return p.mark(&expronaut.ArrayNode{Elements: elements}, tok.Pos)
+	case p.match(expronaut.TokenTypeArrayStart):
+		elements := p.list(expronaut.TokenTypeArrayEnd, "expected ']' after array elements")
+		return p.mark(&MatrixNode{Elements: elements}, tok.Pos)
+	case tok.Type == expronaut.TokenTypeEOF:
+		p.fail(tok, "unexpected end of input")
+	}
+
+	p.fail(tok, fmt.Sprintf("unexpected %q", tok.Literal))
+	return nil
+}
+
+// list parses comma separated expressions up to and including the closing
+// token.
+func (p *Parser) list(closing expronaut.TokenType, message string) []expronaut.ASTNode {
+	var nodes []expronaut.ASTNode
+
+	if !p.check(closing) {
+		for {
+			nodes = append(nodes, p.expression())
+
+			if !p.match(expronaut.TokenTypeComma) {
+				break
+			}
+		}
+	}
+
+	p.consume(closing, message)
+	return nodes
+}
+
+// mark records the span of the node, from start up to the end of the last
+// consumed token.
+func (p *Parser) mark(node expronaut.ASTNode, start int) expronaut.ASTNode {
+	p.spans[node] = Span{Pos: start, End: p.previous().End}
+	return node
+}
+
+func (p *Parser) fail(tok Token, message string) {
+	panic(&SyntaxError{Span: Span{Pos: tok.Pos, End: tok.End}, Msg: message})
+}
+
+// previous returns the previous token.
+func (p *Parser) previous() Token {
+	return p.tokens[p.current-1]
+}
+
+// consume expects the next token to be of a given type and consumes it.
+func (p *Parser) consume(tokenType expronaut.TokenType, message string) Token {
+	if p.check(tokenType) {
+		return p.advance()
+	}
+
+	p.fail(p.peek(), message)
+	return Token{}
+}
+
+// check looks at the current token and returns true if it matches the given type.
+func (p *Parser) check(typ expronaut.TokenType) bool {
+	return p.peek().Type == typ
+}
+
+// peek returns the current token without consuming it.
+func (p *Parser) peek() Token {
+	return p.tokens[p.current]
+}
+
+// advance consumes the current token and returns it.
+func (p *Parser) advance() Token {
+	if !p.check(expronaut.TokenTypeEOF) {
+		p.current++
+	}
+	return p.tokens[p.current-1]
+}
+
+// match checks if the current token matches any of the given types.
+func (p *Parser) match(types ...expronaut.TokenType) bool {
+	for _, typ := range types {
+		if p.check(typ) {
+			p.advance()
+			return true
+		}
+	}
+	return false
+}
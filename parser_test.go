@@ -0,0 +1,62 @@
+package goculator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+	}{
+		{input: "1 +", pos: 3},
+		{input: "(1 + 2", pos: 6},
+		{input: "1 + 2)", pos: 5},
+		{input: "sqrt(1,", pos: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("got error %v, want a syntax error", err)
+			}
+			if se.Pos != tt.pos {
+				t.Fatalf("got position %d, want %d", se.Pos, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	tree, err := Parse("1 + 2 km")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tree.Source(tree.Root); got != "1 + 2 km" {
+		t.Fatalf("got root source %q", got)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("a .* b ** -2")
+
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, string(tok.Type))
+	}
+
+	want := []string{"VARIABLE", "ELEMENTWISE_MULTIPLY", "VARIABLE", "EXPONENT", "MINUS", "INT", "EOF"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
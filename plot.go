@@ -0,0 +1,268 @@
+package goculator
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+// PlotSamples is the number of points sampled per series.
+var PlotSamples = 400
+
+// seriesColors are used in order for the series of a plot.
+var seriesColors = []string{"#2563eb", "#dc2626", "#16a34a", "#d97706", "#7c3aed", "#db2777"}
+
+// Series is a sampled expression. Y is NaN where the expression has no
+// numeric value.
+type Series struct {
+	Expr string
+	X, Y []float64
+}
+
+// Plot is the value of the plot builtin: one or more expressions sampled
+// over a range of a variable.
+type Plot struct {
+	Variable string
+	From, To float64
+	Series   []Series
+}
+
+func init() {
+	RegisterLazyFunction("plot", plot)
+}
+
+// plot implements plot(expr, x, from, to). Several expressions can be
+// plotted at once by passing them as a list: plot([sin(x), cos(x)], x, 0, 6).
+func plot(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("plot function expects four arguments: an expression, a variable, from and to")
+	}
+
+	exprs := []expronaut.ASTNode{args[0]}
+	if list, ok := args[0].(*MatrixNode); ok {
+		exprs = list.Elements
+	}
+
+	sources := make([]string, len(exprs))
+	for i, e := range exprs {
+		node, err := ExpressionArg(e)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = Infix(node)
+	}
+
+	variable, err := VariableArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := NumberArg(ctx, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := NumberArg(ctx, args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPlot(ctx, sources, variable, from, to)
+}
+
+// NewPlot samples every expression for PlotSamples values of variable
+// between from and to.
+func NewPlot(ctx context.Context, exprs []string, variable string, from, to float64) (*Plot, error) {
+	if len(exprs) == 0 {
+		return nil, fmt.Errorf("nothing to plot")
+	}
+	if !(from < to) || math.IsInf(from, 0) || math.IsInf(to, 0) {
+		return nil, fmt.Errorf("plot range must satisfy from < to, got %s to %s", Format(from), Format(to))
+	}
+
+	p := &Plot{Variable: variable, From: from, To: to}
+	for _, expr := range exprs {
+		tree, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		s := Series{Expr: expr, X: make([]float64, PlotSamples), Y: make([]float64, PlotSamples)}
+		var (
+			defined  bool
+			firstErr error
+		)
+		for i := range s.X {
+			x := from + (to-from)*float64(i)/float64(PlotSamples-1)
+			s.X[i], s.Y[i] = x, math.NaN()
+
+			v, err := Eval(WithVariable(ctx, variable, x), tree.Root)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				// points where the expression is undefined become gaps
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			if y, ok := toFloat(v); ok && !math.IsInf(y, 0) && !math.IsNaN(y) {
+				s.Y[i], defined = y, true
+			}
+		}
+
+		if !defined {
+			if firstErr != nil {
+				return nil, fmt.Errorf("cannot plot %s: %w", expr, firstErr)
+			}
+			return nil, fmt.Errorf("cannot plot %s: it has no numeric value between %s and %s", expr, Format(from), Format(to))
+		}
+
+		p.Series = append(p.Series, s)
+	}
+
+	return p, nil
+}
+
+func (p *Plot) String() string {
+	exprs := make([]string, len(p.Series))
+	for i, s := range p.Series {
+		exprs[i] = s.Expr
+	}
+
+	return fmt.Sprintf("plot of %s for %s from %s to %s", strings.Join(exprs, ", "), p.Variable, Format(p.From), Format(p.To))
+}
+
+// yRange picks the vertical range. Outliers, such as tan near its poles,
+// are cut off when they would flatten the rest of the graph.
+func (p *Plot) yRange() (float64, float64) {
+	var ys []float64
+	for _, s := range p.Series {
+		for _, y := range s.Y {
+			if !math.IsNaN(y) {
+				ys = append(ys, y)
+			}
+		}
+	}
+
+	if len(ys) == 0 {
+		return -1, 1
+	}
+	sort.Float64s(ys)
+
+	lo, hi := ys[0], ys[len(ys)-1]
+	qlo, qhi := ys[len(ys)*5/100], ys[len(ys)*95/100]
+	if spread := qhi - qlo; spread > 0 && hi-lo > 10*spread {
+		lo, hi = qlo-spread/2, qhi+spread/2
+	}
+
+	if lo == hi {
+		lo, hi = lo-1, hi+1
+	}
+
+	pad := (hi - lo) * 0.05
+	return lo - pad, hi + pad
+}
+
+// niceTicks returns round tick positions covering lo to hi.
+func niceTicks(lo, hi float64, count int) []float64 {
+	raw := (hi - lo) / float64(count)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+
+	step := mag * 10
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*mag {
+			step = m * mag
+			break
+		}
+	}
+
+	var ticks []float64
+	for t := math.Ceil(lo/step) * step; t <= hi; t += step {
+		// avoid -0 and rounding noise in the labels
+		ticks = append(ticks, math.Round(t/step)*step)
+	}
+	return ticks
+}
+
+// SVG renders the plot as a standalone SVG document with axes, a grid and
+// a legend. Gaps are left where a series has no value, and where it jumps
+// across the whole visible range, which is how poles and other
+// discontinuities show up between two samples.
+func (p *Plot) SVG(width, height int) string {
+	const (
+		left, right, top, bottom = 48.0, 12.0, 12.0, 28.0
+	)
+
+	w, h := float64(width), float64(height)
+	pw, ph := w-left-right, h-top-bottom
+	ylo, yhi := p.yRange()
+
+	sx := func(x float64) float64 { return left + (x-p.From)/(p.To-p.From)*pw }
+	sy := func(y float64) float64 { return top + (yhi-y)/(yhi-ylo)*ph }
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="10">`, width, height, width, height)
+	fmt.Fprintf(&sb, `<defs><clipPath id="plot-area"><rect x="%g" y="%g" width="%g" height="%g"/></clipPath></defs>`, left, top, pw, ph)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="white"/>`, width, height)
+
+	// grid and tick labels
+	for _, t := range niceTicks(p.From, p.To, 8) {
+		fmt.Fprintf(&sb, `<line x1="%.1f" y1="%g" x2="%.1f" y2="%g" stroke="#e5e7eb"/>`, sx(t), top, sx(t), top+ph)
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%g" text-anchor="middle" fill="#6b7280">%s</text>`, sx(t), h-bottom+14, formatFloat(t))
+	}
+	for _, t := range niceTicks(ylo, yhi, 6) {
+		fmt.Fprintf(&sb, `<line x1="%g" y1="%.1f" x2="%g" y2="%.1f" stroke="#e5e7eb"/>`, left, sy(t), left+pw, sy(t))
+		fmt.Fprintf(&sb, `<text x="%g" y="%.1f" text-anchor="end" fill="#6b7280">%s</text>`, left-4, sy(t)+3, formatFloat(t))
+	}
+
+	// axes through the origin when it is visible
+	if p.From < 0 && p.To > 0 {
+		fmt.Fprintf(&sb, `<line x1="%.1f" y1="%g" x2="%.1f" y2="%g" stroke="#9ca3af"/>`, sx(0), top, sx(0), top+ph)
+	}
+	if ylo < 0 && yhi > 0 {
+		fmt.Fprintf(&sb, `<line x1="%g" y1="%.1f" x2="%g" y2="%.1f" stroke="#9ca3af"/>`, left, sy(0), left+pw, sy(0))
+	}
+	fmt.Fprintf(&sb, `<rect x="%g" y="%g" width="%g" height="%g" fill="none" stroke="#9ca3af"/>`, left, top, pw, ph)
+
+	span := yhi - ylo
+	for i, s := range p.Series {
+		d := strings.Builder{}
+		pen := false
+		for j := range s.X {
+			y := s.Y[j]
+			if math.IsNaN(y) || y < ylo-span || y > yhi+span {
+				pen = false
+				continue
+			}
+			if pen && math.Abs(y-s.Y[j-1]) > span {
+				pen = false
+			}
+
+			cmd := "L"
+			if !pen {
+				cmd = "M"
+			}
+			fmt.Fprintf(&d, "%s%.1f,%.1f", cmd, sx(s.X[j]), sy(y))
+			pen = true
+		}
+
+		color := seriesColors[i%len(seriesColors)]
+		fmt.Fprintf(&sb, `<path d="%s" fill="none" stroke="%s" stroke-width="1.5" clip-path="url(#plot-area)"/>`, d.String(), color)
+
+		// legend
+		ly := top + 8 + float64(i)*14
+		fmt.Fprintf(&sb, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="2"/>`, left+8, ly, left+22, ly, color)
+		fmt.Fprintf(&sb, `<text x="%g" y="%g" fill="#111827">%s</text>`, left+26, ly+3, html.EscapeString(s.Expr))
+	}
+
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}
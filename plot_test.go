@@ -0,0 +1,115 @@
+package goculator
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPlotEvaluate(t *testing.T) {
+	tests := []struct {
+		input   string
+		series  int
+		wantErr bool
+	}{
+		{input: "plot(sin(x), x, 0, 6)", series: 1},
+		{input: "plot([sin(x), cos(x)], x, 0, 6)", series: 2},
+		{input: "plot(1/x, x, -1, 1)", series: 1},
+		{input: "plot(sqrt(x), x, -4, 4)", series: 1},
+		{input: "plot(sin(x), x, 6, 0)", wantErr: true},
+		{input: "plot(sin(x), x, 0)", wantErr: true},
+		{input: "plot(sin(x), 2, 0, 6)", wantErr: true},
+		{input: "plot(sqrt(x), x, -4, -1)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", Format(out))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, ok := out.(*Plot)
+			if !ok {
+				t.Fatalf("got %T, want a plot", out)
+			}
+			if len(p.Series) != tt.series {
+				t.Fatalf("got %d series, want %d", len(p.Series), tt.series)
+			}
+			for _, s := range p.Series {
+				if len(s.X) != PlotSamples || len(s.Y) != PlotSamples {
+					t.Fatalf("got %d samples, want %d", len(s.X), PlotSamples)
+				}
+			}
+		})
+	}
+}
+
+func TestPlotGaps(t *testing.T) {
+	p, err := NewPlot(context.Background(), []string{"sqrt(x)"}, "x", -1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := p.Series[0]
+	for i, x := range s.X {
+		if gap := math.IsNaN(s.Y[i]); gap != (x < 0) {
+			t.Fatalf("x = %g: got gap %v", x, gap)
+		}
+	}
+}
+
+func TestPlotSVG(t *testing.T) {
+	p, err := NewPlot(context.Background(), []string{"tan(x)", "x"}, "x", -3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := p.SVG(600, 300)
+	if !strings.HasPrefix(svg, "<svg") || !strings.HasSuffix(svg, "</svg>") {
+		t.Fatalf("not an SVG document: %.80s", svg)
+	}
+	if got := strings.Count(svg, "<path "); got != 2 {
+		t.Fatalf("got %d paths, want 2", got)
+	}
+	// tan is broken up at its poles
+	tan := svg[strings.Index(svg, "<path "):]
+	tan = tan[:strings.Index(tan, "/>")]
+	if got := strings.Count(tan, "M"); got < 2 {
+		t.Fatalf("tan is drawn in %d pieces, want it broken at its poles", got)
+	}
+	if strings.Contains(svg, "NaN") {
+		t.Fatal("the SVG contains NaN")
+	}
+}
+
+func TestNiceTicks(t *testing.T) {
+	tests := []struct {
+		lo, hi float64
+		count  int
+		want   []float64
+	}{
+		{lo: 0, hi: 10, count: 5, want: []float64{0, 2, 4, 6, 8, 10}},
+		{lo: -1, hi: 1, count: 4, want: []float64{-1, -0.5, 0, 0.5, 1}},
+		{lo: 0.1, hi: 0.95, count: 8, want: []float64{0.2, 0.4, 0.6, 0.8}},
+	}
+
+	for _, tt := range tests {
+		got := niceTicks(tt.lo, tt.hi, tt.count)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%g to %g: got %v, want %v", tt.lo, tt.hi, got, tt.want)
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+				t.Fatalf("%g to %g: got %v, want %v", tt.lo, tt.hi, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotAllowed is returned when an expression calls a function the policy
+// of the context does not allow.
+var ErrNotAllowed = errors.New("function not allowed")
+
+type policyKey struct{}
+
+// WithFunctionPolicy returns a context in which only the builtin and lazy
+// functions the policy allows can be called. Functions defined by the user
+// are always allowed, the functions their body calls are checked when it is
+// evaluated.
+func WithFunctionPolicy(ctx context.Context, allow func(name string) bool) context.Context {
+	return context.WithValue(ctx, policyKey{}, allow)
+}
+
+// checkPolicy returns an error when the policy of ctx does not allow calling
+// the function.
+func checkPolicy(ctx context.Context, name string) error {
+	allow, _ := ctx.Value(policyKey{}).(func(string) bool)
+	if allow == nil {
+		return nil
+	}
+
+	fs, _ := ctx.Value(functionsKey{}).(*Functions)
+	if _, ok := fs.Get(name); ok || allow(name) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrNotAllowed, name)
+}
+
+// Allowed reports whether the policy of ctx allows calling the function.
+func Allowed(ctx context.Context, name string) bool {
+	return checkPolicy(ctx, name) == nil
+}
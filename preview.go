@@ -0,0 +1,94 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/donseba/expronaut"
+)
+
+// impureFunctions are the builtins with side effects or results that differ
+// between calls, which a preview does not call.
+var impureFunctions = map[string]bool{
+	"ai":      true,
+	"predict": true,
+	"rand":    true,
+	"shuffle": true,
+}
+
+// Pure reports whether calling the builtin twice with the same arguments
+// gives the same result without side effects.
+func Pure(name string) bool {
+	return !impureFunctions[name]
+}
+
+// Preview calculates the input as it is being typed, without side effects.
+// An assignment gives the value it would assign, a definition is checked and
+// gives the function without defining it. Calls to builtins that are not
+// Pure fail with ErrNotAllowed, on top of the policy of ctx.
+func Preview(ctx context.Context, input string) (any, error) {
+	parent := ctx
+	ctx = WithFunctionPolicy(ctx, func(name string) bool {
+		return Pure(name) && Allowed(parent, name)
+	})
+
+	if f, err := ParseDefinition(input); !errors.Is(err, ErrNotDefinition) {
+		if err != nil {
+			return nil, err
+		}
+		fs, _ := ctx.Value(functionsKey{}).(*Functions)
+		if fs == nil {
+			fs = NewFunctions()
+		}
+		if err := fs.validate(f); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	if _, tree, err := ParseAssignment(input); !errors.Is(err, ErrNotAssignment) {
+		if err != nil {
+			return nil, err
+		}
+		return tree.Evaluate(ctx)
+	}
+
+	return Evaluate(ctx, input)
+}
+
+// UnmatchedBrackets returns the spans of the parentheses and square brackets
+// of the input that are not closed, not opened, or closed by the other kind.
+func UnmatchedBrackets(input string) []Span {
+	closing := map[expronaut.TokenType]expronaut.TokenType{
+		expronaut.TokenTypeParenLeft:  expronaut.TokenTypeParenRight,
+		expronaut.TokenTypeArrayStart: expronaut.TokenTypeArrayEnd,
+	}
+
+	var (
+		open []Token
+		out  []Span
+	)
+	for _, tok := range Tokenize(input) {
+		switch tok.Type {
+		case expronaut.TokenTypeParenLeft, expronaut.TokenTypeArrayStart:
+			open = append(open, tok)
+		case expronaut.TokenTypeParenRight, expronaut.TokenTypeArrayEnd:
+			if len(open) == 0 {
+				out = append(out, Span{Pos: tok.Pos, End: tok.End})
+				continue
+			}
+			last := open[len(open)-1]
+			open = open[:len(open)-1]
+			if closing[last.Type] != tok.Type {
+				out = append(out, Span{Pos: last.Pos, End: last.End}, Span{Pos: tok.Pos, End: tok.End})
+			}
+		}
+	}
+	for _, tok := range open {
+		out = append(out, Span{Pos: tok.Pos, End: tok.End})
+	}
+
+	slices.SortFunc(out, func(a, b Span) int { return a.Pos - b.Pos })
+	return out
+}
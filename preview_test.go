@@ -0,0 +1,71 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+		err     error
+	}{
+		{input: "1 + 2", want: "3"},
+		{input: "r = 2 km", want: "2 km"},
+		{input: "f(x) = x + 1", want: "f(x) = x + 1"},
+		{input: "rand()", wantErr: true, err: ErrNotAllowed},
+		{input: "1 >> -1", wantErr: true},
+		{input: "sum([1, [2]])", wantErr: true, err: ErrInternal},
+		{input: "1 +", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Preview(context.Background(), tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", Format(out))
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmatchedBrackets(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Span
+	}{
+		{input: "(1 + 2)"},
+		{input: "(1 + 2", want: []Span{{Pos: 0, End: 1}}},
+		{input: "1 + 2)", want: []Span{{Pos: 5, End: 6}}},
+		{input: "(1, 2]", want: []Span{{Pos: 0, End: 1}, {Pos: 5, End: 6}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := UnmatchedBrackets(tt.input)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package goculator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+// operatorSymbols maps token types back to the syntax the parser reads.
+var operatorSymbols = map[expronaut.TokenType]string{
+	expronaut.TokenTypeAnd:                "&&",
+	expronaut.TokenTypeOr:                 "||",
+	expronaut.TokenTypePlus:               "+",
+	expronaut.TokenTypeMinus:              "-",
+	expronaut.TokenTypeMultiply:           "*",
+	expronaut.TokenTypeDivide:             "/",
+	expronaut.TokenTypeDivideInteger:      "//",
+	expronaut.TokenTypeModulo:             "%",
+	expronaut.TokenTypeEqual:              "==",
+	expronaut.TokenTypeNotEqual:           "!=",
+	expronaut.TokenTypeLessThan:           "<",
+	expronaut.TokenTypeGreaterThan:        ">",
+	expronaut.TokenTypeLessThanOrEqual:    "<=",
+	expronaut.TokenTypeGreaterThanOrEqual: ">=",
+	expronaut.TokenTypeExponent:           "**",
+	expronaut.TokenTypeLeftShift:          "<<",
+	expronaut.TokenTypeRightShift:         ">>",
+	TokenTypeElementwiseMultiply:          ".*",
+	TokenTypeElementwiseDivide:            "./",
+	TokenTypeElementwisePower:             ".^",
+}
+
+// Precedence levels, mirroring the parser from lowest to highest.
+const (
+	precConversion = iota + 1
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precShift
+	precAddition
+	precMultiplication
+	precUnary
+	precPower
+	precPrimary
+)
+
+func precedence(node expronaut.ASTNode) int {
+	switch n := node.(type) {
+	case *ConversionNode:
+		return precConversion
+	case *expronaut.LogicalOperationNode:
+		if n.Operator == expronaut.TokenTypeOr {
+			return precOr
+		}
+		return precAnd
+	case *expronaut.BinaryOperationNode:
+		return operatorPrecedence(n.Operator)
+	case *UnaryOperationNode:
+		return precUnary
+	case *expronaut.IntLiteralNode:
+		if n.Value < 0 {
+			return precUnary
+		}
+	case *expronaut.FloatLiteralNode:
+		if n.Value < 0 {
+			return precUnary
+		}
+	}
+	return precPrimary
+}
+
+func operatorPrecedence(op expronaut.TokenType) int {
+	switch op {
+	case expronaut.TokenTypeEqual, expronaut.TokenTypeNotEqual:
+		return precEquality
+	case expronaut.TokenTypeLessThan, expronaut.TokenTypeLessThanOrEqual,
+		expronaut.TokenTypeGreaterThan, expronaut.TokenTypeGreaterThanOrEqual:
+		return precComparison
+	case expronaut.TokenTypeLeftShift, expronaut.TokenTypeRightShift:
+		return precShift
+	case expronaut.TokenTypePlus, expronaut.TokenTypeMinus:
+		return precAddition
+	case expronaut.TokenTypeExponent, TokenTypeElementwisePower:
+		return precPower
+	}
+	return precMultiplication
+}
+
+// Infix prints a node back in the syntax the parser reads, using only the
+// parentheses the precedence rules require. Unlike the String methods of
+// the expronaut nodes the output can be parsed and evaluated again.
+func Infix(node expronaut.ASTNode) string {
+	switch n := node.(type) {
+	case *expronaut.IntLiteralNode:
+		return strconv.Itoa(n.Value)
+	case *expronaut.FloatLiteralNode:
+		s := strconv.FormatFloat(n.Value, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEIN") {
+			// keep it a float when parsed again
+			s += ".0"
+		}
+		return s
+	case *expronaut.StringLiteralNode:
+		if strings.Contains(n.Value, `"`) {
+			return "'" + n.Value + "'"
+		}
+		return `"` + n.Value + `"`
+	case *expronaut.BooleanLiteralNode:
+		return strconv.FormatBool(n.Value)
+	case *expronaut.VariableNode:
+		return n.Name
+	case *UnaryOperationNode:
+		return operatorSymbols[n.Operator] + wrap(n.Operand, precUnary, false)
+	case *expronaut.BinaryOperationNode:
+		// ** is right associative, everything else is left associative
+		right := n.Operator == expronaut.TokenTypeExponent || n.Operator == TokenTypeElementwisePower
+		prec := operatorPrecedence(n.Operator)
+		return fmt.Sprintf("%s %s %s", wrap(n.Left, prec, right), operatorSymbols[n.Operator], wrap(n.Right, prec, !right))
+	case *expronaut.LogicalOperationNode:
+		prec := precedence(n)
+		return fmt.Sprintf("%s %s %s", wrap(n.Left, prec, false), operatorSymbols[n.Operator], wrap(n.Right, prec, true))
+	case *ConversionNode:
+		return fmt.Sprintf("%s %s %s", wrap(n.Value, precConversion, false), n.Keyword, wrap(n.Target, precConversion, true))
+	case *expronaut.FunctionCallNode:
+		return n.FunctionName + "(" + infixList(n.Arguments) + ")"
+	case *expronaut.ArrayNode:
+		// the element type is not exported by expronaut, any is always valid
+		return "any[" + infixList(n.Elements) + "]"
+	case *MatrixNode:
+		return "[" + infixList(n.Elements) + "]"
+	}
+
+	return node.String()
+}
+
+// wrap prints the child of an operator with the given precedence, adding
+// parentheses when the child binds looser, or equally loose on the side
+// where associativity would regroup it.
+func wrap(child expronaut.ASTNode, prec int, strict bool) string {
+	s := Infix(child)
+	p := precedence(child)
+	if p < prec || (strict && p == prec) {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func infixList(nodes []expronaut.ASTNode) string {
+	s := make([]string, len(nodes))
+	for i, n := range nodes {
+		s[i] = Infix(n)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,453 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+// ErrNoConvergence is returned when the solver cannot find a root.
+var ErrNoConvergence = errors.New("no convergence")
+
+var (
+	// SolverTolerance is the relative accuracy the solvers aim for.
+	SolverTolerance = 1e-12
+
+	// SolverMaxIterations bounds the iterations of a single solver run.
+	SolverMaxIterations = 100
+
+	// RootScanSteps is the number of intervals roots scans for sign changes.
+	RootScanSteps = 1000
+)
+
+// Solution is a root found by solve or roots, together with how it was
+// found.
+type Solution struct {
+	Variable   string
+	Value      float64
+	Residual   float64 // |f(Value)|, how far the equation is from holding
+	Iterations int
+	Method     string // "newton" or "brent"
+	Converged  bool
+}
+
+func (s Solution) String() string {
+	return fmt.Sprintf("%s = %s", s.Variable, Format(s.Value))
+}
+
+// Report describes how well the solver converged.
+func (s Solution) Report() string {
+	state := "converged"
+	if !s.Converged {
+		state = "stopped without converging"
+	}
+
+	return fmt.Sprintf("%s %s after %d iterations, residual %.3g", s.Method, state, s.Iterations, s.Residual)
+}
+
+// Float returns the root, solutions calculate like plain numbers.
+func (s Solution) Float() float64 {
+	return s.Value
+}
+
+// Operate lets a solution be used in further calculations as its value.
+func (s Solution) Operate(ctx context.Context, op expronaut.TokenType, other any, reverse bool) (any, error) {
+	return operateScalar(ctx, s, op, other, reverse)
+}
+
+// Apply passes the value of the solution to builtin functions.
+func (s Solution) Apply(ctx context.Context, name string, args []any) (any, error) {
+	return applyScalars(ctx, name, args)
+}
+
+// Roots are all roots found in an interval, in increasing order.
+type Roots []Solution
+
+func (r Roots) String() string {
+	if len(r) == 0 {
+		return "no roots"
+	}
+
+	values := make([]string, len(r))
+	for i, s := range r {
+		values[i] = Format(s.Value)
+	}
+	return fmt.Sprintf("%s = %s", r[0].Variable, strings.Join(values, ", "))
+}
+
+// Vector returns the roots as a vector, so they can be used in further
+// calculations.
+func (r Roots) Vector() Matrix {
+	values := make([]float64, len(r))
+	for i, s := range r {
+		values[i] = s.Value
+	}
+	return NewVector(values...)
+}
+
+// Report describes how well the solver converged.
+func (r Roots) Report() string {
+	iterations, residual := 0, 0.0
+	for _, s := range r {
+		iterations = max(iterations, s.Iterations)
+		residual = max(residual, s.Residual)
+	}
+
+	return fmt.Sprintf("%d roots, brent needed at most %d iterations, largest residual %.3g", len(r), iterations, residual)
+}
+
+func init() {
+	RegisterLazyFunction("solve", solve)
+	RegisterLazyFunction("roots", roots)
+}
+
+// objective turns an expression into a function of one variable. An
+// equation "lhs == rhs" is solved as lhs - rhs == 0.
+func objective(ctx context.Context, node expronaut.ASTNode, variable string) func(float64) (float64, error) {
+	if eq, ok := node.(*expronaut.BinaryOperationNode); ok && eq.Operator == expronaut.TokenTypeEqual {
+		node = &expronaut.BinaryOperationNode{Left: eq.Left, Operator: expronaut.TokenTypeMinus, Right: eq.Right}
+	}
+
+	return func(x float64) (float64, error) {
+		v, err := Eval(WithVariable(ctx, variable, x), node)
+		if err != nil {
+			return 0, err
+		}
+
+		f, ok := toFloat(v)
+		if !ok {
+			return 0, fmt.Errorf("expected the equation to evaluate to a number, got %s", Format(v))
+		}
+		return f, nil
+	}
+}
+
+// solve implements solve("expr == target", x, guess). With two arguments it
+// is the linear solve of the matrix functions.
+func solve(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	if len(args) == 2 {
+		values := make([]any, len(args))
+		for i, arg := range args {
+			val, err := Eval(ctx, arg)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = val
+		}
+		return call(ctx, "solve", values)
+	}
+
+	if len(args) != 3 {
+		return nil, fmt.Errorf("solve function expects an equation, a variable and a guess, or a matrix and a vector")
+	}
+
+	node, err := ExpressionArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	variable, err := VariableArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	guess, err := NumberArg(ctx, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return Solve(ctx, objective(ctx, node, variable), variable, guess)
+}
+
+// roots implements roots(expr, x, a, b).
+func roots(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("roots function expects four arguments: an expression, a variable, a and b")
+	}
+
+	node, err := ExpressionArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	variable, err := VariableArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := NumberArg(ctx, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NumberArg(ctx, args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return FindRoots(ctx, objective(ctx, node, variable), variable, a, b)
+}
+
+// Solve finds a root of f near guess. Newton's method is tried first, as it
+// converges fastest from a good guess. When it fails the solver searches
+// outwards from the guess for an interval where f changes sign and runs
+// Brent's method on it.
+//
+// A root where f does not change around it is rejected: it is where the
+// variable got so large that it is lost in rounding, as for x == x + 1.
+func Solve(ctx context.Context, f func(float64) (float64, error), variable string, guess float64) (Solution, error) {
+	if s, err := newton(f, guess); err == nil && plausible(f, s.Value, 0) {
+		s.Variable = variable
+		return s, nil
+	} else if ctx.Err() != nil {
+		return Solution{}, ctx.Err()
+	}
+
+	a, b, fa, fb, err := bracket(f, guess)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Solution{}, ctx.Err()
+		}
+		return Solution{}, err
+	}
+
+	s, err := brent(f, a, b, fa, fb)
+	if err != nil {
+		return Solution{}, err
+	}
+	if !plausible(f, s.Value, b-a) {
+		return Solution{}, fmt.Errorf("%w: no solution, the equation only holds at %s = %s because of rounding", ErrNoConvergence, variable, Format(s.Value))
+	}
+
+	s.Variable = variable
+	return s, nil
+}
+
+// plausible checks f around the root x. A root found from a sign change
+// over an interval of the width must have f cross zero around it, on a
+// scale up to the width, any other root must have f differ from zero on one
+// side at least. Otherwise the terms of the equation no longer depend on x,
+// like x and x + 1 for x beyond 2**53, and x is not a root but rounding.
+func plausible(f func(float64) (float64, error), x, width float64) bool {
+	for h := 1e3 * SolverTolerance * math.Max(1, math.Abs(x)); ; h *= 10 {
+		fm, errM := f(x - h)
+		fp, errP := f(x + h)
+		if errM != nil || errP != nil {
+			return true
+		}
+
+		if width == 0 {
+			return fm != 0 || fp != 0
+		}
+		if fm < 0 && fp > 0 || fm > 0 && fp < 0 {
+			return true
+		}
+		if h >= width {
+			return false
+		}
+	}
+}
+
+// FindRoots finds the roots of f between a and b by scanning for sign
+// changes and refining each with Brent's method. Roots where f touches zero
+// without changing sign are only found when a scan point hits them.
+func FindRoots(ctx context.Context, f func(float64) (float64, error), variable string, a, b float64) (Roots, error) {
+	if !(a < b) {
+		return nil, fmt.Errorf("roots needs an interval with a < b, got %s to %s", Format(a), Format(b))
+	}
+
+	found := Roots{}
+	add := func(s Solution, width float64) {
+		if !plausible(f, s.Value, width) {
+			return
+		}
+		s.Variable = variable
+		// neighbouring intervals can converge on the same root
+		if n := len(found); n > 0 && math.Abs(found[n-1].Value-s.Value) <= 1e3*SolverTolerance*math.Max(1, math.Abs(s.Value)) {
+			return
+		}
+		found = append(found, s)
+	}
+
+	step := (b - a) / float64(RootScanSteps)
+	x0 := a
+	f0, err0 := f(x0)
+
+	for i := 1; i <= RootScanSteps; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		x1 := a + step*float64(i)
+		f1, err1 := f(x1)
+
+		switch {
+		case err0 != nil || err1 != nil || math.IsNaN(f0) || math.IsNaN(f1):
+			// undefined somewhere in this interval, nothing to bracket
+		case f0 == 0:
+			add(Solution{Value: x0, Method: "brent", Converged: true}, 0)
+		case math.Signbit(f0) != math.Signbit(f1) && f1 != 0:
+			s, err := brent(f, x0, x1, f0, f1)
+			// a sign change across a pole, like tan at pi/2, converges on the
+			// pole, its residual grows instead of shrinking
+			if err == nil && s.Residual <= math.Max(math.Abs(f0), math.Abs(f1)) {
+				add(s, step)
+			}
+		}
+
+		x0, f0, err0 = x1, f1, err1
+	}
+
+	if err0 == nil && f0 == 0 {
+		add(Solution{Value: x0, Method: "brent", Converged: true}, 0)
+	}
+
+	return found, nil
+}
+
+// newton runs Newton's method with a central difference derivative.
+func newton(f func(float64) (float64, error), x float64) (Solution, error) {
+	for i := 1; i <= SolverMaxIterations; i++ {
+		fx, err := f(x)
+		if err != nil {
+			return Solution{}, err
+		}
+
+		h := 1e-6 * math.Max(1, math.Abs(x))
+		fp, err := f(x + h)
+		if err != nil {
+			return Solution{}, err
+		}
+		fm, err := f(x - h)
+		if err != nil {
+			return Solution{}, err
+		}
+
+		d := (fp - fm) / (2 * h)
+		if d == 0 || math.IsNaN(d) || math.IsInf(d, 0) {
+			return Solution{}, fmt.Errorf("%w: derivative vanishes at %s", ErrNoConvergence, Format(x))
+		}
+
+		dx := fx / d
+		x -= dx
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return Solution{}, fmt.Errorf("%w: newton diverged", ErrNoConvergence)
+		}
+
+		if math.Abs(dx) <= SolverTolerance*math.Max(1, math.Abs(x)) {
+			fx, err = f(x)
+			if err != nil {
+				return Solution{}, err
+			}
+			return Solution{Value: x, Residual: math.Abs(fx), Iterations: i, Method: "newton", Converged: true}, nil
+		}
+	}
+
+	return Solution{}, fmt.Errorf("%w: newton did not converge in %d iterations", ErrNoConvergence, SolverMaxIterations)
+}
+
+// bracket widens an interval around guess until f changes sign across it,
+// or across one of its halves for functions that are symmetric around the
+// guess.
+func bracket(f func(float64) (float64, error), guess float64) (a, b, fa, fb float64, err error) {
+	fg, errG := f(guess)
+	step := 0.1 * math.Max(1, math.Abs(guess))
+
+	for range SolverMaxIterations {
+		a, b = guess-step, guess+step
+
+		var errA, errB error
+		fa, errA = f(a)
+		fb, errB = f(b)
+
+		switch {
+		case errA == nil && errG == nil && math.Signbit(fa) != math.Signbit(fg):
+			return a, guess, fa, fg, nil
+		case errG == nil && errB == nil && math.Signbit(fg) != math.Signbit(fb):
+			return guess, b, fg, fb, nil
+		case errA == nil && errB == nil && math.Signbit(fa) != math.Signbit(fb):
+			return a, b, fa, fb, nil
+		}
+
+		step *= 1.6
+	}
+
+	return 0, 0, 0, 0, fmt.Errorf("%w: no sign change found around %s", ErrNoConvergence, Format(guess))
+}
+
+// brent finds a root of f in [a, b], where f(a) and f(b) have opposite
+// signs, combining bisection, secant and inverse quadratic interpolation.
+func brent(f func(float64) (float64, error), a, b, fa, fb float64) (Solution, error) {
+	c, fc := b, fb
+	d := b - a
+	e := d
+
+	for i := 1; i <= SolverMaxIterations; i++ {
+		if math.Signbit(fb) == math.Signbit(fc) {
+			c, fc = a, fa
+			d = b - a
+			e = d
+		}
+		if math.Abs(fc) < math.Abs(fb) {
+			a, b, c = b, c, b
+			fa, fb, fc = fb, fc, fb
+		}
+
+		tol := 2*math.SmallestNonzeroFloat64 + 0.5*SolverTolerance*math.Max(1, math.Abs(b))
+		m := 0.5 * (c - b)
+		if math.Abs(m) <= tol || fb == 0 {
+			return Solution{Value: b, Residual: math.Abs(fb), Iterations: i, Method: "brent", Converged: true}, nil
+		}
+
+		if math.Abs(e) >= tol && math.Abs(fa) > math.Abs(fb) {
+			var p, q float64
+			s := fb / fa
+			if a == c {
+				// secant
+				p = 2 * m * s
+				q = 1 - s
+			} else {
+				// inverse quadratic interpolation
+				q = fa / fc
+				r := fb / fc
+				p = s * (2*m*q*(q-r) - (b-a)*(r-1))
+				q = (q - 1) * (r - 1) * (s - 1)
+			}
+			if p > 0 {
+				q = -q
+			}
+			p = math.Abs(p)
+
+			if 2*p < math.Min(3*m*q-math.Abs(tol*q), math.Abs(e*q)) {
+				e = d
+				d = p / q
+			} else {
+				d = m
+				e = d
+			}
+		} else {
+			// bisection
+			d = m
+			e = d
+		}
+
+		a, fa = b, fb
+		if math.Abs(d) > tol {
+			b += d
+		} else {
+			b += math.Copysign(tol, m)
+		}
+
+		var err error
+		fb, err = f(b)
+		if err != nil {
+			return Solution{}, err
+		}
+	}
+
+	return Solution{Value: b, Residual: math.Abs(fb), Iterations: SolverMaxIterations, Method: "brent"}, nil
+}
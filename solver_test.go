@@ -0,0 +1,88 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{input: `solve("x**2 == 2", x, 1)`, want: math.Sqrt2},
+		{input: `solve("x**3 == 8", x, -5)`, want: 2},
+		{input: `solve("1000 * (1 + r)**10 == 2000", r, 0.05)`, want: math.Pow(2, 0.1) - 1},
+		{input: `solve("abs(x) == 2", x, 0)`, want: -2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, ok := out.(Solution)
+			if !ok {
+				t.Fatalf("got %T, want a Solution", out)
+			}
+			if !s.Converged || math.Abs(s.Value-tt.want) > 1e-9 {
+				t.Fatalf("got %s (%s), want %v", s, s.Report(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSolveNoSolution(t *testing.T) {
+	tests := []string{
+		`solve("x == x + 1", x, 1)`,
+		`solve("x == x + 1", x, 1000)`,
+		`solve("abs(x) == -1", x, 1)`,
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), input)
+			if !errors.Is(err, ErrNoConvergence) {
+				t.Fatalf("got %s and error %v, want %v", Format(out), err, ErrNoConvergence)
+			}
+		})
+	}
+}
+
+func TestRoots(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []float64
+	}{
+		{input: "roots(x**3 - x, x, -2, 2)", want: []float64{-1, 0, 1}},
+		{input: "roots(sin(x), x, -4, 4)", want: []float64{-math.Pi, 0, math.Pi}},
+		{input: "roots(tan(x), x, 1, 2)"},
+		{input: "roots(x - (x + 1), x, -1e17, 1e17)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, ok := out.(Roots)
+			if !ok {
+				t.Fatalf("got %T, want Roots", out)
+			}
+			if len(r) != len(tt.want) {
+				t.Fatalf("got %s, want %v", r, tt.want)
+			}
+			for i, s := range r {
+				if math.Abs(s.Value-tt.want[i]) > 1e-9 {
+					t.Fatalf("got %s, want %v", r, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,713 @@
+package goculator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for a worksheet or share that does not
+// exist.
+var ErrNotFound = errors.New("not found")
+
+type (
+	// Store keeps the state of the calculator per owner, a session or a
+	// user: the history of calculations, variables, user-defined functions,
+	// worksheets and settings.
+	Store interface {
+		AddHistory(ctx context.Context, owner string, entry HistoryEntry) error
+		// History returns the most recent entries first, at most limit when
+		// limit is positive.
+		History(ctx context.Context, owner string, limit int) ([]HistoryEntry, error)
+		ClearHistory(ctx context.Context, owner string) error
+
+		SetVariable(ctx context.Context, owner string, v Variable) error
+		DeleteVariable(ctx context.Context, owner, name string) error
+		Variables(ctx context.Context, owner string) ([]Variable, error)
+
+		// SaveFunction stores a definition as entered, such as
+		// "f(x) = x**2", under the name of the function.
+		SaveFunction(ctx context.Context, owner, name, definition string) error
+		DeleteFunction(ctx context.Context, owner, name string) error
+		Functions(ctx context.Context, owner string) (map[string]string, error)
+
+		SaveWorksheet(ctx context.Context, owner string, w Worksheet) error
+		DeleteWorksheet(ctx context.Context, owner, id string) error
+		Worksheet(ctx context.Context, owner, id string) (Worksheet, error)
+		Worksheets(ctx context.Context, owner string) ([]Worksheet, error)
+		// SharedWorksheet returns the worksheet with the ID of any owner,
+		// if it is shared.
+		SharedWorksheet(ctx context.Context, id string) (Worksheet, error)
+
+		// SetSetting keeps a preference of the owner, such as the mode of
+		// the calculator, an empty value removes it.
+		SetSetting(ctx context.Context, owner, name, value string) error
+		Settings(ctx context.Context, owner string) (map[string]string, error)
+
+		// SaveShare keeps a shared calculation, a share with the ID of one
+		// already kept is left as it is.
+		SaveShare(ctx context.Context, s Share) error
+		Share(ctx context.Context, id string) (Share, error)
+
+		// Prune applies the retention policy, it is also applied to the
+		// history of an owner whenever an entry is added.
+		Prune(ctx context.Context) error
+		// Ping reports whether the store can be read and written, for
+		// readiness checks.
+		Ping(ctx context.Context) error
+		Close() error
+	}
+
+	// HistoryEntry is a calculation as it was entered and its outcome.
+	HistoryEntry struct {
+		Expression string    `json:"expression"`
+		Result     string    `json:"result,omitempty"`
+		Error      string    `json:"error,omitempty"`
+		Time       time.Time `json:"time"`
+	}
+
+	// Variable is a named value, kept as an expression evaluating to it.
+	Variable struct {
+		Name       string `json:"name"`
+		Expression string `json:"expression"`
+	}
+
+	// Worksheet is a named list of lines calculated together. Revision
+	// counts the times its lines were saved, the earlier lines are kept in
+	// Revisions. A shared worksheet can be read by anyone knowing its ID.
+	Worksheet struct {
+		ID        string     `json:"id"`
+		Name      string     `json:"name"`
+		Lines     []string   `json:"lines"`
+		Revision  int        `json:"revision,omitempty"`
+		Revisions []Revision `json:"revisions,omitempty"`
+		Shared    bool       `json:"shared,omitempty"`
+		Created   time.Time  `json:"created"`
+		Updated   time.Time  `json:"updated"`
+	}
+
+	// Share is a calculation as it was shared: the expression, the
+	// variables and functions it reads, as entered, and its result. Shares
+	// belong to no owner, Prune removes them once they are older than the
+	// ShareAge of the retention.
+	Share struct {
+		ID         string     `json:"id"`
+		Expression string     `json:"expression"`
+		Variables  []Variable `json:"variables,omitempty"`
+		Functions  []string   `json:"functions,omitempty"`
+		Result     string     `json:"result"`
+		Created    time.Time  `json:"created"`
+	}
+
+	// Retention limits how much history is kept per owner, and how long
+	// shares are kept. Zero values keep everything.
+	Retention struct {
+		MaxEntries int
+		MaxAge     time.Duration
+		ShareAge   time.Duration
+	}
+)
+
+// storeData is the content of a store, which the file store writes as JSON.
+// Seq is the sequence number of the last change it contains.
+type storeData struct {
+	Version int                   `json:"version"`
+	Seq     uint64                `json:"seq,omitempty"`
+	Owners  map[string]*ownerData `json:"owners"`
+	Shares  map[string]Share      `json:"shares,omitempty"`
+}
+
+type ownerData struct {
+	History    []HistoryEntry       `json:"history,omitempty"`
+	Variables  map[string]Variable  `json:"variables,omitempty"`
+	Functions  map[string]string    `json:"functions,omitempty"`
+	Worksheets map[string]Worksheet `json:"worksheets,omitempty"`
+	Settings   map[string]string    `json:"settings,omitempty"`
+}
+
+// change is a single modification of the data of a store. The file store
+// appends every change to its log, and replays the log on top of the last
+// snapshot when it is opened.
+type change struct {
+	Seq        uint64        `json:"seq"`
+	Op         string        `json:"op"`
+	Owner      string        `json:"owner,omitempty"`
+	Name       string        `json:"name,omitempty"`
+	History    *HistoryEntry `json:"history,omitempty"`
+	Variable   *Variable     `json:"variable,omitempty"`
+	Definition string        `json:"definition,omitempty"`
+	Value      string        `json:"value,omitempty"`
+	Worksheet  *Worksheet    `json:"worksheet,omitempty"`
+	Share      *Share        `json:"share,omitempty"`
+}
+
+const (
+	opAddHistory      = "add_history"
+	opClearHistory    = "clear_history"
+	opSetVariable     = "set_variable"
+	opDeleteVariable  = "delete_variable"
+	opSaveFunction    = "save_function"
+	opDeleteFunction  = "delete_function"
+	opSaveWorksheet   = "save_worksheet"
+	opDeleteWorksheet = "delete_worksheet"
+	opSaveShare       = "save_share"
+	opSetSetting      = "set_setting"
+)
+
+// migrations upgrade the data of a store one version at a time, the data of
+// version n is upgraded by migrations[n]. The current version is
+// len(migrations).
+var migrations = []func(raw map[string]json.RawMessage) error{
+	// 0 to 1: the initial schema, state keyed by owner
+	func(raw map[string]json.RawMessage) error {
+		if _, ok := raw["owners"]; !ok {
+			raw["owners"] = json.RawMessage(`{}`)
+		}
+		return nil
+	},
+}
+
+// MemoryStore is a Store that keeps everything in memory, for tests and for
+// running without a data file.
+type MemoryStore struct {
+	Retention Retention
+
+	mu   sync.Mutex
+	data storeData
+
+	// persist is called with the lock held after every change, compact
+	// after the retention policy was applied to all of the data
+	persist func(c change) error
+	compact func(data *storeData) error
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore(retention Retention) *MemoryStore {
+	return &MemoryStore{
+		Retention: retention,
+		data:      storeData{Version: len(migrations), Owners: map[string]*ownerData{}},
+	}
+}
+
+// compactAfter is the number of changes a FileStore appends to its log
+// before it writes a new snapshot.
+const compactAfter = 1000
+
+// FileStore is a Store kept in a JSON snapshot and a log of the changes
+// since, next to it with the extension ".log". A change appends a line to
+// the log, the snapshot is rewritten and the log emptied after
+// compactAfter changes and whenever the store is pruned.
+type FileStore struct {
+	*MemoryStore
+	Path string
+
+	log    *os.File
+	logged int
+}
+
+// NewFileStore opens the store in the file at path, creating it when it does
+// not exist. Files written by an older version are migrated, the log is
+// replayed and the retention policy is applied.
+func NewFileStore(path string, retention Retention) (*FileStore, error) {
+	fs := &FileStore{MemoryStore: NewMemoryStore(retention), Path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := loadStoreData(data, &fs.data); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+
+	if err := fs.replay(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", fs.logPath(), err)
+	}
+
+	fs.log, err = os.OpenFile(fs.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.persist, fs.compact = fs.append, fs.write
+	if err := fs.Prune(context.Background()); err != nil {
+		_ = fs.log.Close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) logPath() string {
+	return fs.Path + ".log"
+}
+
+// replay applies the changes of the log that the snapshot does not contain.
+// A line that does not decode ends the log, it is what is left of a write
+// that was cut short.
+func (fs *FileStore) replay() error {
+	f, err := os.Open(fs.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for {
+		var c change
+		if err := dec.Decode(&c); err != nil {
+			return nil
+		}
+		if c.Seq <= fs.data.Seq {
+			continue
+		}
+
+		// a change that does not apply, such as removing a worksheet that
+		// is gone, failed when it was made as well
+		_ = fs.apply(c)
+		fs.data.Seq = c.Seq
+	}
+}
+
+// append writes the change to the log, and compacts the log when it has
+// grown long.
+func (fs *FileStore) append(c change) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.log.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	if fs.logged++; fs.logged >= compactAfter {
+		return fs.write(&fs.data)
+	}
+	return nil
+}
+
+// Ping implements Store, checking that the file can still be replaced.
+func (fs *FileStore) Ping(ctx context.Context) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fs.Path), filepath.Base(fs.Path)+".*")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+
+	return os.Remove(tmp.Name())
+}
+
+// Close implements Store, writing a snapshot and closing the log.
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	err := fs.write(&fs.data)
+	return errors.Join(err, fs.log.Close())
+}
+
+// loadStoreData migrates the data to the current version and decodes it.
+func loadStoreData(data []byte, out *storeData) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return fmt.Errorf("invalid version: %w", err)
+		}
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("version %d is newer than this program supports (%d)", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](raw); err != nil {
+			return fmt.Errorf("migrating to version %d: %w", version+1, err)
+		}
+	}
+	raw["version"], _ = json.Marshal(version)
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(migrated, out); err != nil {
+		return err
+	}
+	if out.Owners == nil {
+		out.Owners = map[string]*ownerData{}
+	}
+
+	return nil
+}
+
+// write replaces the snapshot through a temporary file, so a failed write
+// leaves the previous state intact, and empties the log. Changes the log
+// still holds after a crash in between are skipped by their sequence number.
+func (fs *FileStore) write(data *storeData) error {
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.Path), filepath.Base(fs.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), fs.Path); err != nil {
+		return err
+	}
+
+	fs.logged = 0
+	return fs.log.Truncate(0)
+}
+
+// owner returns the data of the owner, creating it when create is set.
+func (s *MemoryStore) owner(name string, create bool) *ownerData {
+	o, ok := s.data.Owners[name]
+	if !ok && create {
+		o = &ownerData{}
+		s.data.Owners[name] = o
+	}
+	return o
+}
+
+// commit numbers the change, applies it and persists it.
+func (s *MemoryStore) commit(c change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.apply(c); err != nil {
+		return err
+	}
+
+	s.data.Seq++
+	c.Seq = s.data.Seq
+	if s.persist != nil {
+		return s.persist(c)
+	}
+	return nil
+}
+
+// apply makes the change to the data, with the lock held.
+func (s *MemoryStore) apply(c change) error {
+	if c.Op == opSaveShare {
+		if _, ok := s.data.Shares[c.Share.ID]; ok {
+			return nil
+		}
+		if s.data.Shares == nil {
+			s.data.Shares = map[string]Share{}
+		}
+		s.data.Shares[c.Share.ID] = *c.Share
+		return nil
+	}
+
+	o := s.owner(c.Owner, true)
+	switch c.Op {
+	case opAddHistory:
+		o.History = s.Retention.apply(append(o.History, *c.History), time.Now())
+	case opClearHistory:
+		o.History = nil
+	case opSetVariable:
+		if o.Variables == nil {
+			o.Variables = map[string]Variable{}
+		}
+		o.Variables[c.Variable.Name] = *c.Variable
+	case opDeleteVariable:
+		delete(o.Variables, c.Name)
+	case opSaveFunction:
+		if o.Functions == nil {
+			o.Functions = map[string]string{}
+		}
+		o.Functions[c.Name] = c.Definition
+	case opDeleteFunction:
+		delete(o.Functions, c.Name)
+	case opSaveWorksheet:
+		if o.Worksheets == nil {
+			o.Worksheets = map[string]Worksheet{}
+		}
+		o.Worksheets[c.Worksheet.ID] = *c.Worksheet
+	case opDeleteWorksheet:
+		if _, ok := o.Worksheets[c.Name]; !ok {
+			return fmt.Errorf("worksheet %s: %w", c.Name, ErrNotFound)
+		}
+		delete(o.Worksheets, c.Name)
+	case opSetSetting:
+		if c.Value == "" {
+			delete(o.Settings, c.Name)
+			break
+		}
+		if o.Settings == nil {
+			o.Settings = map[string]string{}
+		}
+		o.Settings[c.Name] = c.Value
+	default:
+		return fmt.Errorf("unknown change %q", c.Op)
+	}
+	return nil
+}
+
+// read calls f with the data of the owner, which is nil for an owner that
+// has nothing stored.
+func (s *MemoryStore) read(owner string, f func(o *ownerData)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f(s.owner(owner, false))
+}
+
+// AddHistory implements Store.
+func (s *MemoryStore) AddHistory(ctx context.Context, owner string, entry HistoryEntry) error {
+	return s.commit(change{Op: opAddHistory, Owner: owner, History: &entry})
+}
+
+// History implements Store.
+func (s *MemoryStore) History(ctx context.Context, owner string, limit int) ([]HistoryEntry, error) {
+	var out []HistoryEntry
+	s.read(owner, func(o *ownerData) {
+		if o == nil {
+			return
+		}
+		out = slices.Clone(o.History)
+	})
+
+	slices.Reverse(out)
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// ClearHistory implements Store.
+func (s *MemoryStore) ClearHistory(ctx context.Context, owner string) error {
+	return s.commit(change{Op: opClearHistory, Owner: owner})
+}
+
+// SetVariable implements Store.
+func (s *MemoryStore) SetVariable(ctx context.Context, owner string, v Variable) error {
+	return s.commit(change{Op: opSetVariable, Owner: owner, Variable: &v})
+}
+
+// DeleteVariable implements Store.
+func (s *MemoryStore) DeleteVariable(ctx context.Context, owner, name string) error {
+	return s.commit(change{Op: opDeleteVariable, Owner: owner, Name: name})
+}
+
+// Variables implements Store, ordered by name.
+func (s *MemoryStore) Variables(ctx context.Context, owner string) ([]Variable, error) {
+	var out []Variable
+	s.read(owner, func(o *ownerData) {
+		if o == nil {
+			return
+		}
+		for _, v := range o.Variables {
+			out = append(out, v)
+		}
+	})
+
+	slices.SortFunc(out, func(a, b Variable) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+// SaveFunction implements Store.
+func (s *MemoryStore) SaveFunction(ctx context.Context, owner, name, definition string) error {
+	return s.commit(change{Op: opSaveFunction, Owner: owner, Name: name, Definition: definition})
+}
+
+// DeleteFunction implements Store.
+func (s *MemoryStore) DeleteFunction(ctx context.Context, owner, name string) error {
+	return s.commit(change{Op: opDeleteFunction, Owner: owner, Name: name})
+}
+
+// Functions implements Store.
+func (s *MemoryStore) Functions(ctx context.Context, owner string) (map[string]string, error) {
+	out := map[string]string{}
+	s.read(owner, func(o *ownerData) {
+		if o == nil {
+			return
+		}
+		for name, def := range o.Functions {
+			out[name] = def
+		}
+	})
+	return out, nil
+}
+
+// SetSetting implements Store.
+func (s *MemoryStore) SetSetting(ctx context.Context, owner, name, value string) error {
+	return s.commit(change{Op: opSetSetting, Owner: owner, Name: name, Value: value})
+}
+
+// Settings implements Store.
+func (s *MemoryStore) Settings(ctx context.Context, owner string) (map[string]string, error) {
+	out := map[string]string{}
+	s.read(owner, func(o *ownerData) {
+		if o != nil {
+			maps.Copy(out, o.Settings)
+		}
+	})
+	return out, nil
+}
+
+// SaveWorksheet implements Store, replacing the worksheet with the same ID.
+func (s *MemoryStore) SaveWorksheet(ctx context.Context, owner string, w Worksheet) error {
+	if w.ID == "" {
+		return errors.New("worksheet without an id")
+	}
+
+	return s.commit(change{Op: opSaveWorksheet, Owner: owner, Worksheet: &w})
+}
+
+// DeleteWorksheet implements Store.
+func (s *MemoryStore) DeleteWorksheet(ctx context.Context, owner, id string) error {
+	return s.commit(change{Op: opDeleteWorksheet, Owner: owner, Name: id})
+}
+
+// Worksheet implements Store.
+func (s *MemoryStore) Worksheet(ctx context.Context, owner, id string) (Worksheet, error) {
+	var (
+		w  Worksheet
+		ok bool
+	)
+	s.read(owner, func(o *ownerData) {
+		if o != nil {
+			w, ok = o.Worksheets[id]
+		}
+	})
+
+	if !ok {
+		return Worksheet{}, fmt.Errorf("worksheet %s: %w", id, ErrNotFound)
+	}
+	return w, nil
+}
+
+// Worksheets implements Store, the most recently updated first.
+func (s *MemoryStore) Worksheets(ctx context.Context, owner string) ([]Worksheet, error) {
+	var out []Worksheet
+	s.read(owner, func(o *ownerData) {
+		if o == nil {
+			return
+		}
+		for _, w := range o.Worksheets {
+			out = append(out, w)
+		}
+	})
+
+	slices.SortFunc(out, func(a, b Worksheet) int { return b.Updated.Compare(a.Updated) })
+	return out, nil
+}
+
+// SharedWorksheet implements Store.
+func (s *MemoryStore) SharedWorksheet(ctx context.Context, id string) (Worksheet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.data.Owners {
+		if w, ok := o.Worksheets[id]; ok && w.Shared {
+			return w, nil
+		}
+	}
+	return Worksheet{}, fmt.Errorf("worksheet %s: %w", id, ErrNotFound)
+}
+
+// SaveShare implements Store.
+func (s *MemoryStore) SaveShare(ctx context.Context, share Share) error {
+	if share.ID == "" {
+		return errors.New("share without an id")
+	}
+
+	return s.commit(change{Op: opSaveShare, Share: &share})
+}
+
+// Share implements Store.
+func (s *MemoryStore) Share(ctx context.Context, id string) (Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	share, ok := s.data.Shares[id]
+	if !ok {
+		return Share{}, fmt.Errorf("share %s: %w", id, ErrNotFound)
+	}
+	return share, nil
+}
+
+// Prune implements Store.
+func (s *MemoryStore) Prune(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for name, o := range s.data.Owners {
+		o.History = s.Retention.apply(o.History, now)
+		if len(o.History) == 0 && len(o.Variables) == 0 && len(o.Functions) == 0 && len(o.Worksheets) == 0 && len(o.Settings) == 0 {
+			delete(s.data.Owners, name)
+		}
+	}
+	if s.Retention.ShareAge > 0 {
+		cutoff := now.Add(-s.Retention.ShareAge)
+		maps.DeleteFunc(s.data.Shares, func(_ string, share Share) bool { return share.Created.Before(cutoff) })
+	}
+
+	if s.compact != nil {
+		return s.compact(&s.data)
+	}
+	return nil
+}
+
+// Ping implements Store, memory is always available.
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close implements Store, there is nothing to release.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// apply drops the entries the policy does not keep, the history is ordered
+// oldest first.
+func (r Retention) apply(history []HistoryEntry, now time.Time) []HistoryEntry {
+	if r.MaxAge > 0 {
+		cutoff := now.Add(-r.MaxAge)
+		i := 0
+		for i < len(history) && history[i].Time.Before(cutoff) {
+			i++
+		}
+		history = history[i:]
+	}
+
+	if r.MaxEntries > 0 && len(history) > r.MaxEntries {
+		history = history[len(history)-r.MaxEntries:]
+	}
+
+	if len(history) == 0 {
+		return nil
+	}
+	return slices.Clip(history)
+}
@@ -0,0 +1,267 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore(Retention{MaxEntries: 3})
+		},
+		"file": func(t *testing.T) Store {
+			fs, err := NewFileStore(filepath.Join(t.TempDir(), "data.json"), Retention{MaxEntries: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = fs.Close() })
+			return fs
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t)
+
+			for _, e := range []string{"1", "2", "3", "4"} {
+				if err := s.AddHistory(ctx, "a", HistoryEntry{Expression: e, Time: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			history, _ := s.History(ctx, "a", 0)
+			if len(history) != 3 || history[0].Expression != "4" {
+				t.Fatalf("got history %v, want the last 3, most recent first", history)
+			}
+
+			_ = s.SetVariable(ctx, "a", Variable{Name: "x", Expression: "2"})
+			_ = s.SetVariable(ctx, "a", Variable{Name: "y", Expression: "3"})
+			_ = s.DeleteVariable(ctx, "a", "x")
+			vars, _ := s.Variables(ctx, "a")
+			if len(vars) != 1 || vars[0].Name != "y" {
+				t.Fatalf("got variables %v", vars)
+			}
+
+			_ = s.SaveFunction(ctx, "a", "f", "f(x) = x + 1")
+			if fns, _ := s.Functions(ctx, "b"); len(fns) != 0 {
+				t.Fatalf("functions of a are visible to b: %v", fns)
+			}
+
+			if err := s.DeleteWorksheet(ctx, "a", "nope"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got error %v, want %v", err, ErrNotFound)
+			}
+			if _, err := s.Share(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got error %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	fs, err := NewFileStore(path, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fs.AddHistory(ctx, "a", HistoryEntry{Expression: "1 + 1", Time: time.Now()})
+	_ = fs.SetVariable(ctx, "a", Variable{Name: "x", Expression: "2"})
+	_ = fs.SaveShare(ctx, Share{ID: "s", Expression: "1", Created: time.Now()})
+
+	// no Close, as after a crash: the changes are only in the log
+	_ = fs.log.Close()
+
+	fs, err = NewFileStore(path, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	history, _ := fs.History(ctx, "a", 0)
+	if len(history) != 1 {
+		t.Fatalf("got %d history entries, want 1", len(history))
+	}
+	if vars, _ := fs.Variables(ctx, "a"); len(vars) != 1 {
+		t.Fatalf("got variables %v", vars)
+	}
+	if _, err := fs.Share(ctx, "s"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStoreAppendsAndCompacts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	fs, err := NewFileStore(path, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	snapshot, _ := os.Stat(path)
+	for i := range compactAfter - 1 {
+		_ = fs.AddHistory(ctx, "a", HistoryEntry{Expression: "1", Time: time.Unix(int64(i), 0)})
+	}
+	if after, _ := os.Stat(path); !after.ModTime().Equal(snapshot.ModTime()) || after.Size() != snapshot.Size() {
+		t.Fatal("the snapshot was rewritten for a change")
+	}
+	if log, _ := os.Stat(fs.logPath()); log.Size() == 0 {
+		t.Fatal("the changes were not appended to the log")
+	}
+
+	_ = fs.AddHistory(ctx, "a", HistoryEntry{Expression: "1", Time: time.Now()})
+	if log, _ := os.Stat(fs.logPath()); log.Size() != 0 {
+		t.Fatalf("the log was not compacted, it has %d bytes", log.Size())
+	}
+}
+
+func TestFileStoreIgnoresTornLogLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	fs, err := NewFileStore(path, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fs.SetVariable(ctx, "a", Variable{Name: "x", Expression: "2"})
+	_, _ = fs.log.WriteString(`{"seq":99,"op":"set_var`)
+	_ = fs.log.Close()
+
+	fs, err = NewFileStore(path, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	if vars, _ := fs.Variables(ctx, "a"); len(vars) != 1 {
+		t.Fatalf("got variables %v", vars)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Now()
+	history := []HistoryEntry{
+		{Expression: "old", Time: now.Add(-48 * time.Hour)},
+		{Expression: "a", Time: now.Add(-time.Hour)},
+		{Expression: "b", Time: now},
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		want      int
+	}{
+		{name: "keep everything", want: 3},
+		{name: "max entries", retention: Retention{MaxEntries: 1}, want: 1},
+		{name: "max age", retention: Retention{MaxAge: 24 * time.Hour}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.retention.apply(history, now); len(got) != tt.want {
+				t.Fatalf("got %d entries, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneShares(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+	retention := Retention{ShareAge: 30 * 24 * time.Hour}
+
+	fs, err := NewFileStore(path, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	shares := []Share{
+		{ID: "old", Expression: "1 + 1", Created: now.Add(-60 * 24 * time.Hour)},
+		{ID: "new", Expression: "2 + 2", Created: now.Add(-time.Hour)},
+	}
+	for _, share := range shares {
+		if err := fs.SaveShare(ctx, share); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Prune(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shares pruned stay gone once the file is read again
+	fs, err = NewFileStore(path, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	tests := []struct {
+		id  string
+		err error
+	}{
+		{id: "old", err: ErrNotFound},
+		{id: "new"},
+	}
+
+	for _, tt := range tests {
+		if _, err := fs.Share(ctx, tt.id); !errors.Is(err, tt.err) {
+			t.Fatalf("share %s: got error %v, want %v", tt.id, err, tt.err)
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	fs, err := NewFileStore(path, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []struct {
+		name, value string
+	}{
+		{"keypad", "scientific"},
+		{"theme", "dark"},
+		{"keypad", "programmer"},
+		// an empty value removes the setting
+		{"theme", ""},
+	}
+	for _, c := range changes {
+		if err := fs.SetSetting(ctx, "a", c.name, c.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err = NewFileStore(path, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	settings, err := fs.Settings(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 1 || settings["keypad"] != "programmer" {
+		t.Fatalf("got settings %v, want only keypad programmer", settings)
+	}
+	if settings, _ := fs.Settings(ctx, "b"); len(settings) != 0 {
+		t.Fatalf("settings of a are visible to b: %v", settings)
+	}
+}
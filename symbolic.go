@@ -0,0 +1,732 @@
+package goculator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+// Expression is the result of a symbolic operation, such as the derivative
+// returned by diff(x**3, x).
+type Expression struct {
+	Node expronaut.ASTNode
+}
+
+// String prints the expression in the syntax the parser reads.
+func (e Expression) String() string {
+	return Infix(e.Node)
+}
+
+// Tree prints the expression with the String methods of the nodes, which
+// shows how it is grouped.
+func (e Expression) Tree() string {
+	return e.Node.String()
+}
+
+func init() {
+	RegisterLazyFunction("simplify", simplify)
+
+	// expronaut's log takes the base as second argument, derivatives need
+	// the natural logarithm
+	expronaut.RegisterFunction("ln", func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ln function expects exactly one argument")
+		}
+
+		f, ok := toFloat(args[0])
+		if !ok {
+			return nil, fmt.Errorf("ln function expects a number, got %s", Format(args[0]))
+		}
+		return math.Log(f), nil
+	})
+}
+
+// simplify implements simplify(expr).
+func simplify(ctx context.Context, args []expronaut.ASTNode) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("simplify function expects exactly one argument")
+	}
+
+	node, err := ExpressionArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return Expression{Node: Simplify(node)}, nil
+}
+
+// derive implements diff(expr, x), the symbolic form of diff.
+func derive(args []expronaut.ASTNode) (any, error) {
+	node, err := ExpressionArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	variable, err := VariableArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := Derive(node, variable)
+	if err != nil {
+		return nil, err
+	}
+
+	return Expression{Node: Simplify(d)}, nil
+}
+
+// Derive returns the derivative of node with respect to variable. The
+// result is not simplified, pass it to Simplify to make it readable.
+func Derive(node expronaut.ASTNode, variable string) (expronaut.ASTNode, error) {
+	if !dependsOn(node, variable) {
+		return numberNode(0), nil
+	}
+
+	switch n := node.(type) {
+	case *expronaut.VariableNode:
+		return numberNode(1), nil
+	case *UnaryOperationNode:
+		d, err := Derive(n.Operand, variable)
+		if err != nil {
+			return nil, err
+		}
+		if n.Operator == expronaut.TokenTypeMinus {
+			return negNode(d), nil
+		}
+		return d, nil
+	case *expronaut.BinaryOperationNode:
+		dl, err := Derive(n.Left, variable)
+		if err != nil {
+			return nil, err
+		}
+		dr, err := Derive(n.Right, variable)
+		if err != nil {
+			return nil, err
+		}
+
+		l, r := n.Left, n.Right
+		switch n.Operator {
+		case expronaut.TokenTypePlus, expronaut.TokenTypeMinus:
+			return binaryNode(dl, n.Operator, dr), nil
+		case expronaut.TokenTypeMultiply:
+			// product rule
+			return binaryNode(mulNode(dl, r), expronaut.TokenTypePlus, mulNode(l, dr)), nil
+		case expronaut.TokenTypeDivide:
+			// quotient rule
+			numerator := binaryNode(mulNode(dl, r), expronaut.TokenTypeMinus, mulNode(l, dr))
+			return binaryNode(numerator, expronaut.TokenTypeDivide, powNode(r, numberNode(2))), nil
+		case expronaut.TokenTypeExponent:
+			switch {
+			case !dependsOn(r, variable):
+				// power rule
+				exponent := binaryNode(r, expronaut.TokenTypeMinus, numberNode(1))
+				return mulNode(mulNode(r, powNode(l, exponent)), dl), nil
+			case !dependsOn(l, variable):
+				return mulNode(mulNode(node, callNode("ln", l)), dr), nil
+			default:
+				// d(u**v) = u**v * (v' ln(u) + v u' / u)
+				inner := binaryNode(mulNode(dr, callNode("ln", l)), expronaut.TokenTypePlus,
+					binaryNode(mulNode(r, dl), expronaut.TokenTypeDivide, l))
+				return mulNode(node, inner), nil
+			}
+		}
+
+		return nil, fmt.Errorf("cannot differentiate the %s operator", operatorSymbols[n.Operator])
+	case *expronaut.FunctionCallNode:
+		if rewrite, ok := derivativeRewrites[n.FunctionName]; ok && len(n.Arguments) == 2 {
+			return Derive(rewrite(n.Arguments[0], n.Arguments[1]), variable)
+		}
+
+		outer, ok := derivatives[n.FunctionName]
+		if !ok || len(n.Arguments) != 1 {
+			return nil, fmt.Errorf("cannot differentiate %s", Infix(n))
+		}
+
+		// chain rule
+		u := n.Arguments[0]
+		du, err := Derive(u, variable)
+		if err != nil {
+			return nil, err
+		}
+		return mulNode(outer(u), du), nil
+	}
+
+	return nil, fmt.Errorf("cannot differentiate %s", Infix(node))
+}
+
+// derivatives holds the derivatives of the single argument builtins with
+// respect to their argument u.
+var derivatives = map[string]func(u expronaut.ASTNode) expronaut.ASTNode{
+	"sin": func(u expronaut.ASTNode) expronaut.ASTNode { return callNode("cos", u) },
+	"cos": func(u expronaut.ASTNode) expronaut.ASTNode { return negNode(callNode("sin", u)) },
+	"tan": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(1), powNode(callNode("cos", u), numberNode(2)))
+	},
+	"asin": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(1), callNode("sqrt", binaryNode(numberNode(1), expronaut.TokenTypeMinus, powNode(u, numberNode(2)))))
+	},
+	"acos": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(-1), callNode("sqrt", binaryNode(numberNode(1), expronaut.TokenTypeMinus, powNode(u, numberNode(2)))))
+	},
+	"atan": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(1), binaryNode(numberNode(1), expronaut.TokenTypePlus, powNode(u, numberNode(2))))
+	},
+	"sinh": func(u expronaut.ASTNode) expronaut.ASTNode { return callNode("cosh", u) },
+	"cosh": func(u expronaut.ASTNode) expronaut.ASTNode { return callNode("sinh", u) },
+	"tanh": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(1), powNode(callNode("cosh", u), numberNode(2)))
+	},
+	"sqrt": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(1), mulNode(numberNode(2), callNode("sqrt", u)))
+	},
+	"ln": func(u expronaut.ASTNode) expronaut.ASTNode { return divNode(numberNode(1), u) },
+	"log10": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(1), mulNode(u, callNode("ln", numberNode(10))))
+	},
+	"log2": func(u expronaut.ASTNode) expronaut.ASTNode {
+		return divNode(numberNode(1), mulNode(u, callNode("ln", numberNode(2))))
+	},
+	"abs":     func(u expronaut.ASTNode) expronaut.ASTNode { return divNode(callNode("abs", u), u) },
+	"deg2rad": func(u expronaut.ASTNode) expronaut.ASTNode { return callNode("deg2rad", numberNode(1)) },
+	"rad2deg": func(u expronaut.ASTNode) expronaut.ASTNode { return callNode("rad2deg", numberNode(1)) },
+}
+
+// derivativeRewrites express the two argument builtins with operators and
+// single argument functions before they are differentiated.
+var derivativeRewrites = map[string]func(a, b expronaut.ASTNode) expronaut.ASTNode{
+	"pow":  powNode,
+	"exp":  powNode,
+	"root": func(a, b expronaut.ASTNode) expronaut.ASTNode { return powNode(a, divNode(numberNode(1), b)) },
+	"log":  func(a, b expronaut.ASTNode) expronaut.ASTNode { return divNode(callNode("ln", a), callNode("ln", b)) },
+	"hypot": func(a, b expronaut.ASTNode) expronaut.ASTNode {
+		return callNode("sqrt", binaryNode(powNode(a, numberNode(2)), expronaut.TokenTypePlus, powNode(b, numberNode(2))))
+	},
+}
+
+// dependsOn reports whether the variable occurs in node.
+func dependsOn(node expronaut.ASTNode, variable string) bool {
+	switch n := node.(type) {
+	case *expronaut.VariableNode:
+		return n.Name == variable
+	case *UnaryOperationNode:
+		return dependsOn(n.Operand, variable)
+	case *expronaut.BinaryOperationNode:
+		return dependsOn(n.Left, variable) || dependsOn(n.Right, variable)
+	case *expronaut.LogicalOperationNode:
+		return dependsOn(n.Left, variable) || dependsOn(n.Right, variable)
+	case *ConversionNode:
+		return dependsOn(n.Value, variable) || dependsOn(n.Target, variable)
+	case *expronaut.FunctionCallNode:
+		return anyDependsOn(n.Arguments, variable)
+	case *expronaut.ArrayNode:
+		return anyDependsOn(n.Elements, variable)
+	case *MatrixNode:
+		return anyDependsOn(n.Elements, variable)
+	}
+	return false
+}
+
+func anyDependsOn(nodes []expronaut.ASTNode, variable string) bool {
+	for _, n := range nodes {
+		if dependsOn(n, variable) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectable are the operators Simplify rewrites into a sum of terms.
+var collectable = map[expronaut.TokenType]bool{
+	expronaut.TokenTypePlus:     true,
+	expronaut.TokenTypeMinus:    true,
+	expronaut.TokenTypeMultiply: true,
+	expronaut.TokenTypeDivide:   true,
+	expronaut.TokenTypeExponent: true,
+}
+
+// Simplify folds constants, removes identities such as x * 1 and x + 0 and
+// collects like terms, so that x + 2 * x - 3 becomes 3 * x - 3 and
+// x * x / x becomes x. Arithmetic is rewritten into a sum of terms with
+// exact rational coefficients and then printed back, products of sums are
+// not expanded.
+func Simplify(node expronaut.ASTNode) expronaut.ASTNode {
+	switch n := node.(type) {
+	case *UnaryOperationNode:
+		return collect(n).node()
+	case *expronaut.BinaryOperationNode:
+		if collectable[n.Operator] {
+			return collect(n).node()
+		}
+		return binaryNode(Simplify(n.Left), n.Operator, Simplify(n.Right))
+	case *expronaut.LogicalOperationNode:
+		return &expronaut.LogicalOperationNode{Left: Simplify(n.Left), Operator: n.Operator, Right: Simplify(n.Right)}
+	case *ConversionNode:
+		return &ConversionNode{Value: Simplify(n.Value), Keyword: n.Keyword, Target: Simplify(n.Target)}
+	case *expronaut.FunctionCallNode:
+		args := simplifyAll(n.Arguments)
+		if folded, ok := foldCall(n.FunctionName, args); ok {
+			return folded
+		}
+		return &expronaut.FunctionCallNode{FunctionName: n.FunctionName, Arguments: args}
+	case *expronaut.ArrayNode:
+		return &expronaut.ArrayNode{Elements: simplifyAll(n.Elements)}
+	case *MatrixNode:
+		return &MatrixNode{Elements: simplifyAll(n.Elements)}
+	}
+	return node
+}
+
+func simplifyAll(nodes []expronaut.ASTNode) []expronaut.ASTNode {
+	out := make([]expronaut.ASTNode, len(nodes))
+	for i, n := range nodes {
+		out[i] = Simplify(n)
+	}
+	return out
+}
+
+// foldCall evaluates a builtin with constant arguments when the result is
+// an integer, like sqrt(4) or cos(0). Other results, like sin(1), are kept
+// as they are exact while the number is not.
+func foldCall(name string, args []expronaut.ASTNode) (expronaut.ASTNode, bool) {
+	if _, lazy := lazyFunctions[name]; lazy {
+		return nil, false
+	}
+
+	values := make([]any, len(args))
+	for i, arg := range args {
+		v, ok := numberValue(arg)
+		if !ok {
+			return nil, false
+		}
+		values[i] = v
+	}
+
+	out, err := call(context.Background(), name, values)
+	if err != nil {
+		return nil, false
+	}
+
+	f, ok := toFloat(out)
+	if !ok || f != math.Trunc(f) || math.Abs(f) > 1e15 {
+		return nil, false
+	}
+	return numberNode(f), true
+}
+
+// factor is a non-numeric base raised to a numeric exponent.
+type factor struct {
+	base expronaut.ASTNode
+	key  string
+	exp  float64
+}
+
+// term is a rational coefficient times a product of factors.
+type term struct {
+	coef    *big.Rat
+	factors []factor
+}
+
+// terms is a sum of terms, the empty sum is zero.
+type terms []term
+
+func constant(r *big.Rat) terms {
+	if r.Sign() == 0 {
+		return terms{}
+	}
+	return terms{{coef: r}}
+}
+
+func single(base expronaut.ASTNode, exp float64) terms {
+	return terms{{coef: big.NewRat(1, 1), factors: []factor{{base: base, key: Infix(base), exp: exp}}}}
+}
+
+// collect rewrites an arithmetic expression into a sum of terms.
+func collect(node expronaut.ASTNode) terms {
+	switch n := node.(type) {
+	case *expronaut.IntLiteralNode:
+		return constant(big.NewRat(int64(n.Value), 1))
+	case *expronaut.FloatLiteralNode:
+		// parse the shortest representation, so 0.1 is one tenth
+		if r, ok := new(big.Rat).SetString(strconv.FormatFloat(n.Value, 'g', -1, 64)); ok {
+			return constant(r)
+		}
+	case *UnaryOperationNode:
+		operand := collect(n.Operand)
+		if n.Operator == expronaut.TokenTypeMinus {
+			return operand.negate()
+		}
+		return operand
+	case *expronaut.BinaryOperationNode:
+		switch n.Operator {
+		case expronaut.TokenTypePlus:
+			return collect(n.Left).add(collect(n.Right))
+		case expronaut.TokenTypeMinus:
+			return collect(n.Left).add(collect(n.Right).negate())
+		case expronaut.TokenTypeMultiply:
+			return collect(n.Left).mul(collect(n.Right))
+		case expronaut.TokenTypeDivide:
+			l, r := collect(n.Left), collect(n.Right)
+			if inv, ok := r.inverse(); ok {
+				return l.mul(inv)
+			}
+			return single(binaryNode(l.node(), expronaut.TokenTypeDivide, r.node()), 1)
+		case expronaut.TokenTypeExponent:
+			base, exponent := collect(n.Left), Simplify(n.Right)
+			if k, ok := numberValue(exponent); ok {
+				if p, ok := base.pow(k); ok {
+					return p
+				}
+				return single(base.node(), k)
+			}
+			return single(powNode(base.node(), exponent), 1)
+		}
+	}
+
+	simplified := Simplify(node)
+	if _, ok := numberValue(simplified); ok {
+		// a folded call like sqrt(16)
+		return collect(simplified)
+	}
+	return single(simplified, 1)
+}
+
+func (ts terms) negate() terms {
+	out := make(terms, len(ts))
+	for i, t := range ts {
+		out[i] = term{coef: new(big.Rat).Neg(t.coef), factors: t.factors}
+	}
+	return out
+}
+
+// add adds like terms, those with the same factors, by adding their
+// coefficients.
+func (ts terms) add(other terms) terms {
+	out := append(terms{}, ts...)
+
+	for _, t := range other {
+		merged := false
+		for i, o := range out {
+			if o.monomial() == t.monomial() {
+				out[i] = term{coef: new(big.Rat).Add(o.coef, t.coef), factors: o.factors}
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			out = append(out, t)
+		}
+	}
+
+	// drop the terms that cancelled out
+	kept := out[:0]
+	for _, t := range out {
+		if t.coef.Sign() != 0 {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// mul multiplies two sums. A constant is distributed over a sum, other sums
+// are kept as a factor: 2 * (x + 1) becomes 2 * x + 2, x * (x + 1) is not
+// expanded.
+func (ts terms) mul(other terms) terms {
+	if len(ts) == 0 || len(other) == 0 {
+		return terms{}
+	}
+
+	if c, ok := ts.constant(); ok {
+		return other.scale(c)
+	}
+	if c, ok := other.constant(); ok {
+		return ts.scale(c)
+	}
+
+	return terms{ts.asTerm().mul(other.asTerm())}
+}
+
+func (ts terms) scale(c *big.Rat) terms {
+	out := make(terms, len(ts))
+	for i, t := range ts {
+		out[i] = term{coef: new(big.Rat).Mul(t.coef, c), factors: t.factors}
+	}
+	return out
+}
+
+// constant returns the value of a sum without factors.
+func (ts terms) constant() (*big.Rat, bool) {
+	switch {
+	case len(ts) == 0:
+		return new(big.Rat), true
+	case len(ts) == 1 && len(ts[0].factors) == 0:
+		return ts[0].coef, true
+	}
+	return nil, false
+}
+
+// asTerm returns the sum as a single term, sums of several terms become a
+// factor.
+func (ts terms) asTerm() term {
+	if len(ts) == 1 {
+		return ts[0]
+	}
+	return single(ts.node(), 1)[0]
+}
+
+func (ts terms) inverse() (terms, bool) {
+	if len(ts) == 0 {
+		return nil, false
+	}
+
+	t := ts.asTerm()
+	if t.coef.Sign() == 0 {
+		return nil, false
+	}
+
+	factors := make([]factor, len(t.factors))
+	for i, f := range t.factors {
+		factors[i] = factor{base: f.base, key: f.key, exp: -f.exp}
+	}
+	return terms{{coef: new(big.Rat).Inv(t.coef), factors: factors}}, true
+}
+
+// pow raises the sum to the power k. It fails when the coefficient cannot
+// be raised exactly.
+func (ts terms) pow(k float64) (terms, bool) {
+	if k == 0 {
+		return constant(big.NewRat(1, 1)), true
+	}
+	if k == 1 {
+		return ts, true
+	}
+	if len(ts) == 0 {
+		return terms{}, k > 0
+	}
+
+	t := ts.asTerm()
+
+	coef := big.NewRat(1, 1)
+	switch {
+	case t.coef.Cmp(coef) == 0:
+	case k == math.Trunc(k) && math.Abs(k) <= 64:
+		for range int(math.Abs(k)) {
+			coef.Mul(coef, t.coef)
+		}
+		if k < 0 {
+			coef.Inv(coef)
+		}
+	default:
+		return nil, false
+	}
+
+	factors := make([]factor, 0, len(t.factors))
+	for _, f := range t.factors {
+		factors = append(factors, factor{base: f.base, key: f.key, exp: f.exp * k})
+	}
+	return terms{{coef: coef, factors: factors}}, true
+}
+
+// mul multiplies two terms, adding the exponents of equal factors.
+func (t term) mul(other term) term {
+	factors := append([]factor{}, t.factors...)
+
+	for _, f := range other.factors {
+		merged := false
+		for i, g := range factors {
+			if g.key == f.key {
+				factors[i].exp += f.exp
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			factors = append(factors, f)
+		}
+	}
+
+	// x ** 0 is 1
+	kept := factors[:0]
+	for _, f := range factors {
+		if f.exp != 0 {
+			kept = append(kept, f)
+		}
+	}
+
+	return term{coef: new(big.Rat).Mul(t.coef, other.coef), factors: kept}
+}
+
+// monomial identifies the factors of a term regardless of their order.
+func (t term) monomial() string {
+	keys := make([]string, len(t.factors))
+	for i, f := range t.factors {
+		keys[i] = f.key + "^" + strconv.FormatFloat(f.exp, 'g', -1, 64)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "*")
+}
+
+func (t term) degree() float64 {
+	d := 0.0
+	for _, f := range t.factors {
+		d += f.exp
+	}
+	return d
+}
+
+// node prints the sum back as nodes, highest degree first.
+func (ts terms) node() expronaut.ASTNode {
+	if len(ts) == 0 {
+		return numberNode(0)
+	}
+
+	sorted := append(terms{}, ts...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].degree() > sorted[j].degree() })
+
+	var out expronaut.ASTNode
+	for i, t := range sorted {
+		negative := t.coef.Sign() < 0
+		if i == 0 {
+			out = t.node(negative)
+			continue
+		}
+
+		op := expronaut.TokenTypePlus
+		if negative {
+			op = expronaut.TokenTypeMinus
+		}
+		out = binaryNode(out, op, t.node(false))
+	}
+	return out
+}
+
+// node prints the term with the absolute value of its coefficient, or
+// negated when negate is set.
+func (t term) node(negate bool) expronaut.ASTNode {
+	abs := new(big.Rat).Abs(t.coef)
+
+	var numerator, denominator []expronaut.ASTNode
+
+	// small denominators print as a fraction, x / 3, others as a decimal
+	p, q := abs, big.NewRat(1, 1)
+	if !abs.IsInt() && abs.Denom().Cmp(big.NewInt(100)) <= 0 {
+		p, q = new(big.Rat).SetInt(abs.Num()), new(big.Rat).SetInt(abs.Denom())
+	}
+
+	hasFactors := false
+	for _, f := range t.factors {
+		if f.exp > 0 {
+			hasFactors = true
+		}
+	}
+	if p.Cmp(big.NewRat(1, 1)) != 0 || !hasFactors {
+		numerator = append(numerator, ratNode(p))
+	}
+	if q.Cmp(big.NewRat(1, 1)) != 0 {
+		denominator = append(denominator, ratNode(q))
+	}
+
+	for _, f := range t.factors {
+		switch {
+		case f.exp > 0:
+			numerator = append(numerator, factorNode(f.base, f.exp))
+		case f.exp < 0:
+			denominator = append(denominator, factorNode(f.base, -f.exp))
+		}
+	}
+
+	if negate {
+		if lit, ok := numerator[0].(*expronaut.IntLiteralNode); ok {
+			numerator[0] = &expronaut.IntLiteralNode{Value: -lit.Value}
+		} else if lit, ok := numerator[0].(*expronaut.FloatLiteralNode); ok {
+			numerator[0] = &expronaut.FloatLiteralNode{Value: -lit.Value}
+		} else {
+			numerator[0] = negNode(numerator[0])
+		}
+	}
+
+	out := product(numerator)
+	if len(denominator) > 0 {
+		out = divNode(out, product(denominator))
+	}
+	return out
+}
+
+func product(nodes []expronaut.ASTNode) expronaut.ASTNode {
+	out := nodes[0]
+	for _, n := range nodes[1:] {
+		out = mulNode(out, n)
+	}
+	return out
+}
+
+func factorNode(base expronaut.ASTNode, exp float64) expronaut.ASTNode {
+	if exp == 1 {
+		return base
+	}
+	return powNode(base, numberNode(exp))
+}
+
+func ratNode(r *big.Rat) expronaut.ASTNode {
+	if r.IsInt() && r.Num().IsInt64() {
+		return numberNode(float64(r.Num().Int64()))
+	}
+	f, _ := r.Float64()
+	return &expronaut.FloatLiteralNode{Value: f}
+}
+
+// numberValue returns the value of a numeric literal, including a negated
+// one.
+func numberValue(node expronaut.ASTNode) (float64, bool) {
+	switch n := node.(type) {
+	case *expronaut.IntLiteralNode:
+		return float64(n.Value), true
+	case *expronaut.FloatLiteralNode:
+		return n.Value, true
+	case *UnaryOperationNode:
+		v, ok := numberValue(n.Operand)
+		if n.Operator == expronaut.TokenTypeMinus {
+			v = -v
+		}
+		return v, ok
+	}
+	return 0, false
+}
+
+// numberNode returns an int literal for integral values and a float
+// literal otherwise.
+func numberNode(v float64) expronaut.ASTNode {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return &expronaut.IntLiteralNode{Value: int(v)}
+	}
+	return &expronaut.FloatLiteralNode{Value: v}
+}
+
+func binaryNode(l expronaut.ASTNode, op expronaut.TokenType, r expronaut.ASTNode) expronaut.ASTNode {
+	return &expronaut.BinaryOperationNode{Left: l, Operator: op, Right: r}
+}
+
+func mulNode(l, r expronaut.ASTNode) expronaut.ASTNode {
+	return binaryNode(l, expronaut.TokenTypeMultiply, r)
+}
+
+func divNode(l, r expronaut.ASTNode) expronaut.ASTNode {
+	return binaryNode(l, expronaut.TokenTypeDivide, r)
+}
+
+func powNode(l, r expronaut.ASTNode) expronaut.ASTNode {
+	return binaryNode(l, expronaut.TokenTypeExponent, r)
+}
+
+func negNode(n expronaut.ASTNode) expronaut.ASTNode {
+	return &UnaryOperationNode{Operator: expronaut.TokenTypeMinus, Operand: n}
+}
+
+func callNode(name string, args ...expronaut.ASTNode) expronaut.ASTNode {
+	return &expronaut.FunctionCallNode{FunctionName: name, Arguments: args}
+}
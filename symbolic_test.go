@@ -0,0 +1,90 @@
+package goculator
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestSymbolicEvaluate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "diff(x**3 + 2*x, x)", want: "3 * x ** 2 + 2"},
+		{input: "diff(sin(x) / x, x)", want: "(cos(x) * x - sin(x)) / x ** 2"},
+		{input: "diff(5, x)", want: "0"},
+		{input: "diff(y * x, x)", want: "y"},
+		{input: "simplify(x + 2*x - 3)", want: "3 * x - 3"},
+		{input: "simplify(x/3 + x/6)", want: "x / 2"},
+		{input: "simplify(x * 1 + 0)", want: "x"},
+		{input: "simplify(2 + 3)", want: "5"},
+		{input: "simplify(x - x)", want: "0"},
+		{input: "simplify()", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", Format(out))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeriveNumerically checks derivatives against a central difference,
+// for functions where the shape of the result does not matter.
+func TestDeriveNumerically(t *testing.T) {
+	tests := []string{
+		"x ** 2 * sin(x)",
+		"x ** 3 - 4 * x",
+		"ln(x) / x",
+		"sqrt(x ** 2 + 1)",
+		"cos(x) ** 3",
+		"2 ** x",
+		"tan(x) - x",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			tree, err := Parse(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := Derive(tree.Root, "x")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, x := range []float64{0.3, 0.7, 1.2} {
+				dv, err := Eval(WithVariable(context.Background(), "x", x), d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, _ := toFloat(dv)
+
+				const h = 1e-6
+				hi, _ := Eval(WithVariable(context.Background(), "x", x+h), tree.Root)
+				lo, _ := Eval(WithVariable(context.Background(), "x", x-h), tree.Root)
+				fhi, _ := toFloat(hi)
+				flo, _ := toFloat(lo)
+				want := (fhi - flo) / (2 * h)
+
+				if math.Abs(got-want) > 1e-4*math.Max(1, math.Abs(want)) {
+					t.Fatalf("x = %g: got %g, want %g", x, got, want)
+				}
+			}
+		})
+	}
+}
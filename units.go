@@ -0,0 +1,567 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/donseba/expronaut"
+)
+
+// ErrDimensionMismatch is returned when quantities of different dimensions
+// are added, compared or converted, e.g. "5 m + 3 s".
+var ErrDimensionMismatch = errors.New("dimension mismatch")
+
+// Dimension holds the exponents of the seven SI base dimensions.
+type Dimension [7]int
+
+const (
+	dimLength = iota
+	dimMass
+	dimTime
+	dimCurrent
+	dimTemperature
+	dimAmount
+	dimLuminosity
+)
+
+var (
+	baseSymbols = [7]string{"m", "kg", "s", "A", "K", "mol", "cd"}
+
+	dimensionless = Dimension{}
+	length        = Dimension{dimLength: 1}
+	mass          = Dimension{dimMass: 1}
+	duration      = Dimension{dimTime: 1}
+	current       = Dimension{dimCurrent: 1}
+	temperature   = Dimension{dimTemperature: 1}
+	amount        = Dimension{dimAmount: 1}
+	luminosity    = Dimension{dimLuminosity: 1}
+	area          = Dimension{dimLength: 2}
+	volume        = Dimension{dimLength: 3}
+	speed         = Dimension{dimLength: 1, dimTime: -1}
+	acceleration  = Dimension{dimLength: 1, dimTime: -2}
+	force         = Dimension{dimMass: 1, dimLength: 1, dimTime: -2}
+	energy        = Dimension{dimMass: 1, dimLength: 2, dimTime: -2}
+	power         = Dimension{dimMass: 1, dimLength: 2, dimTime: -3}
+	pressure      = Dimension{dimMass: 1, dimLength: -1, dimTime: -2}
+	frequency     = Dimension{dimTime: -1}
+	charge        = Dimension{dimCurrent: 1, dimTime: 1}
+	voltage       = Dimension{dimMass: 1, dimLength: 2, dimTime: -3, dimCurrent: -1}
+	resistance    = Dimension{dimMass: 1, dimLength: 2, dimTime: -3, dimCurrent: -2}
+)
+
+// dimensionNames names the common dimensions in error messages.
+var dimensionNames = map[Dimension]string{
+	dimensionless: "dimensionless",
+	length:        "length",
+	mass:          "mass",
+	duration:      "time",
+	current:       "current",
+	temperature:   "temperature",
+	amount:        "amount of substance",
+	luminosity:    "luminous intensity",
+	area:          "area",
+	volume:        "volume",
+	speed:         "speed",
+	acceleration:  "acceleration",
+	force:         "force",
+	energy:        "energy",
+	power:         "power",
+	pressure:      "pressure",
+	frequency:     "frequency",
+	charge:        "charge",
+	voltage:       "voltage",
+	resistance:    "resistance",
+}
+
+func (d Dimension) add(o Dimension, sign int) Dimension {
+	for i := range d {
+		d[i] += sign * o[i]
+	}
+	return d
+}
+
+// String describes the dimension by name, or in SI base units when it has
+// no common name.
+func (d Dimension) String() string {
+	if name, ok := dimensionNames[d]; ok {
+		return name
+	}
+
+	var u Unit
+	for i, exp := range d {
+		if exp != 0 {
+			u.terms = append(u.terms, unitTerm{atom: atom{symbol: baseSymbols[i], factor: 1}, exp: exp})
+		}
+	}
+	return u.String()
+}
+
+// atom is a single named unit, possibly prefixed, such as km or degF.
+type atom struct {
+	symbol string
+	factor float64 // size of one unit in SI base units
+	offset float64 // zero point shift for temperatures, in units of the atom
+	dim    Dimension
+}
+
+type unitDef struct {
+	atom
+	prefixable bool
+	aliases    []string
+}
+
+// units is the offline unit table. Factors are exact where the unit is
+// defined exactly in terms of SI (the international inch, foot and pound,
+// the US customary volumes).
+var units = []unitDef{
+	// length
+	{atom: atom{symbol: "m", factor: 1, dim: length}, prefixable: true, aliases: []string{"meter", "meters", "metre", "metres"}},
+	{atom: atom{symbol: "inch", factor: 0.0254, dim: length}, aliases: []string{"inches"}},
+	{atom: atom{symbol: "ft", factor: 0.3048, dim: length}, aliases: []string{"foot", "feet"}},
+	{atom: atom{symbol: "yd", factor: 0.9144, dim: length}, aliases: []string{"yard", "yards"}},
+	{atom: atom{symbol: "mi", factor: 1609.344, dim: length}, aliases: []string{"mile", "miles"}},
+	{atom: atom{symbol: "nmi", factor: 1852, dim: length}},
+
+	// mass
+	{atom: atom{symbol: "g", factor: 1e-3, dim: mass}, prefixable: true, aliases: []string{"gram", "grams"}},
+	{atom: atom{symbol: "t", factor: 1000, dim: mass}, aliases: []string{"tonne", "tonnes"}},
+	{atom: atom{symbol: "lb", factor: 0.45359237, dim: mass}, aliases: []string{"lbs", "pound", "pounds"}},
+	{atom: atom{symbol: "oz", factor: 0.028349523125, dim: mass}, aliases: []string{"ounce", "ounces"}},
+	{atom: atom{symbol: "st", factor: 6.35029318, dim: mass}, aliases: []string{"stone"}},
+
+	// time
+	{atom: atom{symbol: "s", factor: 1, dim: duration}, prefixable: true, aliases: []string{"sec", "second", "seconds"}},
+	{atom: atom{symbol: "min", factor: 60, dim: duration}, aliases: []string{"minute", "minutes"}},
+	{atom: atom{symbol: "h", factor: 3600, dim: duration}, aliases: []string{"hr", "hour", "hours"}},
+	{atom: atom{symbol: "d", factor: 86400, dim: duration}, aliases: []string{"day", "days"}},
+	{atom: atom{symbol: "wk", factor: 604800, dim: duration}, aliases: []string{"week", "weeks"}},
+	{atom: atom{symbol: "yr", factor: 31557600, dim: duration}, aliases: []string{"year", "years"}},
+
+	// remaining SI base units
+	{atom: atom{symbol: "A", factor: 1, dim: current}, prefixable: true, aliases: []string{"ampere", "amperes"}},
+	{atom: atom{symbol: "K", factor: 1, dim: temperature}, aliases: []string{"kelvin"}},
+	{atom: atom{symbol: "degC", factor: 1, offset: 273.15, dim: temperature}, aliases: []string{"celsius"}},
+	{atom: atom{symbol: "degF", factor: 5.0 / 9.0, offset: 459.67, dim: temperature}, aliases: []string{"fahrenheit"}},
+	{atom: atom{symbol: "mol", factor: 1, dim: amount}, prefixable: true},
+	{atom: atom{symbol: "cd", factor: 1, dim: luminosity}, aliases: []string{"candela"}},
+
+	// area and volume
+	{atom: atom{symbol: "ha", factor: 1e4, dim: area}, aliases: []string{"hectare", "hectares"}},
+	{atom: atom{symbol: "acre", factor: 4046.8564224, dim: area}, aliases: []string{"acres"}},
+	{atom: atom{symbol: "L", factor: 1e-3, dim: volume}, prefixable: true, aliases: []string{"l", "liter", "liters", "litre", "litres"}},
+	{atom: atom{symbol: "gal", factor: 3.785411784e-3, dim: volume}, aliases: []string{"gallon", "gallons"}},
+	{atom: atom{symbol: "qt", factor: 0.946352946e-3, dim: volume}, aliases: []string{"quart", "quarts"}},
+	{atom: atom{symbol: "pt", factor: 0.473176473e-3, dim: volume}, aliases: []string{"pint", "pints"}},
+	{atom: atom{symbol: "cup", factor: 0.2365882365e-3, dim: volume}, aliases: []string{"cups"}},
+	{atom: atom{symbol: "floz", factor: 29.5735295625e-6, dim: volume}},
+
+	// speed
+	{atom: atom{symbol: "mph", factor: 0.44704, dim: speed}},
+	{atom: atom{symbol: "kn", factor: 1852.0 / 3600.0, dim: speed}, aliases: []string{"knot", "knots"}},
+
+	// derived units
+	{atom: atom{symbol: "N", factor: 1, dim: force}, prefixable: true, aliases: []string{"newton", "newtons"}},
+	{atom: atom{symbol: "lbf", factor: 4.4482216152605, dim: force}},
+	{atom: atom{symbol: "J", factor: 1, dim: energy}, prefixable: true, aliases: []string{"joule", "joules"}},
+	{atom: atom{symbol: "cal", factor: 4.184, dim: energy}, prefixable: true},
+	{atom: atom{symbol: "Wh", factor: 3600, dim: energy}, prefixable: true},
+	{atom: atom{symbol: "eV", factor: 1.602176634e-19, dim: energy}, prefixable: true},
+	{atom: atom{symbol: "BTU", factor: 1055.05585262, dim: energy}},
+	{atom: atom{symbol: "W", factor: 1, dim: power}, prefixable: true, aliases: []string{"watt", "watts"}},
+	{atom: atom{symbol: "hp", factor: 745.69987158227022, dim: power}},
+	{atom: atom{symbol: "Pa", factor: 1, dim: pressure}, prefixable: true},
+	{atom: atom{symbol: "bar", factor: 1e5, dim: pressure}, prefixable: true},
+	{atom: atom{symbol: "atm", factor: 101325, dim: pressure}},
+	{atom: atom{symbol: "psi", factor: 6894.757293168, dim: pressure}},
+	{atom: atom{symbol: "mmHg", factor: 133.322387415, dim: pressure}},
+	{atom: atom{symbol: "Hz", factor: 1, dim: frequency}, prefixable: true, aliases: []string{"hertz"}},
+	{atom: atom{symbol: "C", factor: 1, dim: charge}, prefixable: true, aliases: []string{"coulomb", "coulombs"}},
+	{atom: atom{symbol: "V", factor: 1, dim: voltage}, prefixable: true, aliases: []string{"volt", "volts"}},
+	{atom: atom{symbol: "Ohm", factor: 1, dim: resistance}, prefixable: true, aliases: []string{"ohm", "ohms"}},
+}
+
+// prefixes are the SI prefixes, micro is spelled u.
+var prefixes = map[string]float64{
+	"Y": 1e24, "Z": 1e21, "E": 1e18, "P": 1e15, "T": 1e12, "G": 1e9, "M": 1e6, "k": 1e3, "h": 1e2, "da": 1e1,
+	"d": 1e-1, "c": 1e-2, "m": 1e-3, "u": 1e-6, "n": 1e-9, "p": 1e-12, "f": 1e-15, "a": 1e-18,
+}
+
+var (
+	unitsBySymbol   = map[string]atom{}
+	prefixableUnits = map[string]atom{}
+)
+
+func init() {
+	for _, u := range units {
+		unitsBySymbol[u.symbol] = u.atom
+		for _, alias := range u.aliases {
+			unitsBySymbol[alias] = u.atom
+		}
+		if u.prefixable {
+			prefixableUnits[u.symbol] = u.atom
+		}
+	}
+}
+
+// LookupUnit resolves a unit symbol such as "km", "h" or "degF" to a
+// quantity of one of that unit.
+func LookupUnit(name string) (Quantity, bool) {
+	if a, ok := unitsBySymbol[name]; ok {
+		return Quantity{Value: 1, Unit: Unit{terms: []unitTerm{{atom: a, exp: 1}}}}, true
+	}
+
+	for prefix, factor := range prefixes {
+		base, ok := prefixableUnits[strings.TrimPrefix(name, prefix)]
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		a := atom{symbol: name, factor: factor * base.factor, dim: base.dim}
+		return Quantity{Value: 1, Unit: Unit{terms: []unitTerm{{atom: a, exp: 1}}}}, true
+	}
+
+	return Quantity{}, false
+}
+
+type unitTerm struct {
+	atom atom
+	exp  int
+}
+
+// Unit is a product of unit atoms raised to integer powers, such as km/h.
+// The order of the terms is kept so results print the way they were typed.
+type Unit struct {
+	terms []unitTerm
+}
+
+// Factor returns the size of the unit in SI base units.
+func (u Unit) Factor() float64 {
+	f := 1.0
+	for _, t := range u.terms {
+		f *= math.Pow(t.atom.factor, float64(t.exp))
+	}
+	return f
+}
+
+// Dimension returns the combined dimension of the unit.
+func (u Unit) Dimension() Dimension {
+	var d Dimension
+	for _, t := range u.terms {
+		d = d.add(t.atom.dim, t.exp)
+	}
+	return d
+}
+
+// offset returns the zero point shift of an absolute temperature unit, and
+// whether the unit has one at all.
+func (u Unit) offset() (float64, bool) {
+	for _, t := range u.terms {
+		if t.atom.offset != 0 {
+			return t.atom.offset, true
+		}
+	}
+	return 0, false
+}
+
+func (u Unit) isOffset() bool {
+	_, ok := u.offset()
+	return ok
+}
+
+func (u Unit) mul(o Unit, sign int) Unit {
+	terms := make([]unitTerm, len(u.terms), len(u.terms)+len(o.terms))
+	copy(terms, u.terms)
+
+outer:
+	for _, ot := range o.terms {
+		for i, t := range terms {
+			if t.atom.symbol == ot.atom.symbol {
+				terms[i].exp += sign * ot.exp
+				continue outer
+			}
+		}
+		terms = append(terms, unitTerm{atom: ot.atom, exp: sign * ot.exp})
+	}
+
+	out := Unit{}
+	for _, t := range terms {
+		if t.exp != 0 {
+			out.terms = append(out.terms, t)
+		}
+	}
+	return out
+}
+
+func (u Unit) pow(n int) Unit {
+	out := Unit{terms: make([]unitTerm, len(u.terms))}
+	for i, t := range u.terms {
+		out.terms[i] = unitTerm{atom: t.atom, exp: t.exp * n}
+	}
+	return out
+}
+
+func (u Unit) equal(o Unit) bool {
+	if len(u.terms) != len(o.terms) {
+		return false
+	}
+	for i := range u.terms {
+		if u.terms[i] != o.terms[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the unit in a form the parser reads back, e.g. kg*m/s^2.
+func (u Unit) String() string {
+	var num, den []string
+	for _, t := range u.terms {
+		exp := t.exp
+		if exp < 0 {
+			exp = -exp
+		}
+
+		s := t.atom.symbol
+		if exp != 1 {
+			s = fmt.Sprintf("%s^%d", s, exp)
+		}
+
+		if t.exp > 0 {
+			num = append(num, s)
+		} else {
+			den = append(den, s)
+		}
+	}
+
+	out := strings.Join(num, "*")
+	if len(num) == 0 {
+		out = "1"
+	}
+	for _, d := range den {
+		out += "/" + d
+	}
+	return out
+}
+
+// Quantity is a number with a unit. Value is expressed in Unit, not in SI
+// base units, so results keep the units they were written in.
+type Quantity struct {
+	Value float64
+	Unit  Unit
+}
+
+// SI returns the value in SI base units.
+func (q Quantity) SI() float64 {
+	offset, _ := q.Unit.offset()
+	return (q.Value + offset) * q.Unit.Factor()
+}
+
+// Dimension returns the dimension of the quantity.
+func (q Quantity) Dimension() Dimension {
+	return q.Unit.Dimension()
+}
+
+func (q Quantity) String() string {
+	return Format(q.Value) + " " + q.Unit.String()
+}
+
+// in expresses the quantity in another unit of the same dimension.
+func (q Quantity) in(u Unit) float64 {
+	offset, _ := u.offset()
+	v := q.SI() / u.Factor()
+	return snap(v-offset, v, offset)
+}
+
+// snap returns zero for a sum or difference that is only rounding noise next
+// to its operands, so 32 degF in degC is 0 degC rather than 5.68e-14 degC.
+func snap(v float64, operands ...float64) float64 {
+	var largest float64
+	for _, o := range operands {
+		largest = max(largest, math.Abs(o))
+	}
+
+	if math.Abs(v) <= 1e-12*largest {
+		return 0
+	}
+	return v
+}
+
+// describe names the quantity for error messages, e.g. "length (km)".
+func (q Quantity) describe() string {
+	return fmt.Sprintf("%s (%s)", q.Dimension(), q.Unit)
+}
+
+// simplify collapses dimensionless results such as km/m to plain numbers.
+func (q Quantity) simplify() any {
+	if len(q.Unit.terms) == 0 {
+		return q.Value
+	}
+	if q.Dimension() == dimensionless {
+		return q.Value * q.Unit.Factor()
+	}
+	return q
+}
+
+// toQuantity accepts quantities and plain numbers, which are dimensionless.
+func toQuantity(v any) (Quantity, bool) {
+	switch val := v.(type) {
+	case Quantity:
+		return val, true
+	case int:
+		return Quantity{Value: float64(val)}, true
+	case float64:
+		return Quantity{Value: val}, true
+	}
+	return Quantity{}, false
+}
+
+// Operate implements Operand so quantities work with the binary operators.
+func (q Quantity) Operate(ctx context.Context, op expronaut.TokenType, other any, reverse bool) (any, error) {
+	o, ok := toQuantity(other)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	l, r := q, o
+	if reverse {
+		l, r = o, q
+	}
+
+	switch op {
+	case expronaut.TokenTypePlus, expronaut.TokenTypeMinus, expronaut.TokenTypeModulo:
+		if l.Dimension() != r.Dimension() {
+			return nil, fmt.Errorf("%w: cannot %s %s and %s", ErrDimensionMismatch, verbs[op], l.describe(), r.describe())
+		}
+
+		rv := r.Value
+		if !l.Unit.equal(r.Unit) {
+			if l.Unit.isOffset() || r.Unit.isOffset() {
+				return nil, fmt.Errorf("cannot %s temperatures in %s and %s, convert them first", verbs[op], l.Unit, r.Unit)
+			}
+			rv = r.in(l.Unit)
+		}
+
+		switch op {
+		case expronaut.TokenTypePlus:
+			return Quantity{Value: snap(l.Value+rv, l.Value, rv), Unit: l.Unit}.simplify(), nil
+		case expronaut.TokenTypeMinus:
+			return Quantity{Value: snap(l.Value-rv, l.Value, rv), Unit: l.Unit}.simplify(), nil
+		default:
+			return Quantity{Value: math.Mod(l.Value, rv), Unit: l.Unit}.simplify(), nil
+		}
+	case expronaut.TokenTypeMultiply, expronaut.TokenTypeDivide, expronaut.TokenTypeDivideInteger:
+		sign := 1
+		if op != expronaut.TokenTypeMultiply {
+			sign = -1
+		}
+
+		// scaling a temperature by a number is fine, combining it with other
+		// units is not
+		if (l.Unit.isOffset() && len(r.Unit.terms) > 0) || (r.Unit.isOffset() && (len(l.Unit.terms) > 0 || sign < 0)) {
+			return nil, fmt.Errorf("cannot %s temperatures in %s, convert them to K first", verbs[op], q.Unit)
+		}
+
+		value := l.Value * r.Value
+		if sign < 0 {
+			value = l.Value / r.Value
+		}
+
+		out := Quantity{Value: value, Unit: l.Unit.mul(r.Unit, sign)}
+		if op == expronaut.TokenTypeDivideInteger {
+			out.Value = math.Floor(out.Value)
+		}
+		return out.simplify(), nil
+	case expronaut.TokenTypeExponent:
+		if len(r.Unit.terms) > 0 {
+			return nil, fmt.Errorf("%w: exponent must be dimensionless, got %s", ErrDimensionMismatch, r.describe())
+		}
+		if r.Value != math.Trunc(r.Value) {
+			return nil, fmt.Errorf("cannot raise %s to the non integer power %s", l.Unit, Format(r.Value))
+		}
+		if l.Unit.isOffset() {
+			return nil, fmt.Errorf("cannot raise temperatures in %s to a power, convert them to K first", l.Unit)
+		}
+		return Quantity{Value: math.Pow(l.Value, r.Value), Unit: l.Unit.pow(int(r.Value))}.simplify(), nil
+	case expronaut.TokenTypeEqual, expronaut.TokenTypeNotEqual,
+		expronaut.TokenTypeLessThan, expronaut.TokenTypeLessThanOrEqual,
+		expronaut.TokenTypeGreaterThan, expronaut.TokenTypeGreaterThanOrEqual:
+		if l.Dimension() != r.Dimension() {
+			return nil, fmt.Errorf("%w: cannot compare %s and %s", ErrDimensionMismatch, l.describe(), r.describe())
+		}
+
+		node := &expronaut.BinaryOperationNode{Left: valueNode{l.SI()}, Operator: op, Right: valueNode{r.SI()}}
+		return node.Evaluate(ctx)
+	}
+
+	return nil, fmt.Errorf("operator %s is not supported for quantities", op)
+}
+
+var verbs = map[expronaut.TokenType]string{
+	expronaut.TokenTypePlus:          "add",
+	expronaut.TokenTypeMinus:         "subtract",
+	expronaut.TokenTypeModulo:        "take the modulo of",
+	expronaut.TokenTypeMultiply:      "multiply",
+	expronaut.TokenTypeDivide:        "divide",
+	expronaut.TokenTypeDivideInteger: "divide",
+}
+
+// Convert implements Converter for "3 km in m" and "20 degC to degF".
+func (q Quantity) Convert(ctx context.Context, target any) (any, error) {
+	t, ok := target.(Quantity)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	if q.Dimension() != t.Dimension() {
+		return nil, fmt.Errorf("%w: cannot convert %s to %s", ErrDimensionMismatch, q.describe(), t.describe())
+	}
+
+	if t.Value == 0 {
+		return nil, fmt.Errorf("cannot convert to a zero quantity")
+	}
+
+	return Quantity{Value: q.in(t.Unit) / t.Value, Unit: t.Unit}, nil
+}
+
+// Apply implements Applier for the builtins that make sense for quantities.
+func (q Quantity) Apply(ctx context.Context, name string, args []any) (any, error) {
+	switch name {
+	case "abs", "round", "floor", "ceil":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s function expects a single argument", name)
+		}
+
+		fn := map[string]func(float64) float64{"abs": math.Abs, "round": math.Round, "floor": math.Floor, "ceil": math.Ceil}[name]
+		return Quantity{Value: fn(q.Value), Unit: q.Unit}, nil
+	case "sqrt":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("sqrt function expects a single argument")
+		}
+
+		half := Unit{terms: make([]unitTerm, len(q.Unit.terms))}
+		for i, t := range q.Unit.terms {
+			if t.exp%2 != 0 {
+				return nil, fmt.Errorf("cannot take the square root of %s", q.Unit)
+			}
+			half.terms[i] = unitTerm{atom: t.atom, exp: t.exp / 2}
+		}
+		return Quantity{Value: math.Sqrt(q.Value), Unit: half}, nil
+	case "min", "max":
+		var best Quantity
+		for i, arg := range args {
+			a, ok := arg.(Quantity)
+			if !ok || a.Dimension() != q.Dimension() {
+				return nil, fmt.Errorf("%w: %s function expects arguments of the same dimension", ErrDimensionMismatch, name)
+			}
+			if i == 0 || (name == "min" && a.SI() < best.SI()) || (name == "max" && a.SI() > best.SI()) {
+				best = a
+			}
+		}
+		return best, nil
+	}
+
+	return nil, fmt.Errorf("%s function does not accept values with units", name)
+}
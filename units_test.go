@@ -0,0 +1,51 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUnits(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "1 km + 200 m", want: "1.2 km"},
+		{input: "1 km in m", want: "1000 m"},
+		{input: "1 km - 1000 m", want: "0 km"},
+		{input: "0.1 m + 0.2 m - 0.3 m", want: "0 m"},
+		{input: "2 m * 3 m", want: "6 m^2"},
+		{input: "32 degF in degC", want: "0 degC"},
+		{input: "0 degC in degF", want: "32 degF"},
+		{input: "100 degC in degF", want: "212 degF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			out, err := Evaluate(context.Background(), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Format(out); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitsDimensionMismatch(t *testing.T) {
+	tests := []string{
+		"1 km + 1 s",
+		"1 km in s",
+		"1 m < 1 kg",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if _, err := Evaluate(context.Background(), input); !errors.Is(err, ErrDimensionMismatch) {
+				t.Fatalf("got error %v, want %v", err, ErrDimensionMismatch)
+			}
+		})
+	}
+}
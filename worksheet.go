@@ -0,0 +1,318 @@
+package goculator
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/donseba/expronaut"
+)
+
+// MaxRevisions is the number of earlier revisions a worksheet keeps, older
+// ones are dropped.
+const MaxRevisions = 50
+
+// Revision is an earlier version of the lines of a worksheet.
+type Revision struct {
+	Number int       `json:"number"`
+	Lines  []string  `json:"lines"`
+	Saved  time.Time `json:"saved"`
+}
+
+// Revise replaces the lines of the worksheet, keeping the lines it had as a
+// revision, and reports whether the lines changed.
+func (w *Worksheet) Revise(lines []string, now time.Time) bool {
+	if w.Revision > 0 && slices.Equal(w.Lines, lines) {
+		return false
+	}
+
+	if w.Revision > 0 {
+		w.Revisions = append(w.Revisions, Revision{Number: w.Revision, Lines: w.Lines, Saved: w.Updated})
+		if len(w.Revisions) > MaxRevisions {
+			w.Revisions = slices.Clone(w.Revisions[len(w.Revisions)-MaxRevisions:])
+		}
+	}
+
+	w.Revision++
+	w.Lines = slices.Clone(lines)
+	w.Updated = now
+	return true
+}
+
+// AtRevision returns the lines the worksheet had at the revision.
+func (w *Worksheet) AtRevision(number int) ([]string, bool) {
+	if number == w.Revision {
+		return w.Lines, true
+	}
+	for _, rev := range w.Revisions {
+		if rev.Number == number {
+			return rev.Lines, true
+		}
+	}
+	return nil, false
+}
+
+// SheetLine is the outcome of a line of a worksheet.
+type SheetLine struct {
+	Input string
+	// Name is the variable the line assigns or the function it defines.
+	Name  string
+	Value any
+	Err   error
+	// Uses are the names of the variables and functions the line reads.
+	Uses []string
+
+	definition bool
+}
+
+// sheetScope holds the variables and functions the lines of a worksheet
+// assign and define, for the lines below.
+type sheetScope struct {
+	vars map[string]any
+	fs   *Functions
+}
+
+// newSheetScope starts a scope with the variables and functions of ctx,
+// which are left as they are.
+func newSheetScope(ctx context.Context) (context.Context, *sheetScope) {
+	vars, _ := ctx.Value(expronaut.ContextKey).(map[string]any)
+	vars = maps.Clone(vars)
+	if vars == nil {
+		vars = map[string]any{}
+	}
+
+	fs := NewFunctions()
+	if parent, ok := ctx.Value(functionsKey{}).(*Functions); ok && parent != nil {
+		for _, f := range parent.List() {
+			fs.defs[f.Name] = f
+		}
+	}
+
+	return WithFunctions(ctx, fs), &sheetScope{vars: vars, fs: fs}
+}
+
+// EvaluateSheet calculates the lines of a worksheet top to bottom. An
+// assignment binds its variable and a definition defines its function for
+// the lines below, on top of the variables and functions of ctx, which are
+// left as they are. Blank lines and notes, lines starting with #, have no
+// value.
+func EvaluateSheet(ctx context.Context, lines []string) []SheetLine {
+	ctx, scope := newSheetScope(ctx)
+
+	out := make([]SheetLine, len(lines))
+	for i, in := range lines {
+		out[i] = scope.evaluate(ctx, in)
+	}
+
+	return out
+}
+
+// RecalculateSheet calculates the lines of a worksheet after line i was
+// edited, given the outcome of the lines before the edit. Only line i and
+// the lines depending on it, as Dependents reports them, are calculated
+// again, the other lines keep their outcome. Further names the edit affects,
+// such as the name line i assigned before, are passed as names. When the
+// previous lines do not match the lines apart from line i, all lines are
+// calculated.
+func RecalculateSheet(ctx context.Context, previous []SheetLine, lines []string, i int, names ...string) []SheetLine {
+	if len(previous) != len(lines) || i < 0 || i >= len(lines) {
+		return EvaluateSheet(ctx, lines)
+	}
+	for j := range lines {
+		if j != i && previous[j].Input != lines[j] {
+			return EvaluateSheet(ctx, lines)
+		}
+	}
+
+	changed := map[string]bool{previous[i].Name: true}
+	for _, name := range names {
+		changed[name] = true
+	}
+	delete(changed, "")
+
+	ctx, scope := newSheetScope(ctx)
+
+	out := make([]SheetLine, len(lines))
+	for j, in := range lines {
+		prev := previous[j]
+
+		// a line that ran out of time is calculated again in any case
+		recalc := j == i || errors.Is(prev.Err, context.DeadlineExceeded) || errors.Is(prev.Err, context.Canceled)
+		if j > i && slices.ContainsFunc(prev.Uses, func(name string) bool { return changed[name] }) {
+			recalc = true
+		}
+
+		if !recalc {
+			out[j] = prev
+			scope.replay(prev)
+			if j > i && prev.Name != "" {
+				// reassigned, the lines below read the new value
+				delete(changed, prev.Name)
+			}
+			continue
+		}
+
+		out[j] = scope.evaluate(ctx, in)
+		if j >= i && out[j].Name != "" {
+			changed[out[j].Name] = true
+		}
+	}
+
+	return out
+}
+
+// evaluate calculates a line, binding what it assigns or defines for the
+// lines below.
+func (s *sheetScope) evaluate(ctx context.Context, in string) SheetLine {
+	l := SheetLine{Input: in}
+	if isNote(in) {
+		return l
+	}
+	if err := ctx.Err(); err != nil {
+		l.Err = err
+		return l
+	}
+
+	lineCtx := expronaut.SetVariables(ctx, maps.Clone(s.vars))
+
+	if f, err := ParseDefinition(in); !errors.Is(err, ErrNotDefinition) {
+		l.definition = true
+		if err == nil {
+			l.Name, l.Uses = f.Name, f.Uses()
+			err = s.fs.Define(f)
+		}
+		if err == nil {
+			l.Value = f
+		}
+		l.Err = err
+		return l
+	}
+
+	if name, tree, err := ParseAssignment(in); !errors.Is(err, ErrNotAssignment) {
+		l.Name = name
+		if err == nil {
+			l.Uses = tree.Uses()
+			l.Value, err = tree.Evaluate(lineCtx)
+		}
+		if err != nil {
+			l.Value, l.Err = nil, err
+		}
+		s.replay(l)
+		return l
+	}
+
+	tree, err := ParseContext(lineCtx, in)
+	if err != nil {
+		l.Err = err
+		return l
+	}
+	l.Uses = tree.Uses()
+	l.Value, l.Err = tree.Evaluate(lineCtx)
+	return l
+}
+
+// replay binds what a line calculated earlier assigns or defines, without
+// calculating it again.
+func (s *sheetScope) replay(l SheetLine) {
+	switch {
+	case l.definition:
+		if f, ok := l.Value.(*Function); ok {
+			s.fs.mu.Lock()
+			s.fs.defs[f.Name] = f
+			s.fs.mu.Unlock()
+		}
+	case l.Name == "":
+	case l.Err != nil:
+		// the lines below do not see an earlier value either
+		delete(s.vars, l.Name)
+	default:
+		s.vars[l.Name] = l.Value
+	}
+}
+
+// Dependents returns the lines below line i that read what it assigns or
+// defines, directly or through the lines in between, in order. Further names
+// the change affects, such as the name the line assigned before it was
+// edited, are passed as names.
+func Dependents(sheet []SheetLine, i int, names ...string) []int {
+	if i < 0 || i >= len(sheet) {
+		return nil
+	}
+
+	changed := map[string]bool{}
+	for _, name := range append(names, sheet[i].Name) {
+		if name != "" {
+			changed[name] = true
+		}
+	}
+
+	var out []int
+	for j := i + 1; j < len(sheet); j++ {
+		l := sheet[j]
+		switch {
+		case slices.ContainsFunc(l.Uses, func(name string) bool { return changed[name] }):
+			out = append(out, j)
+			if l.Name != "" {
+				changed[l.Name] = true
+			}
+		case l.Name != "":
+			// reassigned, the lines below read the new value
+			delete(changed, l.Name)
+		}
+	}
+
+	return out
+}
+
+func isNote(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// Uses returns the names of the variables and functions the expression
+// reads, sorted.
+func (t *Tree) Uses() []string {
+	return uses(t.Root, nil)
+}
+
+// Uses returns the names of the variables and functions the body reads,
+// other than the parameters, sorted.
+func (f *Function) Uses() []string {
+	return uses(f.Tree.Root, f.Params)
+}
+
+// uses returns the names of the variables and functions the node reads,
+// other than the parameters, sorted. Targets of conversions are units and
+// not included.
+func uses(node expronaut.ASTNode, params []string) []string {
+	var names []string
+	add := func(name string) {
+		if !slices.Contains(params, name) && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	var walk func(node expronaut.ASTNode)
+	walk = func(node expronaut.ASTNode) {
+		switch n := node.(type) {
+		case *expronaut.VariableNode:
+			add(n.Name)
+		case *ConversionNode:
+			walk(n.Value)
+			return
+		case *expronaut.FunctionCallNode:
+			add(n.FunctionName)
+		}
+
+		for _, c := range children(node) {
+			walk(c)
+		}
+	}
+	walk(node)
+
+	slices.Sort(names)
+	return names
+}
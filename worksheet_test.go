@@ -0,0 +1,131 @@
+package goculator
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEvaluateSheet(t *testing.T) {
+	sheet := EvaluateSheet(context.Background(), []string{
+		"# rent",
+		"a = 2",
+		"f(x) = x * 3",
+		"b = f(a)",
+		"a = nope(1)",
+		"a + 1",
+	})
+
+	tests := []struct {
+		line    int
+		want    string
+		wantErr bool
+	}{
+		{line: 0, want: "<nil>"},
+		{line: 1, want: "2"},
+		{line: 3, want: "6"},
+		{line: 4, wantErr: true},
+		// a failed assignment leaves its variable undefined below
+		{line: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		l := sheet[tt.line]
+		if tt.wantErr {
+			if l.Err == nil {
+				t.Errorf("line %d: got %s, want an error", tt.line, Format(l.Value))
+			}
+			continue
+		}
+		if l.Err != nil {
+			t.Errorf("line %d: %v", tt.line, l.Err)
+			continue
+		}
+		if got := Format(l.Value); got != tt.want {
+			t.Errorf("line %d: got %s, want %s", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRecalculateSheet(t *testing.T) {
+	// the marker stands in for the outcome of lines that must not be
+	// calculated again
+	const marker = "kept"
+
+	tests := []struct {
+		name     string
+		before   []string
+		after    []string
+		i        int
+		names    []string
+		recalced []int
+	}{
+		{
+			name:     "dependents",
+			before:   []string{"a = 1", "b = 2", "c = a + 1", "b * 3", "d = c * 2"},
+			after:    []string{"a = 5", "b = 2", "c = a + 1", "b * 3", "d = c * 2"},
+			i:        0,
+			recalced: []int{0, 2, 4},
+		},
+		{
+			name:     "reassigned",
+			before:   []string{"a = 1", "a + 1", "a = 7", "a * 2"},
+			after:    []string{"a = 2", "a + 1", "a = 7", "a * 2"},
+			i:        0,
+			recalced: []int{0, 1},
+		},
+		{
+			name:     "renamed",
+			before:   []string{"a = 1", "b = 1", "a + b"},
+			after:    []string{"c = 1", "b = 1", "a + b"},
+			i:        0,
+			recalced: []int{0, 2},
+		},
+		{
+			name:     "function",
+			before:   []string{"f(x) = x", "1 + 1", "f(2)"},
+			after:    []string{"f(x) = x * 10", "1 + 1", "f(2)"},
+			i:        0,
+			recalced: []int{0, 2},
+		},
+		{
+			name:     "lines differ",
+			before:   []string{"a = 1", "b = 2"},
+			after:    []string{"a = 1", "b = 3", "c = 4"},
+			i:        1,
+			recalced: []int{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			previous := EvaluateSheet(ctx, tt.before)
+			for j := range previous {
+				if j != tt.i && previous[j].Name == "" {
+					previous[j].Value = marker
+				}
+			}
+
+			sheet := RecalculateSheet(ctx, previous, tt.after, tt.i, tt.names...)
+
+			full := EvaluateSheet(ctx, tt.after)
+			for j, l := range sheet {
+				recalced := false
+				for _, k := range tt.recalced {
+					recalced = recalced || k == j
+				}
+
+				if recalced || previous[j].Name != "" {
+					if got, want := Format(l.Value), Format(full[j].Value); got != want {
+						t.Errorf("line %d: got %s, want %s", j, got, want)
+					}
+					continue
+				}
+				if l.Value != marker {
+					t.Errorf("line %d: calculated again", j)
+				}
+			}
+		})
+	}
+}